@@ -0,0 +1,177 @@
+// Package charset determines the character encoding of html documents and
+// decodes them to UTF-8, following the encoding sniffing algorithm of the
+// HTML5 specification and the decoders of the WHATWG Encoding Standard.
+//
+// Supported are UTF-8, UTF-16LE and UTF-16BE, the legacy single-byte
+// encodings, Shift_JIS, EUC-JP, GBK and gb18030.
+package charset
+
+import (
+	"strings"
+)
+
+// An Encoding is a character encoding that can be decoded to UTF-8.
+type Encoding struct {
+	// Name is the name of the encoding in the Encoding Standard, such as
+	// "windows-1252" or "Shift_JIS".
+	Name string
+	// next decodes the first character of src. It returns a size of 0 if
+	// src holds an incomplete sequence and more input may follow.
+	next func(src []byte, atEOF bool) (r rune, size int)
+}
+
+func (e *Encoding) String() string {
+	return e.Name
+}
+
+// Encodings that are looked up by name often. The others are only
+// reachable through Lookup.
+var (
+	UTF8    = &Encoding{"UTF-8", nextUTF8}
+	UTF16LE = &Encoding{"UTF-16LE", nextUTF16LE}
+	UTF16BE = &Encoding{"UTF-16BE", nextUTF16BE}
+
+	// Windows1252 is the fallback for documents that do not declare their
+	// encoding and are not valid UTF-8. It also decodes documents labeled
+	// ISO-8859-1 or US-ASCII, as browsers do.
+	Windows1252 = singleByteEncoding("windows-1252")
+
+	ShiftJIS = &Encoding{"Shift_JIS", nextShiftJIS}
+	EUCJP    = &Encoding{"EUC-JP", nextEUCJP}
+	GBK      = &Encoding{"GBK", nextGB18030}
+	GB18030  = &Encoding{"gb18030", nextGB18030}
+)
+
+func singleByteEncoding(name string) *Encoding {
+	table := singleByte[name]
+	return &Encoding{name, func(src []byte, atEOF bool) (rune, int) {
+		if c := src[0]; c < 0x80 {
+			return rune(c), 1
+		} else if r := table[c-0x80]; r != 0 {
+			return r, 1
+		}
+		return replacement, 1
+	}}
+}
+
+// encodings maps the names of the supported encodings to them.
+var encodings = map[string]*Encoding{}
+
+func init() {
+	for _, e := range []*Encoding{UTF8, UTF16LE, UTF16BE, Windows1252, ShiftJIS, EUCJP, GBK, GB18030} {
+		encodings[e.Name] = e
+	}
+	for name := range singleByte {
+		if encodings[name] == nil {
+			encodings[name] = singleByteEncoding(name)
+		}
+	}
+}
+
+// labels maps the labels of the Encoding Standard to the names of the
+// encodings they stand for.
+var labels = map[string]string{
+	"unicode-1-1-utf-8": "UTF-8", "unicode11utf8": "UTF-8", "unicode20utf8": "UTF-8",
+	"utf-8": "UTF-8", "utf8": "UTF-8", "x-unicode20utf8": "UTF-8",
+
+	"866": "ibm866", "cp866": "ibm866", "csibm866": "ibm866", "ibm866": "ibm866",
+
+	"csisolatin2": "iso-8859-2", "iso-8859-2": "iso-8859-2", "iso-ir-101": "iso-8859-2",
+	"iso8859-2": "iso-8859-2", "iso88592": "iso-8859-2", "iso_8859-2": "iso-8859-2",
+	"iso_8859-2:1987": "iso-8859-2", "l2": "iso-8859-2", "latin2": "iso-8859-2",
+
+	"csisolatin3": "iso-8859-3", "iso-8859-3": "iso-8859-3", "iso-ir-109": "iso-8859-3",
+	"iso8859-3": "iso-8859-3", "iso88593": "iso-8859-3", "iso_8859-3": "iso-8859-3",
+	"iso_8859-3:1988": "iso-8859-3", "l3": "iso-8859-3", "latin3": "iso-8859-3",
+
+	"csisolatin4": "iso-8859-4", "iso-8859-4": "iso-8859-4", "iso-ir-110": "iso-8859-4",
+	"iso8859-4": "iso-8859-4", "iso88594": "iso-8859-4", "iso_8859-4": "iso-8859-4",
+	"iso_8859-4:1988": "iso-8859-4", "l4": "iso-8859-4", "latin4": "iso-8859-4",
+
+	"csisolatincyrillic": "iso-8859-5", "cyrillic": "iso-8859-5", "iso-8859-5": "iso-8859-5",
+	"iso-ir-144": "iso-8859-5", "iso8859-5": "iso-8859-5", "iso88595": "iso-8859-5",
+	"iso_8859-5": "iso-8859-5", "iso_8859-5:1988": "iso-8859-5",
+
+	"arabic": "iso-8859-6", "asmo-708": "iso-8859-6", "csiso88596e": "iso-8859-6",
+	"csiso88596i": "iso-8859-6", "csisolatinarabic": "iso-8859-6", "ecma-114": "iso-8859-6",
+	"iso-8859-6": "iso-8859-6", "iso-8859-6-e": "iso-8859-6", "iso-8859-6-i": "iso-8859-6",
+	"iso-ir-127": "iso-8859-6", "iso8859-6": "iso-8859-6", "iso88596": "iso-8859-6",
+	"iso_8859-6": "iso-8859-6", "iso_8859-6:1987": "iso-8859-6",
+
+	"csisolatingreek": "iso-8859-7", "ecma-118": "iso-8859-7", "elot_928": "iso-8859-7",
+	"greek": "iso-8859-7", "greek8": "iso-8859-7", "iso-8859-7": "iso-8859-7",
+	"iso-ir-126": "iso-8859-7", "iso8859-7": "iso-8859-7", "iso88597": "iso-8859-7",
+	"iso_8859-7": "iso-8859-7", "iso_8859-7:1987": "iso-8859-7", "sun_eu_greek": "iso-8859-7",
+
+	"csiso88598e": "iso-8859-8", "csisolatinhebrew": "iso-8859-8", "hebrew": "iso-8859-8",
+	"iso-8859-8": "iso-8859-8", "iso-8859-8-e": "iso-8859-8", "iso-ir-138": "iso-8859-8",
+	"iso8859-8": "iso-8859-8", "iso88598": "iso-8859-8", "iso_8859-8": "iso-8859-8",
+	"iso_8859-8:1988": "iso-8859-8", "visual": "iso-8859-8",
+	"csiso88598i": "iso-8859-8", "iso-8859-8-i": "iso-8859-8", "logical": "iso-8859-8",
+
+	"csisolatin6": "iso-8859-10", "iso-8859-10": "iso-8859-10", "iso-ir-157": "iso-8859-10",
+	"iso8859-10": "iso-8859-10", "iso885910": "iso-8859-10", "l6": "iso-8859-10",
+	"latin6": "iso-8859-10",
+
+	"iso-8859-13": "iso-8859-13", "iso8859-13": "iso-8859-13", "iso885913": "iso-8859-13",
+	"iso-8859-14": "iso-8859-14", "iso8859-14": "iso-8859-14", "iso885914": "iso-8859-14",
+
+	"csisolatin9": "iso-8859-15", "iso-8859-15": "iso-8859-15", "iso8859-15": "iso-8859-15",
+	"iso885915": "iso-8859-15", "iso_8859-15": "iso-8859-15", "l9": "iso-8859-15",
+
+	"iso-8859-16": "iso-8859-16",
+
+	"cskoi8r": "koi8-r", "koi": "koi8-r", "koi8": "koi8-r", "koi8-r": "koi8-r", "koi8_r": "koi8-r",
+	"koi8-ru": "koi8-u", "koi8-u": "koi8-u",
+
+	"csmacintosh": "macintosh", "mac": "macintosh", "macintosh": "macintosh",
+	"x-mac-roman": "macintosh",
+
+	"cp1250": "windows-1250", "windows-1250": "windows-1250", "x-cp1250": "windows-1250",
+	"cp1251": "windows-1251", "windows-1251": "windows-1251", "x-cp1251": "windows-1251",
+
+	"ansi_x3.4-1968": "windows-1252", "ascii": "windows-1252", "cp1252": "windows-1252",
+	"cp819": "windows-1252", "csisolatin1": "windows-1252", "ibm819": "windows-1252",
+	"iso-8859-1": "windows-1252", "iso-ir-100": "windows-1252", "iso8859-1": "windows-1252",
+	"iso88591": "windows-1252", "iso_8859-1": "windows-1252", "iso_8859-1:1987": "windows-1252",
+	"l1": "windows-1252", "latin1": "windows-1252", "us-ascii": "windows-1252",
+	"windows-1252": "windows-1252", "x-cp1252": "windows-1252",
+
+	"cp1253": "windows-1253", "windows-1253": "windows-1253", "x-cp1253": "windows-1253",
+
+	"cp1254": "windows-1254", "csisolatin5": "windows-1254", "iso-8859-9": "windows-1254",
+	"iso-ir-148": "windows-1254", "iso8859-9": "windows-1254", "iso88599": "windows-1254",
+	"iso_8859-9": "windows-1254", "iso_8859-9:1989": "windows-1254", "l5": "windows-1254",
+	"latin5": "windows-1254", "windows-1254": "windows-1254", "x-cp1254": "windows-1254",
+
+	"cp1255": "windows-1255", "windows-1255": "windows-1255", "x-cp1255": "windows-1255",
+	"cp1256": "windows-1256", "windows-1256": "windows-1256", "x-cp1256": "windows-1256",
+	"cp1257": "windows-1257", "windows-1257": "windows-1257", "x-cp1257": "windows-1257",
+	"cp1258": "windows-1258", "windows-1258": "windows-1258", "x-cp1258": "windows-1258",
+
+	"chinese": "GBK", "csgb2312": "GBK", "csiso58gb231280": "GBK", "gb2312": "GBK",
+	"gb_2312": "GBK", "gb_2312-80": "GBK", "gbk": "GBK", "iso-ir-58": "GBK", "x-gbk": "GBK",
+	"gb18030": "gb18030",
+
+	"cseucpkdfmtjapanese": "EUC-JP", "euc-jp": "EUC-JP", "x-euc-jp": "EUC-JP",
+
+	"csshiftjis": "Shift_JIS", "ms932": "Shift_JIS", "ms_kanji": "Shift_JIS",
+	"shift-jis": "Shift_JIS", "shift_jis": "Shift_JIS", "sjis": "Shift_JIS",
+	"windows-31j": "Shift_JIS", "x-sjis": "Shift_JIS",
+
+	"csunicode": "UTF-16LE", "iso-10646-ucs-2": "UTF-16LE", "ucs-2": "UTF-16LE",
+	"unicode": "UTF-16LE", "unicodefeff": "UTF-16LE", "utf-16": "UTF-16LE", "utf-16le": "UTF-16LE",
+
+	"unicodefffe": "UTF-16BE", "utf-16be": "UTF-16BE",
+}
+
+// Lookup returns the encoding with the given label, ignoring case and
+// surrounding white space, or nil if the label is unknown or the encoding
+// is not supported.
+func Lookup(label string) *Encoding {
+	name, ok := labels[strings.ToLower(strings.Trim(label, "\t\n\f\r "))]
+	if !ok {
+		return nil
+	}
+	return encodings[name]
+}
@@ -0,0 +1,145 @@
+package charset
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		label, want string
+	}{
+		{"utf-8", "UTF-8"},
+		{" UTF8\n", "UTF-8"},
+		{"ISO-8859-1", "windows-1252"},
+		{"us-ascii", "windows-1252"},
+		{"latin2", "iso-8859-2"},
+		{"Shift_JIS", "Shift_JIS"},
+		{"x-sjis", "Shift_JIS"},
+		{"gb2312", "GBK"},
+		{"GB18030", "gb18030"},
+		{"euc-jp", "EUC-JP"},
+		{"koi8-r", "koi8-r"},
+		{"utf-16", "UTF-16LE"},
+	}
+	for _, test := range tests {
+		e := Lookup(test.label)
+		if e == nil || e.Name != test.want {
+			t.Errorf("Lookup(%q) = %v, want %s", test.label, e, test.want)
+		}
+	}
+	for _, label := range []string{"", "utf-7", "big5", "x-user-defined"} {
+		if e := Lookup(label); e != nil {
+			t.Errorf("Lookup(%q) = %v, want nil", label, e)
+		}
+	}
+}
+
+func TestDetermine(t *testing.T) {
+	tests := []struct {
+		doc, contentType string
+		want             *Encoding
+		certain          bool
+	}{
+		{"\xEF\xBB\xBF<meta charset=latin1>", "text/html; charset=sjis", UTF8, true},
+		{"\xFF\xFEa\x00", "", UTF16LE, true},
+		{"\xFE\xFF\x00a", "", UTF16BE, true},
+		{"<meta charset=latin1>", "text/html; charset=Shift_JIS", ShiftJIS, true},
+		{"<meta charset=latin1>", "text/html; charset=bogus", Windows1252, false},
+		{"<meta charset=latin1>", "", Windows1252, false},
+		{`<html><head><META CHARSET="EUC-JP"></head>`, "", EUCJP, false},
+		{`<meta http-equiv="Content-Type" content="text/html; charset=gbk">`, "", GBK, false},
+		{`<meta content='text/html; charset="koi8-r"' http-equiv=content-type>`, "", Lookup("koi8-r"), false},
+		// Without http-equiv the content attribute does not count.
+		{`<meta content="text/html; charset=gbk">caf\xC3\xA9`, "", UTF8, false},
+		{`<!-- <meta charset=gbk> --><meta charset=sjis>`, "", ShiftJIS, false},
+		{`<p title="<meta charset=gbk>"><meta charset=sjis>`, "", ShiftJIS, false},
+		{`<meta charset=utf-16le>`, "", UTF8, false},
+		{`<meta charset=big5><meta charset=gbk>`, "", GBK, false},
+		{"plain caf\xC3\xA9", "text/html", UTF8, false},
+		{"plain caf\xE9 au lait", "", Windows1252, false},
+		// A character cut short by the end of the prefix.
+		{"caf\xC3", "", UTF8, false},
+		{strings.Repeat(" ", 1024) + "<meta charset=gbk>", "", UTF8, false},
+	}
+	for _, test := range tests {
+		e, certain := Determine([]byte(test.doc), test.contentType)
+		if e != test.want || certain != test.certain {
+			t.Errorf("Determine(%q, %q) = %v, %t, want %v, %t", test.doc, test.contentType, e, certain, test.want, test.certain)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		e        *Encoding
+		in, want string
+	}{
+		{Windows1252, "\x93caf\xE9\x94 \x80", "“café” €"},
+		{Lookup("iso-8859-15"), "\xA4", "€"},
+		{Lookup("windows-1251"), "\xCF\xF0\xE8\xE2\xE5\xF2", "Привет"},
+		{Lookup("koi8-r"), "\xF0\xD2\xC9\xD7\xC5\xD4", "Привет"},
+		{Lookup("iso-8859-3"), "a\xA5b", "a�b"},
+		{ShiftJIS, "\x82\xA0\x82\xA2 \xB1\x93\xFA\x96\x7B", "あい ｱ日本"},
+		{ShiftJIS, "\x82 a", "� a"},
+		{ShiftJIS, "\x82", "�"},
+		{ShiftJIS, "\xF0\x40", "\uE000"},
+		{EUCJP, "\xA4\xA2\xA4\xA4 \x8E\xB1\xC6\xFC\xCB\xDC", "あい ｱ日本"},
+		{EUCJP, "\x8F\xB0\xA1x", "�x"},
+		{GBK, "\xC4\xE3\xBA\xC3 \x80", "你好 €"},
+		{GB18030, "\x81\x30\x81\x30\x95\x32\x82\x36\x84\x31\xA4\x39", "\u0080\U00020000\uFFFF"},
+		{GB18030, "\x81\x30x", "�0x"},
+		{UTF16LE, "h\x00i\x00=\xD8\x00\xDE", "hi😀"},
+		{UTF16BE, "\x00h\x00i\xD8=\xDE\x00", "hi😀"},
+		{UTF16LE, "\x00\xDCa\x00=\xD8", "�a�"},
+		{UTF16BE, "\x00h\x00", "h�"},
+	}
+	for _, test := range tests {
+		for _, small := range []bool{false, true} {
+			r := test.e.NewDecoder(iotest.OneByteReader(strings.NewReader(test.in)))
+			var got []byte
+			var err error
+			if small {
+				// Read one byte at a time to split multi-byte characters.
+				got, err = ioutil.ReadAll(iotest.OneByteReader(r))
+			} else {
+				got, err = ioutil.ReadAll(r)
+			}
+			if err != nil {
+				t.Errorf("%s %q: %v", test.e, test.in, err)
+				continue
+			}
+			if string(got) != test.want {
+				t.Errorf("%s %q: got %q, want %q", test.e, test.in, got, test.want)
+			}
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	tests := []struct {
+		doc, contentType, want string
+		e                      *Encoding
+	}{
+		{"\xEF\xBB\xBFcaf\xC3\xA9", "", "café", UTF8},
+		{"\xFF\xFEh\x00i\x00", "", "hi", UTF16LE},
+		{"<meta charset=latin1>caf\xE9", "", "<meta charset=latin1>café", Windows1252},
+		{"\x82\xA0" + strings.Repeat("x", 5000), "text/html;charset=sjis", "あ" + strings.Repeat("x", 5000), ShiftJIS},
+	}
+	for _, test := range tests {
+		r, e, err := NewReader(bytes.NewReader([]byte(test.doc)), test.contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e != test.e || string(got) != test.want {
+			t.Errorf("NewReader(%.20q) = %.20q, %v, want %.20q, %v", test.doc, got, e, test.want, test.e)
+		}
+	}
+}
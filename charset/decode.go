@@ -0,0 +1,282 @@
+package charset
+
+import (
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+const replacement = utf8.RuneError
+
+// NewDecoder returns a reader that decodes r from e to UTF-8. Bytes that
+// are not valid in e are decoded as U+FFFD. UTF-8 input is returned as is.
+func (e *Encoding) NewDecoder(r io.Reader) io.Reader {
+	if e == UTF8 {
+		return r
+	}
+	return &decoder{r: r, next: e.next, buf: make([]byte, 4096)}
+}
+
+type decoder struct {
+	r    io.Reader
+	next func(src []byte, atEOF bool) (rune, int)
+	// buf[start:end] is the input that has been read but not decoded.
+	buf        []byte
+	start, end int
+	err        error
+	// pending holds the end of a character that did not fit in the last
+	// Read.
+	pending []byte
+	scratch [utf8.UTFMax]byte
+}
+
+func (d *decoder) Read(p []byte) (int, error) {
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	for n < len(p) && len(d.pending) == 0 {
+		var r rune
+		var size int
+		if d.start < d.end {
+			r, size = d.next(d.buf[d.start:d.end], d.err != nil)
+		}
+		if size == 0 {
+			if d.err != nil || n > 0 {
+				break
+			}
+			d.fill()
+			continue
+		}
+		d.start += size
+		if utf8.RuneLen(r) <= len(p)-n {
+			n += utf8.EncodeRune(p[n:], r)
+		} else {
+			m := utf8.EncodeRune(d.scratch[:], r)
+			c := copy(p[n:], d.scratch[:m])
+			d.pending = d.scratch[c:m]
+			n += c
+		}
+	}
+	if n == 0 && d.err != nil {
+		return 0, d.err
+	}
+	return n, nil
+}
+
+// fill moves the undecoded input to the start of buf and reads more after
+// it.
+func (d *decoder) fill() {
+	if d.start > 0 {
+		d.end = copy(d.buf, d.buf[d.start:d.end])
+		d.start = 0
+	}
+	m, err := d.r.Read(d.buf[d.end:])
+	d.end += m
+	if err != nil {
+		d.err = err
+	}
+}
+
+// The next functions below decode the first character of src as the
+// decoders of the Encoding Standard do. src is never empty. They return a
+// size of 0 to ask for more input, which only happens if atEOF is false.
+// Invalid bytes decode as U+FFFD; a byte that can start a new character is
+// not consumed as part of an invalid sequence.
+
+func nextUTF8(src []byte, atEOF bool) (rune, int) {
+	if src[0] < utf8.RuneSelf {
+		return rune(src[0]), 1
+	}
+	if !atEOF && !utf8.FullRune(src) {
+		return 0, 0
+	}
+	return utf8.DecodeRune(src)
+}
+
+func nextUTF16LE(src []byte, atEOF bool) (rune, int) {
+	return nextUTF16(src, atEOF, func(b []byte) rune { return rune(b[0]) | rune(b[1])<<8 })
+}
+
+func nextUTF16BE(src []byte, atEOF bool) (rune, int) {
+	return nextUTF16(src, atEOF, func(b []byte) rune { return rune(b[0])<<8 | rune(b[1]) })
+}
+
+func nextUTF16(src []byte, atEOF bool, unit func([]byte) rune) (rune, int) {
+	if len(src) < 2 {
+		return incomplete(src, atEOF)
+	}
+	u := unit(src)
+	switch {
+	case u < 0xD800 || u > 0xDFFF:
+		return u, 2
+	case u > 0xDBFF:
+		// A lone trail surrogate.
+		return replacement, 2
+	case len(src) < 4:
+		if !atEOF {
+			return 0, 0
+		}
+		return replacement, 2
+	}
+	v := unit(src[2:])
+	if v < 0xDC00 || v > 0xDFFF {
+		return replacement, 2
+	}
+	return 0x10000 + (u-0xD800)<<10 + (v - 0xDC00), 4
+}
+
+// incomplete handles a sequence cut short by the end of src.
+func incomplete(src []byte, atEOF bool) (rune, int) {
+	if !atEOF {
+		return 0, 0
+	}
+	return replacement, len(src)
+}
+
+// invalid returns the size of an invalid two-byte sequence: the trail byte
+// is left for the next character if it is ASCII.
+func invalid(trail byte) (rune, int) {
+	if trail < 0x80 {
+		return replacement, 1
+	}
+	return replacement, 2
+}
+
+func lookup(table []uint16, pointer int) rune {
+	if pointer < 0 || pointer >= len(table) || table[pointer] == 0 {
+		return -1
+	}
+	return rune(table[pointer])
+}
+
+func nextShiftJIS(src []byte, atEOF bool) (rune, int) {
+	b := src[0]
+	switch {
+	case b <= 0x80:
+		return rune(b), 1
+	case 0xA1 <= b && b <= 0xDF:
+		return 0xFF61 - 0xA1 + rune(b), 1
+	case b < 0x81 || 0x9F < b && b < 0xE0 || b > 0xFC:
+		return replacement, 1
+	case len(src) < 2:
+		return incomplete(src, atEOF)
+	}
+	trail := src[1]
+	if trail < 0x40 || trail == 0x7F || trail > 0xFC {
+		return invalid(trail)
+	}
+	leadOffset, trailOffset := 0x81, 0x40
+	if b >= 0xA0 {
+		leadOffset = 0xC1
+	}
+	if trail >= 0x7F {
+		trailOffset = 0x41
+	}
+	pointer := (int(b)-leadOffset)*188 + int(trail) - trailOffset
+	if 8836 <= pointer && pointer <= 10715 {
+		// The range of user defined characters.
+		return 0xE000 - 8836 + rune(pointer), 2
+	}
+	if r := lookup(jis0208[:], pointer); r >= 0 {
+		return r, 2
+	}
+	return invalid(trail)
+}
+
+func nextEUCJP(src []byte, atEOF bool) (rune, int) {
+	b := src[0]
+	switch {
+	case b < 0x80:
+		return rune(b), 1
+	case b != 0x8E && b != 0x8F && (b < 0xA1 || b == 0xFF):
+		return replacement, 1
+	case len(src) < 2:
+		return incomplete(src, atEOF)
+	}
+	trail := src[1]
+	switch {
+	case b == 0x8E:
+		if 0xA1 <= trail && trail <= 0xDF {
+			return 0xFF61 - 0xA1 + rune(trail), 2
+		}
+		return invalid(trail)
+	case b == 0x8F:
+		// JIS X 0212 characters have no table here.
+		if trail < 0xA1 || trail == 0xFF {
+			return invalid(trail)
+		}
+		if len(src) < 3 {
+			return incomplete(src, atEOF)
+		}
+		if src[2] < 0xA1 || src[2] == 0xFF {
+			return replacement, 1
+		}
+		return replacement, 3
+	case trail < 0xA1 || trail == 0xFF:
+		return invalid(trail)
+	}
+	if r := lookup(jis0208[:], (int(b)-0xA1)*94+int(trail)-0xA1); r >= 0 {
+		return r, 2
+	}
+	return replacement, 2
+}
+
+func nextGB18030(src []byte, atEOF bool) (rune, int) {
+	b := src[0]
+	switch {
+	case b < 0x80:
+		return rune(b), 1
+	case b == 0x80:
+		return 0x20AC, 1
+	case b == 0xFF:
+		return replacement, 1
+	case len(src) < 2:
+		return incomplete(src, atEOF)
+	}
+	second := src[1]
+	if '0' <= second && second <= '9' {
+		if len(src) > 2 && (src[2] < 0x81 || src[2] == 0xFF) {
+			return replacement, 1
+		}
+		if len(src) < 4 {
+			return incomplete(src, atEOF)
+		}
+		third, fourth := src[2], src[3]
+		if fourth < '0' || fourth > '9' {
+			return replacement, 1
+		}
+		pointer := ((int(b)-0x81)*10+int(second-'0'))*1260 + (int(third)-0x81)*10 + int(fourth-'0')
+		if r := rangesCodePoint(pointer); r >= 0 {
+			return r, 4
+		}
+		return replacement, 4
+	}
+	if second < 0x40 || second == 0x7F || second == 0xFF {
+		return invalid(second)
+	}
+	offset := 0x40
+	if second > 0x7F {
+		offset = 0x41
+	}
+	if r := lookup(gb18030[:], (int(b)-0x81)*190+int(second)-offset); r >= 0 {
+		return r, 2
+	}
+	return invalid(second)
+}
+
+// rangesCodePoint returns the code point of a four-byte gb18030 sequence,
+// or -1 if the pointer has none.
+func rangesCodePoint(pointer int) rune {
+	switch {
+	case pointer > 39419 && pointer < 189000 || pointer > 1237575:
+		return -1
+	case pointer >= 189000:
+		return 0x10000 + rune(pointer-189000)
+	case pointer == 7457:
+		return 0xE7C7
+	}
+	i := sort.Search(len(gb18030Ranges), func(i int) bool {
+		return int(gb18030Ranges[i][0]) > pointer
+	}) - 1
+	r := gb18030Ranges[i]
+	return rune(int(r[1]) + pointer - int(r[0]))
+}
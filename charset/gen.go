@@ -0,0 +1,182 @@
+//go:build ignore
+// +build ignore
+
+// This program generates tables.go from the indexes of the WHATWG Encoding
+// Standard.
+//
+//	go run gen.go [-index dir]
+//
+// The indexes are downloaded from encoding.spec.whatwg.org unless -index
+// names a directory holding copies of the index-*.txt files.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var indexDir = flag.String("index", "", "read the index files from `dir` instead of downloading them")
+
+// singleByte lists the single-byte encodings that get a table.
+var singleByte = []string{
+	"ibm866",
+	"iso-8859-2", "iso-8859-3", "iso-8859-4", "iso-8859-5", "iso-8859-6",
+	"iso-8859-7", "iso-8859-8", "iso-8859-10", "iso-8859-13", "iso-8859-14",
+	"iso-8859-15", "iso-8859-16",
+	"koi8-r", "koi8-u", "macintosh",
+	"windows-1250", "windows-1251", "windows-1252", "windows-1253",
+	"windows-1254", "windows-1255", "windows-1256", "windows-1257",
+	"windows-1258",
+}
+
+func main() {
+	flag.Parse()
+
+	var b bytes.Buffer
+
+	b.WriteString("// Code generated by gen.go; DO NOT EDIT.\n\npackage charset\n\n")
+
+	writeIndex(&b, "jis0208", "jis0208 maps the pointers of Shift_JIS and EUC-JP to code points.")
+	writeIndex(&b, "gb18030", "gb18030 maps the pointers of two-byte GBK and gb18030 sequences to\n// code points.")
+
+	b.WriteString("// gb18030Ranges maps the first pointer of each range of four-byte\n")
+	b.WriteString("// gb18030 sequences to its first code point.\n")
+	b.WriteString("var gb18030Ranges = [...][2]uint32{\n")
+
+	for _, e := range readIndex("gb18030-ranges") {
+		fmt.Fprintf(&b, "{%d, 0x%04X},\n", e[0], e[1])
+	}
+
+	b.WriteString("}\n\n")
+	b.WriteString("// singleByte maps the name of each single-byte encoding to the code\n")
+	b.WriteString("// points of its bytes 0x80 to 0xFF. Zero entries are unmapped.\n")
+	b.WriteString("var singleByte = map[string]*[128]rune{\n")
+
+	for _, name := range singleByte {
+		fmt.Fprintf(&b, "%q: {", name)
+
+		var table [128]rune
+
+		for _, e := range readIndex(name) {
+			table[e[0]] = rune(e[1])
+		}
+
+		for i, r := range table {
+			if i%8 == 0 {
+				b.WriteString("\n")
+			}
+
+			fmt.Fprintf(&b, "0x%04X, ", r)
+		}
+
+		b.WriteString("\n},\n")
+	}
+
+	b.WriteString("}\n")
+
+	src, err := format.Source(b.Bytes())
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile("tables.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeIndex writes the index called name as a []uint16 indexed by
+// pointer.
+func writeIndex(b *bytes.Buffer, name, doc string) {
+	var entries = readIndex(name)
+	var table = make([]uint16, entries[len(entries)-1][0]+1)
+
+	for _, e := range entries {
+		if e[1] > 0xFFFF {
+			log.Fatalf("index %s: code point %#x outside the BMP", name, e[1])
+		}
+
+		table[e[0]] = uint16(e[1])
+	}
+
+	fmt.Fprintf(b, "// %s\n// Zero entries are unmapped.\n", doc)
+	fmt.Fprintf(b, "var %s = [...]uint16{", name)
+
+	for i, cp := range table {
+		if i%8 == 0 {
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(b, "0x%04X, ", cp)
+	}
+
+	b.WriteString("\n}\n\n")
+}
+
+// readIndex returns the pointer and code point pairs of the index called
+// name.
+func readIndex(name string) [][2]uint32 {
+	var r io.Reader
+
+	if *indexDir != "" {
+		f, err := os.Open(filepath.Join(*indexDir, "index-"+name+".txt"))
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer f.Close()
+		r = f
+	} else {
+		resp, err := http.Get("https://encoding.spec.whatwg.org/index-" + name + ".txt")
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer resp.Body.Close()
+		r = resp.Body
+	}
+
+	var entries [][2]uint32
+	var s = bufio.NewScanner(r)
+
+	for s.Scan() {
+		var fields = strings.Fields(s.Text())
+
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		pointer, err := strconv.ParseUint(fields[0], 10, 32)
+
+		if err != nil {
+			log.Fatalf("index %s: %v", name, err)
+		}
+
+		cp, err := strconv.ParseUint(fields[1], 0, 32)
+
+		if err != nil {
+			log.Fatalf("index %s: %v", name, err)
+		}
+
+		entries = append(entries, [2]uint32{uint32(pointer), uint32(cp)})
+	}
+
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	return entries
+}
@@ -0,0 +1,299 @@
+package charset
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"unicode/utf8"
+)
+
+// prescanLength is the number of bytes of a document searched for a meta
+// element declaring its encoding.
+const prescanLength = 1024
+
+// Determine returns the encoding of a document that starts with prefix and
+// was served with the given Content-Type header, which may be empty. As in
+// the encoding sniffing algorithm of HTML5 it looks for, in order, a byte
+// order mark, the charset parameter of contentType and a meta element in
+// the first 1024 bytes of prefix. Documents declaring none of them are
+// taken as UTF-8 if prefix is valid UTF-8, and as windows-1252 otherwise.
+// certain reports whether the encoding came from a byte order mark or
+// contentType.
+func Determine(prefix []byte, contentType string) (e *Encoding, certain bool) {
+	if e, _ := bom(prefix); e != nil {
+		return e, true
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if e := Lookup(params["charset"]); e != nil {
+			return e, true
+		}
+	}
+	if len(prefix) > prescanLength {
+		prefix = prefix[:prescanLength]
+	}
+	if e := Prescan(prefix); e != nil {
+		return e, false
+	}
+	if validUTF8(prefix) {
+		return UTF8, false
+	}
+	return Windows1252, false
+}
+
+// NewReader returns a reader that decodes the document read from r to
+// UTF-8, along with the encoding Determine finds for it. The byte order
+// mark, if any, is skipped.
+func NewReader(r io.Reader, contentType string) (io.Reader, *Encoding, error) {
+	br := bufio.NewReaderSize(r, prescanLength)
+	prefix, err := br.Peek(prescanLength)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	e, _ := Determine(prefix, contentType)
+	if be, n := bom(prefix); be == e {
+		br.Discard(n)
+	}
+	return e.NewDecoder(br), e, nil
+}
+
+// bom returns the encoding indicated by the byte order mark at the start
+// of b and its length, or nil.
+func bom(b []byte) (*Encoding, int) {
+	switch {
+	case bytes.HasPrefix(b, []byte("\xEF\xBB\xBF")):
+		return UTF8, 3
+	case bytes.HasPrefix(b, []byte("\xFE\xFF")):
+		return UTF16BE, 2
+	case bytes.HasPrefix(b, []byte("\xFF\xFE")):
+		return UTF16LE, 2
+	}
+	return nil, 0
+}
+
+// validUTF8 reports whether b is valid UTF-8, allowing for a character cut
+// short at its end.
+func validUTF8(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(b)
+		}
+		b = b[size:]
+	}
+	return true
+}
+
+// Prescan looks for a meta element declaring the encoding of the document
+// starting with b, as the prescan algorithm of HTML5 does. It returns nil
+// if there is none, or if it names an unsupported encoding.
+func Prescan(b []byte) *Encoding {
+	for i := 0; i < len(b); i++ {
+		switch {
+		case bytes.HasPrefix(b[i:], []byte("<!--")):
+			j := bytes.Index(b[i+2:], []byte("-->"))
+			if j < 0 {
+				return nil
+			}
+			i += 2 + j + 2
+		case hasPrefixFold(b[i:], "<meta") && len(b) > i+5 && (isSpace(b[i+5]) || b[i+5] == '/'):
+			var e *Encoding
+			if e, i = prescanMeta(b, i+6); e != nil {
+				return e
+			}
+		case len(b) > i+1 && b[i] == '<' && isLetter(b[i+1]),
+			len(b) > i+2 && b[i] == '<' && b[i+1] == '/' && isLetter(b[i+2]):
+			for i < len(b) && !isSpace(b[i]) && b[i] != '>' {
+				i++
+			}
+			for {
+				var ok bool
+				if _, _, i, ok = attribute(b, i); !ok {
+					break
+				}
+			}
+		case bytes.HasPrefix(b[i:], []byte("<!")), bytes.HasPrefix(b[i:], []byte("</")),
+			bytes.HasPrefix(b[i:], []byte("<?")):
+			j := bytes.IndexByte(b[i+2:], '>')
+			if j < 0 {
+				return nil
+			}
+			i += 2 + j
+		}
+	}
+	return nil
+}
+
+// prescanMeta processes the attributes of a meta element starting at i. It
+// returns the encoding the element declares, if any, and the position
+// after its attributes.
+func prescanMeta(b []byte, i int) (*Encoding, int) {
+	var (
+		seen       = make(map[string]bool)
+		gotPragma  bool
+		needPragma int // 0 for unset, 1 for true and 2 for false
+		e          *Encoding
+	)
+	for {
+		name, val, next, ok := attribute(b, i)
+		i = next
+		if !ok {
+			break
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		switch name {
+		case "http-equiv":
+			gotPragma = gotPragma || val == "content-type"
+		case "content":
+			if e == nil {
+				if label, ok := contentCharset(val); ok {
+					e, needPragma = Lookup(label), 1
+				}
+			}
+		case "charset":
+			e, needPragma = Lookup(val), 2
+		}
+	}
+	if needPragma == 0 || needPragma == 1 && !gotPragma || e == nil {
+		return nil, i
+	}
+	if e == UTF16LE || e == UTF16BE {
+		// A document that can be prescanned is not UTF-16.
+		return UTF8, i
+	}
+	return e, i
+}
+
+// attribute gets the attribute starting at or after i, with its name and
+// value lower-cased. It returns false if there are no more attributes.
+func attribute(b []byte, i int) (name, val string, next int, ok bool) {
+	for i < len(b) && (isSpace(b[i]) || b[i] == '/') {
+		i++
+	}
+	if i >= len(b) || b[i] == '>' {
+		return "", "", i, false
+	}
+	var n []byte
+	for ; ; i++ {
+		if i >= len(b) {
+			return "", "", i, false
+		}
+		c := b[i]
+		if c == '=' && len(n) > 0 {
+			i++
+			break
+		}
+		if isSpace(c) {
+			for i < len(b) && isSpace(b[i]) {
+				i++
+			}
+			if i >= len(b) || b[i] != '=' {
+				return string(n), "", i, true
+			}
+			i++
+			break
+		}
+		if c == '/' || c == '>' {
+			return string(n), "", i, true
+		}
+		n = append(n, toLower(c))
+	}
+	for i < len(b) && isSpace(b[i]) {
+		i++
+	}
+	if i >= len(b) {
+		return "", "", i, false
+	}
+	var v []byte
+	if q := b[i]; q == '"' || q == '\'' {
+		for i++; ; i++ {
+			if i >= len(b) {
+				return "", "", i, false
+			}
+			if b[i] == q {
+				return string(n), string(v), i + 1, true
+			}
+			v = append(v, toLower(b[i]))
+		}
+	}
+	for ; i < len(b) && !isSpace(b[i]) && b[i] != '>'; i++ {
+		v = append(v, toLower(b[i]))
+	}
+	return string(n), string(v), i, true
+}
+
+// contentCharset extracts the encoding label from the content attribute of
+// a meta element, as in "text/html; charset=utf-8".
+func contentCharset(s string) (string, bool) {
+	for i := 0; ; {
+		j := indexFold(s[i:], "charset")
+		if j < 0 {
+			return "", false
+		}
+		i += j + len("charset")
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) || s[i] != '=' {
+			continue
+		}
+		for i++; i < len(s) && isSpace(s[i]); i++ {
+		}
+		if i >= len(s) {
+			return "", false
+		}
+		if q := s[i]; q == '"' || q == '\'' {
+			j := bytes.IndexByte([]byte(s[i+1:]), q)
+			if j < 0 {
+				return "", false
+			}
+			return s[i+1 : i+1+j], true
+		}
+		j = i
+		for j < len(s) && !isSpace(s[j]) && s[j] != ';' {
+			j++
+		}
+		return s[i:j], true
+	}
+}
+
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if hasPrefixFold([]byte(s[i:]), substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasPrefixFold reports whether b starts with the lower-case ASCII prefix,
+// ignoring the case of b.
+func hasPrefixFold(b []byte, prefix string) bool {
+	if len(b) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		if toLower(b[i]) != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,390 @@
+//go:build !appengine
+// +build !appengine
+
+// Command html2json converts html documents to their json representation
+// without going through the App Engine service.
+//
+// Usage:
+//
+//	html2json [flags] [file|glob ...]
+//	html2json -http=:8080
+//
+// With no arguments, or with "-", the document is read from stdin and the
+// json is written to stdout. Files are converted one after another; with
+// -o each file is written to its own .json file in the given directory,
+// named after it, and files with the same name in different directories
+// are refused rather than written over each other.
+// The encoding of each document is detected from its byte order mark or
+// meta elements unless -charset names it. With -stream the json is written
+// while the document is read, which keeps memory use low for very large
+// documents but cannot be indented. With -format=text or -format=markdown
+// the text of the document is written instead of json, to .txt or .md
+// files with -o, and with -format=csv its tables, to .csv files.
+//
+// The -max flags bound the documents converted; those that exceed them are
+// refused, or cut to them with -truncate, with a warning.
+//
+// With -http, html2json instead serves the same endpoints as the App Engine
+// application on the given address, within converter.DefaultLimits except
+// for those the -max flags set. Pages are fetched as allowed by
+// converter.DefaultFetchPolicy: public addresses only.
+package main
+
+import (
+	"charset"
+	"code.google.com/p/goweb/goweb"
+	"converter"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html2json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sanitize"
+	"strings"
+)
+
+var (
+	outDir    = flag.String("o", "", "write one .json file per input into this `dir` instead of stdout")
+	indent    = flag.Bool("indent", false, "indent the json output")
+	httpAddr  = flag.String("http", "", "serve the converter on `addr` instead of converting files")
+	schema    = flag.String("schema", "tag", "output `schema`, tag or compact")
+	format    = flag.String("format", "json", "output `format`, json, text, markdown or csv")
+	template  = flag.String("template", "", "shape the output with the extraction template in `file`")
+	encoding  = flag.String("charset", "", "decode the input from the encoding called `label` instead of detecting it")
+	stream    = flag.Bool("stream", false, "write the json while the document is read, for very large documents")
+	scripting = flag.Bool("scripting", true, "parse the content of noscript elements as text, as browsers with scripting do")
+	pruning   = flag.String("prune", "", "leave `list` out of the output: whitespace, collapse, comments, doctype, scripts or all")
+	base      = flag.String("base", "", "resolve relative URLs against `url`, the address of the documents")
+	clean     = flag.Bool("sanitize", false, "remove scripts, event handlers and other unsafe content with the default sanitize policy")
+)
+
+func init() {
+	flag.BoolVar(&opts.Positions, "positions", false, "add the source positions of nodes to the tag schema")
+	flag.BoolVar(&opts.Errors, "errors", false, "report the parse errors of the document along with it")
+	flag.BoolVar(&opts.Article, "article", false, "output the title, byline, date, lead image and main content of an article page")
+	flag.BoolVar(&opts.Metadata, "metadata", false, "output the title, meta elements, links, JSON-LD and microdata of the document")
+	flag.BoolVar(&opts.Resources, "resources", false, "output the links, images, scripts and other resources of the document with absolute URLs")
+	flag.BoolVar(&opts.AbsoluteURLs, "absolute", false, "rewrite the URL attributes of the document to absolute URLs")
+	flag.BoolVar(&opts.Tables, "tables", false, "output the headers and rows of the tables of the document")
+	flag.BoolVar(&opts.Fragment, "fragment", false, "convert a fragment of html to the list of its top-level nodes")
+	flag.StringVar(&opts.Context, "context", "", "parse fragments as the content of the element called `name`; implies -fragment")
+	flag.Var((*stringList)(&opts.Select), "select", "only output the subtrees matching the css `selector`; may be repeated")
+	flag.Var((*stringList)(&opts.XPath), "xpath", "only output the result of the xpath `expression`; may be repeated")
+	flag.Int64Var(&opts.Limits.Bytes, "maxbytes", 0, "refuse documents longer than `n` bytes; 0 is unlimited")
+	flag.IntVar(&opts.Limits.Depth, "maxdepth", 0, "refuse documents with elements nested in more than `n` others")
+	flag.IntVar(&opts.Limits.Nodes, "maxnodes", 0, "refuse documents with more than `n` nodes")
+	flag.IntVar(&opts.Limits.Attributes, "maxattrs", 0, "refuse elements with more than `n` attributes")
+	flag.BoolVar(&opts.Limits.Truncate, "truncate", false, "cut documents to the -max limits instead of refusing them")
+}
+
+// opts are the conversion options selected by the flags.
+var opts html2json.Options
+
+// forced is the encoding selected by -charset, if any.
+var forced *charset.Encoding
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: html2json [flags] [file|glob ...]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if *httpAddr != "" {
+		serve(*httpAddr)
+		return
+	}
+
+	inputs, err := expand(flag.Args())
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if opts.Schema, err = html2json.ParseSchema(*schema); err != nil {
+		fatal(err)
+	}
+
+	if opts.Format, err = html2json.ParseFormat(*format); err != nil {
+		fatal(err)
+	}
+
+	if *encoding != "" {
+		if forced = charset.Lookup(*encoding); forced == nil {
+			fatal(fmt.Errorf("unsupported encoding %q", *encoding))
+		}
+	}
+
+	if opts.Prune, err = html2json.ParsePruning(*pruning); err != nil {
+		fatal(err)
+	}
+
+	if *base != "" {
+		if opts.URL, err = url.Parse(*base); err != nil {
+			fatal(err)
+		}
+	}
+
+	opts.DisableScripting = !*scripting
+	opts.Fragment = opts.Fragment || opts.Context != ""
+
+	if *clean {
+		opts.Sanitize = sanitize.DefaultPolicy()
+	}
+
+	if *stream && *indent {
+		fatal(errors.New("-stream output cannot be indented"))
+	}
+
+	if *template != "" {
+		data, err := ioutil.ReadFile(*template)
+
+		if err != nil {
+			fatal(err)
+		}
+
+		if opts.Template, err = html2json.ParseTemplate(data); err != nil {
+			fatal(err)
+		}
+	}
+
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	if *outDir != "" {
+		if err := checkOutputs(inputs); err != nil {
+			fatal(err)
+		}
+	}
+
+	var failed bool
+
+	for _, name := range inputs {
+		if err := convertFile(name); err != nil {
+			fmt.Fprintf(os.Stderr, "html2json: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// serve runs the conversion service on addr with a net/http fetcher.
+func serve(addr string) {
+	var cv = &converter.Converter{
+		Fetcher: &converter.HTTPFetcher{},
+	}
+
+	// The -max flags given override the matching default limits only.
+	var limits = converter.DefaultLimits
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "maxbytes":
+			limits.Bytes = opts.Limits.Bytes
+		case "maxdepth":
+			limits.Depth = opts.Limits.Depth
+		case "maxnodes":
+			limits.Nodes = opts.Limits.Nodes
+		case "maxattrs":
+			limits.Attributes = opts.Limits.Attributes
+		case "truncate":
+			limits.Truncate = opts.Limits.Truncate
+		}
+	})
+
+	cv.Limits = &limits
+
+	cv.Map()
+	log.Fatal(goweb.ListenAndServe(addr))
+}
+
+// expand resolves the glob patterns in args. Arguments without a match are
+// kept as they are so that opening them reports a sensible error.
+func expand(args []string) ([]string, error) {
+	var names []string
+
+	for _, arg := range args {
+		if arg == "-" {
+			names = append(names, arg)
+			continue
+		}
+
+		matches, err := filepath.Glob(arg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matches) == 0 {
+			matches = []string{arg}
+		}
+
+		names = append(names, matches...)
+	}
+
+	return names, nil
+}
+
+// convertFile converts the named file, or stdin for "-", and writes the
+// result to the output selected by the flags.
+func convertFile(name string) error {
+	var in io.Reader = os.Stdin
+
+	if name != "-" {
+		f, err := os.Open(name)
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		in = f
+	}
+
+	if forced != nil {
+		in = forced.NewDecoder(in)
+	} else {
+		var err error
+
+		if in, _, err = charset.NewReader(in, ""); err != nil {
+			return err
+		}
+	}
+
+	if *stream {
+		return output(name, func(w io.Writer) error {
+			return html2json.Stream(w, in, &opts)
+		})
+	}
+
+	res, err := html2json.Parse(in, &opts)
+
+	if err != nil {
+		return err
+	}
+
+	if res.Truncated != "" {
+		fmt.Fprintf(os.Stderr, "html2json: %s: truncated to the %s limit\n", name, res.Truncated)
+	}
+
+	if opts.Format != html2json.JSONFormat {
+		return output(name, func(w io.Writer) error {
+			return html2json.Write(w, res, &opts)
+		})
+	}
+
+	v, err := html2json.Result(res, &opts)
+
+	if err != nil {
+		return err
+	}
+
+	return output(name, func(w io.Writer) error {
+		return encode(w, v)
+	})
+}
+
+// output calls write with the destination of the output for name: stdout,
+// or its file in -o.
+func output(name string, write func(w io.Writer) error) error {
+	if *outDir == "" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(outputName(name))
+
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// extensions are the file extensions of the output formats.
+var extensions = map[html2json.Format]string{
+	html2json.JSONFormat:     ".json",
+	html2json.TextFormat:     ".txt",
+	html2json.MarkdownFormat: ".md",
+	html2json.CSVFormat:      ".csv",
+}
+
+// outputName returns the file in -o that the output for name is written
+// to.
+func outputName(name string) string {
+	if name == "-" {
+		name = "stdin"
+	}
+
+	base := filepath.Base(name)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+
+	return filepath.Join(*outDir, base+extensions[opts.Format])
+}
+
+// checkOutputs returns an error if two of inputs have the same output file
+// in -o, which would be written over.
+func checkOutputs(inputs []string) error {
+	var seen = make(map[string]string)
+
+	for _, name := range inputs {
+		var out = outputName(name)
+
+		if other, ok := seen[out]; ok {
+			return fmt.Errorf("%s and %s would both be written to %s", other, name, out)
+		}
+
+		seen[out] = name
+	}
+
+	return nil
+}
+
+func encode(w io.Writer, v interface{}) error {
+	if !*indent {
+		return json.NewEncoder(w).Encode(v)
+	}
+
+	b, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// A stringList is a flag.Value collecting every occurrence of a flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "html2json: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,44 @@
+//go:build appengine
+// +build appengine
+
+package converter
+
+import (
+	"code.google.com/p/goweb/goweb"
+	"net/http"
+
+	"appengine"
+	"appengine/urlfetch"
+)
+
+// appengineFetcher fetches documents through the App Engine urlfetch
+// service, which is the only way out of the sandbox, within
+// DefaultFetchPolicy.
+type appengineFetcher struct{}
+
+// Fetch gives the urlfetch service the timeout of req as its deadline,
+// which otherwise defaults to 5 seconds.
+func (appengineFetcher) Fetch(r *http.Request, req *FetchRequest) (*http.Response, error) {
+	var client = &http.Client{
+		Transport: &urlfetch.Transport{
+			Context:  appengine.NewContext(r),
+			Deadline: req.timeout(),
+		},
+	}
+
+	return req.Do(DefaultFetchPolicy.Client(client))
+}
+
+func logAppengine(r *http.Request, format string, args ...interface{}) {
+	appengine.NewContext(r).Errorf(format, args...)
+}
+
+func init() {
+	var cv = &Converter{
+		Fetcher: appengineFetcher{},
+		Logf:    logAppengine,
+	}
+
+	cv.Map()
+	http.Handle("/", goweb.DefaultHttpHandler)
+}
@@ -0,0 +1,894 @@
+// Package converter serves the html2json conversion over http using goweb.
+//
+// The package does not depend on App Engine. When built for App Engine it
+// registers itself with the urlfetch service; anywhere else, map a Converter
+// with an HTTPFetcher and serve goweb.DefaultHttpHandler.
+package converter
+
+import (
+	"bytes"
+	"charset"
+	"code.google.com/p/goweb/goweb"
+	"encoding/json"
+	"errors"
+	"exp/html"
+	"fmt"
+	"html2json"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sanitize"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EncodingHeader is the response header naming the encoding the converted
+// document was decoded from, such as "UTF-8" or "windows-1252".
+const EncodingHeader = "X-Html2json-Encoding"
+
+// ModeHeader is the response header naming the document mode that the
+// doctype of the converted document selected: "no-quirks", "limited-quirks"
+// or "quirks". Streamed documents are not parsed and have none.
+const ModeHeader = "X-Html2json-Mode"
+
+// TruncatedHeader is the response header naming the limit, such as
+// "nodes", that the converted document was cut to when the request asks
+// for truncated results with ?truncate=true.
+const TruncatedHeader = "X-Html2json-Truncated"
+
+// DefaultLimits are the limits of a Converter without its own: documents
+// and request bodies of up to 32 MiB, with up to a million nodes, nested
+// in up to 512 elements, as in browsers, with up to 256 attributes each.
+var DefaultLimits = html2json.Limits{
+	Bytes:      32 << 20,
+	Depth:      512,
+	Nodes:      1 << 20,
+	Attributes: 256,
+}
+
+var (
+	errNoFile     = errors.New("multipart request does not contain a file")
+	errNoTemplate = errors.New("extract request does not contain a template")
+	errFetchJSON  = errors.New("json fetch requests cannot be streamed or answered with text formats")
+)
+
+// A Converter holds the dependencies of the conversion endpoints.
+type Converter struct {
+	// Fetcher retrieves the documents for url requests.
+	Fetcher Fetcher
+	// Logf reports errors that occurred while serving r. If nil, errors
+	// are written to the standard logger.
+	Logf func(r *http.Request, format string, args ...interface{})
+	// Limits bound the documents the converter reads, posted or fetched,
+	// and the bodies of requests. If nil, DefaultLimits apply.
+	Limits *html2json.Limits
+	// FetchLimits cap the timeouts, redirects, headers and bodies of the
+	// fetches requests ask for. If nil, DefaultFetchLimits apply.
+	FetchLimits *FetchLimits
+}
+
+// formatters configures goweb's default formatters once, however many
+// converters are mapped.
+var formatters sync.Once
+
+// Map registers the conversion endpoints with goweb's default route
+// manager, and goweb's default formatters, through which errors are
+// reported.
+func (cv *Converter) Map() {
+	formatters.Do(goweb.ConfigureDefaultFormatters)
+	goweb.MapFunc("/convert", cv.convert, goweb.PostMethod)
+	goweb.MapFunc("/fragment", cv.fragment, goweb.PostMethod)
+	goweb.MapFunc("/fetch", cv.fetch, goweb.PostMethod)
+	goweb.MapFunc("/render", cv.render, goweb.PostMethod)
+	goweb.MapFunc("/extract", cv.extract, goweb.PostMethod)
+	goweb.MapFunc("/metadata", cv.metadata, goweb.PostMethod)
+	goweb.MapFunc("/", home, goweb.GetMethod)
+	goweb.MapFunc("/", cv.post, goweb.PostMethod)
+}
+
+func home(c *goweb.Context) {
+	fmt.Fprint(c.ResponseWriter, `
+Post an url to this address to get back its json representation.
+Post a document with Content-Type text/html, or upload it as a
+multipart/form-data file, to convert it directly.
+
+    POST /fetch      the body is an url to fetch and convert, or a json
+                     fetch request, see below
+    POST /convert    the body is the html document to convert
+    POST /fragment   the body is a fragment of html, such as <li>a<li>b,
+                     converted to the list of its top-level nodes; add
+                     ?context=ul to parse it as the content of that element
+    POST /render     the body is json in either schema, a node or a list of
+                     them as /fragment returns, turned back into html
+    POST /extract    the body is {"url": ..., "template": {...}}, or has the
+                     document in "html" instead of "url"; the template maps
+                     field names to selectors, see package html2json
+    POST /metadata   the body is an url or a document, as for /; the output
+                     is its title, meta elements, canonical, alternate and
+                     icon links, JSON-LD and microdata or RDFa items
+
+Add ?schema=compact for a smaller output with named node types,
+attributes as an object and text nodes as plain strings.
+
+Add one or more ?select=css-selector or ?xpath=expression parameters
+to get back only the matching subtrees, as an object keyed by query.
+XPath expressions can also select attribute values or compute strings,
+numbers and booleans.
+
+Documents are decoded to UTF-8 from the encoding declared by their
+Content-Type, byte order mark or meta elements. The encoding used is
+reported in the X-Html2json-Encoding header of the response.
+
+Add ?stream=true to have very large documents converted as they are read,
+without building the whole tree first. The parser's fixes to the document
+structure, such as the implied html, head and body elements, are skipped.
+
+Add ?prune=whitespace,comments to leave the indentation between elements
+and the comments out of the output. Other names are collapse, to replace
+runs of white space in text by a single space, doctype, scripts, to empty
+script and style elements, and all. White space that separates inline
+elements and the content of pre and textarea elements are kept. Pruning
+also applies to streamed documents.
+
+Documents longer than the limits of the service, or with too many nodes,
+too deep a nesting or too many attributes on an element, are refused with
+a 413 or 422 status. Add ?truncate=true to get what fits instead: the
+limit reached is then named in the X-Html2json-Truncated header.
+
+Add ?positions=true to have each node of the tag schema located in the
+document by its Start and End, with a byte offset into the UTF-8 decoded
+document, a line and a column counted in characters.
+
+Add ?errors=true to lint the document: the output becomes an object with
+the converted "Document", its "Mode" and the "Errors" the parser recovered
+from, each with the html5lib error Code, the tag name as Data and its
+position as Pos.
+
+Add ?article=true to get only the main content of an article page, without
+its navigation, advertisements, comments and footers, as an object with
+the "Title", "Byline", "Published" date and lead "Image" of the article
+and its "Content".
+
+Add ?metadata=true to any endpoint, or post to /metadata, to get the
+metadata of the document instead: its "Title", named "Meta" elements,
+"OpenGraph" and "Twitter" properties, "Canonical" url, "Alternates" and
+"Icons" links, parsed "JSONLD" scripts and microdata or RDFa "Items".
+
+Add ?resources=true to get the links, images, scripts, stylesheets, icons,
+frames, media, objects and form actions of the document instead, each
+with its absolute "URL", its "Kind", and the "Element" and "Attr" that
+first refer to it. Add ?absolute=true to rewrite the href, src and other
+URL attributes of the output to absolute URLs. Relative URLs are resolved
+against the <base href> of the document and the url it was fetched from,
+after redirects; for posted documents, pass that url as ?base=url.
+
+Add ?tables=true to get the tables of the document instead, each with its
+"Caption", its "Headers" and its "Rows" of cell text, with the cells that
+span several rows or columns repeated in each, or ?format=csv to get them
+as CSV, separated by empty lines.
+
+Add ?format=text to get the text of the document instead of json, laid out
+in lines and paragraphs with list bullets and tab-separated table cells,
+or ?format=markdown to get it as Markdown with its links, images,
+emphasis, code blocks and tables. Both work with ?article=true, ?sanitize
+and /fragment, but not with queries, templates or ?errors=true.
+
+Add ?sanitize=true to remove scripts, event handlers, javascript: URLs,
+comments and all but a safe list of elements, attributes and CSS
+properties from the document before it is converted, its resources or
+tables are extracted, or it is rendered by /render. Links get
+rel="nofollow". It cannot be combined with ?metadata=true, which is read
+from the elements it removes. See package sanitize.
+
+Add ?scripting=false to parse the document as a browser without JavaScript
+would: the content of noscript elements is converted as markup instead of
+text. The document mode selected by the doctype, "no-quirks",
+"limited-quirks" or "quirks", is reported in the X-Html2json-Mode header.
+
+Post {"url": ..., "method": "POST", "headers": {...}, "body": ...,
+"timeout": seconds, "maxRedirects": n} with Content-Type application/json
+to /fetch, / or /metadata to send a custom method, headers and form body,
+or bound the time taken and the redirects followed. The output is then an
+object with the "Document", the final "URL" after the "Redirects", and
+the "Status" and "Header" of the response. The method is GET or POST,
+the timeout at most 30 seconds and the redirects at most 10 by default,
+as are the fields of /extract requests, whose output is left as is.
+
+Only http and https urls on ports 80 and 443 that resolve to public
+addresses are fetched, redirects included: loopback, private, link-local
+and other reserved addresses, such as 169.254.169.254, are refused.
+
+Errors are reported with an http status and the goweb response
+{"S": status, "D": error, "E": [message]}, wrapped in JSONP with
+?callback=name. The error holds the "Status", a "Message" and a "Code":
+invalid-request or invalid-url (400), blocked-url (403),
+upstream-unreachable or upstream-status (502, with the "URL" and
+"UpstreamStatus" of the page), timeout (504), too-large (413),
+limit-exceeded, parse-failure or no-content (422) and internal (500).
+
+Node types are enumerated as follows:
+
+    ErrorNode NodeType  = 0
+    TextNode            = 1
+    DocumentNode        = 2
+    ElementNode         = 3
+    CommentNode         = 4
+    DoctypeNode         = 5
+
+`)
+}
+
+// post dispatches on the Content-Type of the request: html documents and
+// file uploads are converted directly, anything else is treated as an url.
+func (cv *Converter) post(c *goweb.Context) {
+	if isDocument(c.Request) {
+		cv.convert(c)
+	} else {
+		cv.fetch(c)
+	}
+}
+
+// isDocument reports whether the body of r carries the html itself rather
+// than an url pointing to it.
+func isDocument(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "multipart/form-data":
+		return true
+	}
+
+	return false
+}
+
+// documentBody returns the html document carried by r and its Content-Type.
+// For multipart requests this is the first uploaded file, otherwise the
+// body itself, refused without reading it if its Content-Length exceeds
+// limits.
+func documentBody(r *http.Request, limits html2json.Limits) (io.Reader, string, error) {
+	var contentType = r.Header.Get("Content-Type")
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if mediaType != "multipart/form-data" {
+		if err := checkLength(r.ContentLength, limits); err != nil {
+			return nil, "", err
+		}
+
+		return r.Body, contentType, nil
+	}
+
+	mr, err := r.MultipartReader()
+
+	if err != nil {
+		return nil, "", invalidRequest(err)
+	}
+
+	for {
+		part, err := mr.NextPart()
+
+		if err == io.EOF {
+			return nil, "", invalidRequest(errNoFile)
+		}
+
+		if err != nil {
+			return nil, "", invalidRequest(err)
+		}
+
+		if part.FileName() != "" {
+			return part, part.Header.Get("Content-Type"), nil
+		}
+	}
+}
+
+func (cv *Converter) convert(c *goweb.Context) {
+	opts, err := cv.options(c.Request)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	body, contentType, err := documentBody(c.Request, opts.Limits)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	cv.write(c, body, contentType, opts, nil)
+}
+
+// fragment converts the fragment of html in the request, parsed as the
+// content of the element named by the context parameter, if any.
+func (cv *Converter) fragment(c *goweb.Context) {
+	opts, err := cv.options(c.Request)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	body, contentType, err := documentBody(c.Request, opts.Limits)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	opts.Fragment = true
+	opts.Context = c.Request.URL.Query().Get("context")
+	cv.write(c, body, contentType, opts, nil)
+}
+
+// fetch converts the document at the url in the request. Relative URLs in
+// it are resolved against the url it was fetched from, after redirects.
+func (cv *Converter) fetch(c *goweb.Context) {
+	opts, err := cv.options(c.Request)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	cv.fetchAndWrite(c, opts)
+}
+
+// fetchAndWrite converts the document described by the fetch request in c,
+// a plain url or a FetchRequest in json. The output for the latter is a
+// FetchResult, which only json can hold.
+func (cv *Converter) fetchAndWrite(c *goweb.Context, opts *html2json.Options) {
+	req, isJSON, err := fetchRequest(c.Request, opts.Limits)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	if isJSON && (streaming(c.Request) || opts.Format != html2json.JSONFormat) {
+		cv.handleError(c, invalidRequest(errFetchJSON))
+		return
+	}
+
+	resp, err := cv.get(c.Request, req, opts.Limits)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	defer resp.Body.Close()
+	opts.URL = responseURL(resp, req.URL)
+
+	var fetched *FetchResult
+
+	if isJSON {
+		fetched = fetchResult(resp, req.URL)
+	}
+
+	cv.write(c, resp.Body, resp.Header.Get("Content-Type"), opts, fetched)
+}
+
+// fetchRequest returns the FetchRequest in the body of r: the body itself
+// if r has Content-Type application/json, in which case isJSON is set, and
+// a FetchRequest for the url it holds otherwise.
+func fetchRequest(r *http.Request, limits html2json.Limits) (req *FetchRequest, isJSON bool, err error) {
+	body, err := readAll(r.Body, limits)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != "application/json" {
+		return &FetchRequest{URL: string(body)}, false, nil
+	}
+
+	req = new(FetchRequest)
+
+	if err := json.Unmarshal(body, req); err != nil {
+		return nil, false, invalidRequest(err)
+	}
+
+	return req, true, nil
+}
+
+// get fetches the document described by req on behalf of r. It fails
+// without fetching if the url of req is not an absolute http or https url
+// or req exceeds the FetchLimits of cv, and without reading the document
+// if it is served with a status other than 2xx or a Content-Length that
+// exceeds limits. The caller closes the body of the response.
+func (cv *Converter) get(r *http.Request, req *FetchRequest, limits html2json.Limits) (*http.Response, error) {
+	u, err := fetchURL(req.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var fetchLimits = DefaultFetchLimits
+
+	if cv.FetchLimits != nil {
+		fetchLimits = *cv.FetchLimits
+	}
+
+	if err := fetchLimits.apply(req); err != nil {
+		return nil, invalidRequest(err)
+	}
+
+	req.URL = u
+
+	resp, err := cv.Fetcher.Fetch(r, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, upstreamStatus(resp, responseURL(resp, u))
+	}
+
+	if err := checkLength(resp.ContentLength, limits); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// responseURL returns the URL that resp was fetched from, after redirects,
+// or rawurl if the Fetcher does not tell.
+func responseURL(resp *http.Response, rawurl string) *url.URL {
+	if resp.Request != nil && resp.Request.URL != nil {
+		return resp.Request.URL
+	}
+
+	u, _ := url.Parse(strings.TrimSpace(rawurl))
+
+	return u
+}
+
+// render turns a json document back into html, sanitized if the request
+// asks for it.
+func (cv *Converter) render(c *goweb.Context) {
+	body, err := readAll(c.Request.Body, cv.limits(c.Request))
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	nodes, err := html2json.DecodeNodes(bytes.NewReader(body))
+
+	if err != nil {
+		cv.handleError(c, parseFailure(err))
+		return
+	}
+
+	policy, err := sanitizePolicy(c.Request)
+
+	if err != nil {
+		cv.handleError(c, invalidRequest(err))
+		return
+	}
+
+	if policy != nil {
+		nodes = sanitizeNodes(policy, nodes)
+	}
+
+	// The html is rendered in full before it is sent, so that a tree that
+	// cannot be rendered, such as a void element with children, is refused
+	// rather than cut short.
+	var b bytes.Buffer
+
+	for _, n := range nodes {
+		if err := html.Render(&b, n); err != nil {
+			cv.handleError(c, parseFailure(err))
+			return
+		}
+	}
+
+	c.ResponseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if _, err := b.WriteTo(c.ResponseWriter); err != nil {
+		cv.logf(c.Request, "%v", err)
+	}
+}
+
+// sanitizeNodes sanitizes the trees rooted at nodes, which need not be
+// documents, and returns them. A document on its own is sanitized in
+// place; otherwise an element that is not allowed is replaced by what
+// remains of its content.
+func sanitizeNodes(policy *sanitize.Policy, nodes []*html.Node) []*html.Node {
+	if len(nodes) == 1 && nodes[0].Type == html.DocumentNode {
+		policy.Sanitize(nodes[0])
+		return nodes
+	}
+
+	return policy.SanitizeNodes(nodes)
+}
+
+// An extractRequest is the body of a POST to /extract.
+type extractRequest struct {
+	// The FetchRequest is made unless HTML carries the document itself.
+	FetchRequest
+	HTML     string
+	Template json.RawMessage
+}
+
+// extract applies the template of an extractRequest to its document.
+func (cv *Converter) extract(c *goweb.Context) {
+	var req extractRequest
+
+	opts, err := cv.options(c.Request)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	body, err := readAll(c.Request.Body, opts.Limits)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		cv.handleError(c, invalidRequest(err))
+		return
+	}
+
+	if len(req.Template) == 0 {
+		cv.handleError(c, invalidRequest(errNoTemplate))
+		return
+	}
+
+	if opts.Template, err = html2json.ParseTemplate(req.Template); err != nil {
+		cv.handleError(c, invalidRequest(err))
+		return
+	}
+
+	if req.URL == "" || req.HTML != "" {
+		cv.write(c, strings.NewReader(req.HTML), "text/html; charset=utf-8", opts, nil)
+		return
+	}
+
+	resp, err := cv.get(c.Request, &req.FetchRequest, opts.Limits)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	defer resp.Body.Close()
+	opts.URL = responseURL(resp, req.URL)
+	cv.write(c, resp.Body, resp.Header.Get("Content-Type"), opts, nil)
+}
+
+// metadata writes the Metadata of the document in the request, or of the
+// document at the url it carries.
+func (cv *Converter) metadata(c *goweb.Context) {
+	opts, err := cv.options(c.Request)
+
+	if err != nil {
+		cv.handleError(c, err)
+		return
+	}
+
+	opts.Metadata = true
+
+	if isDocument(c.Request) {
+		body, contentType, err := documentBody(c.Request, opts.Limits)
+
+		if err != nil {
+			cv.handleError(c, err)
+			return
+		}
+
+		cv.write(c, body, contentType, opts, nil)
+		return
+	}
+
+	cv.fetchAndWrite(c, opts)
+}
+
+// options returns the conversion options selected by the query parameters
+// of r, within the limits of cv. Invalid parameters make the request
+// invalid.
+func (cv *Converter) options(r *http.Request) (*html2json.Options, error) {
+	opts, err := cv.parseOptions(r)
+
+	if err != nil {
+		return nil, invalidRequest(err)
+	}
+
+	return opts, nil
+}
+
+func (cv *Converter) parseOptions(r *http.Request) (*html2json.Options, error) {
+	var query = r.URL.Query()
+
+	schema, err := html2json.ParseSchema(query.Get("schema"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := html2json.ParseFormat(query.Get("format"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	prune, err := html2json.ParsePruning(query["prune"]...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	positions, _ := strconv.ParseBool(query.Get("positions"))
+	parseErrors, _ := strconv.ParseBool(query.Get("errors"))
+	article, _ := strconv.ParseBool(query.Get("article"))
+	meta, _ := strconv.ParseBool(query.Get("metadata"))
+	links, _ := strconv.ParseBool(query.Get("resources"))
+	absolute, _ := strconv.ParseBool(query.Get("absolute"))
+	tables, _ := strconv.ParseBool(query.Get("tables"))
+	page, err := baseURL(query.Get("base"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	scripting, err := parseScripting(query.Get("scripting"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := sanitizePolicy(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &html2json.Options{
+		Schema:           schema,
+		Select:           query["select"],
+		XPath:            query["xpath"],
+		Positions:        positions,
+		Errors:           parseErrors,
+		DisableScripting: !scripting,
+		Sanitize:         policy,
+		Article:          article,
+		Metadata:         meta,
+		URL:              page,
+		AbsoluteURLs:     absolute,
+		Resources:        links,
+		Tables:           tables,
+		Prune:            prune,
+		Format:           format,
+		Limits:           cv.limits(r),
+	}, nil
+}
+
+// limits returns the limits of cv, with Truncate set if r asks for
+// truncated results.
+func (cv *Converter) limits(r *http.Request) html2json.Limits {
+	var limits = DefaultLimits
+
+	if cv.Limits != nil {
+		limits = *cv.Limits
+	}
+
+	if truncate, _ := strconv.ParseBool(r.URL.Query().Get("truncate")); truncate {
+		limits.Truncate = true
+	}
+
+	return limits
+}
+
+// checkLength returns the LimitError for a body of the given length, as
+// declared by its Content-Length, that exceeds limits and cannot be
+// truncated, before it is read.
+func checkLength(length int64, limits html2json.Limits) error {
+	if limits.Bytes > 0 && length > limits.Bytes && !limits.Truncate {
+		return &html2json.LimitError{Limit: "bytes", Max: limits.Bytes}
+	}
+
+	return nil
+}
+
+// readAll reads r to the end, failing with a LimitError past the byte
+// limit of limits. It reads the bodies that are not documents, which are
+// never truncated.
+func readAll(r io.Reader, limits html2json.Limits) ([]byte, error) {
+	if limits.Bytes <= 0 {
+		return ioutil.ReadAll(r)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r, limits.Bytes+1))
+
+	if err == nil && int64(len(b)) > limits.Bytes {
+		return nil, &html2json.LimitError{Limit: "bytes", Max: limits.Bytes}
+	}
+
+	return b, err
+}
+
+// baseURL parses the base query parameter, the URL of a posted document.
+func baseURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("base url %q is not absolute", s)
+	}
+
+	return u, nil
+}
+
+// sanitizePolicy returns the policy selected by the sanitize query parameter
+// of r: sanitize.DefaultPolicy if it is true, nil otherwise.
+func sanitizePolicy(r *http.Request) (*sanitize.Policy, error) {
+	var s = r.URL.Query().Get("sanitize")
+
+	if s == "" {
+		return nil, nil
+	}
+
+	on, err := strconv.ParseBool(s)
+
+	if err != nil || !on {
+		return nil, err
+	}
+
+	return sanitize.DefaultPolicy(), nil
+}
+
+// parseScripting parses the scripting query parameter, which defaults to
+// true.
+func parseScripting(s string) (bool, error) {
+	if s == "" {
+		return true, nil
+	}
+
+	return strconv.ParseBool(s)
+}
+
+// write parses the html read from r and writes its json representation as
+// selected by opts, streaming it if the request asks for it. The document
+// is decoded to UTF-8 first, from the encoding its Content-Type or content
+// declares, which is reported in the EncodingHeader of the response. If
+// fetched is not nil, the json is that of fetched, with the result as its
+// Document.
+func (cv *Converter) write(c *goweb.Context, r io.Reader, contentType string, opts *html2json.Options, fetched *FetchResult) {
+	r, enc, err := charset.NewReader(r, contentType)
+
+	if err != nil {
+		cv.handleError(c, parseFailure(err))
+		return
+	}
+
+	c.ResponseWriter.Header().Set(EncodingHeader, enc.Name)
+
+	if streaming(c.Request) {
+		cv.stream(c, r, opts)
+		return
+	}
+
+	res, err := html2json.Parse(r, opts)
+
+	if err != nil {
+		cv.handleError(c, parseFailure(err))
+		return
+	}
+
+	c.ResponseWriter.Header().Set(ModeHeader, res.Mode.String())
+
+	if res.Truncated != "" {
+		c.ResponseWriter.Header().Set(TruncatedHeader, res.Truncated)
+	}
+
+	if opts.Format != html2json.JSONFormat {
+		cv.writeText(c, res, opts)
+		return
+	}
+
+	v, err := html2json.Result(res, opts)
+
+	if err != nil {
+		cv.handleError(c, resultError(err))
+		return
+	}
+
+	if fetched != nil {
+		fetched.Document = v
+		v = fetched
+	}
+
+	if err := json.NewEncoder(c.ResponseWriter).Encode(v); err != nil {
+		cv.handleError(c, err)
+		return
+	}
+}
+
+// writeText writes the document parsed into res in the text format, such
+// as Markdown or CSV, selected by opts.
+// The output is built before the Content-Type is set, so that errors are
+// still reported as json.
+func (cv *Converter) writeText(c *goweb.Context, res *html.ParseResult, opts *html2json.Options) {
+	var b bytes.Buffer
+
+	if err := html2json.Write(&b, res, opts); err != nil {
+		cv.handleError(c, resultError(err))
+		return
+	}
+
+	c.ResponseWriter.Header().Set("Content-Type", opts.Format.ContentType())
+
+	if _, err := b.WriteTo(c.ResponseWriter); err != nil {
+		cv.logf(c.Request, "%v", err)
+	}
+}
+
+// streaming reports whether r asks for the output to be streamed.
+func streaming(r *http.Request) bool {
+	stream, _ := strconv.ParseBool(r.URL.Query().Get("stream"))
+	return stream
+}
+
+// stream writes the json representation of the html read from r as it is
+// tokenized. Once output has started, errors can only be logged, as is a
+// document that exceeds the limits and ends the output early.
+func (cv *Converter) stream(c *goweb.Context, r io.Reader, opts *html2json.Options) {
+	var err = html2json.Stream(c.ResponseWriter, r, opts)
+
+	if err == html2json.ErrStreamQuery {
+		cv.handleError(c, invalidRequest(err))
+		return
+	}
+
+	if err != nil {
+		cv.logf(c.Request, "%v", err)
+	}
+}
+
+// handleError responds to the request in c with the Error that reports
+// err and its http status. The Error is the data of a goweb response, as
+// those of Context.RespondWithErrorMessage, so that the formatters of goweb
+// apply to it: a callback parameter, for one, wraps it in JSONP.
+func (cv *Converter) handleError(c *goweb.Context, err error) {
+	var e = errorValue(err)
+
+	cv.logf(c.Request, "%v", err)
+
+	if err := c.Respond(e, e.Status, []string{e.Message}, c); err != nil {
+		cv.logf(c.Request, "%v", err)
+	}
+}
+
+func (cv *Converter) logf(r *http.Request, format string, args ...interface{}) {
+	if cv.Logf != nil {
+		cv.Logf(r, format, args...)
+		return
+	}
+
+	log.Printf(format, args...)
+}
@@ -0,0 +1,1046 @@
+package converter
+
+import (
+	"bytes"
+	"code.google.com/p/goweb/goweb"
+	"encoding/json"
+	"exp/html"
+	"fmt"
+	"html2json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPage = `<!DOCTYPE html><title>test</title><p class="x">Hello</p>`
+
+var (
+	serverOnce sync.Once
+	serverURL  string
+)
+
+// testLimits are the limits of the test server.
+var testLimits = html2json.Limits{Bytes: 1 << 16, Depth: 64, Nodes: 1 << 12, Attributes: 16}
+
+// testPolicy is the fetch policy of the test server, which lets it reach
+// the stand-in upstreams on localhost.
+var testPolicy = FetchPolicy{AllowPrivate: true, DenyHosts: []string{"blocked.example"}}
+
+// testServer starts the converter, backed by an HTTPFetcher, behind a
+// goweb handler and returns its url. The routes are mapped only once since
+// goweb keeps them in a global route manager.
+func testServer() string {
+	serverOnce.Do(func() {
+		var cv = &Converter{
+			Fetcher: &HTTPFetcher{Policy: &testPolicy},
+			Logf:    func(*http.Request, string, ...interface{}) {},
+			Limits:  &testLimits,
+		}
+
+		cv.Map()
+		serverURL = httptest.NewServer(goweb.DefaultHttpHandler).URL
+	})
+
+	return serverURL
+}
+
+// upstream starts a stand-in for the site whose pages are fetched.
+func upstream(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, body)
+	}))
+}
+
+func postTag(t *testing.T, path, contentType string, body io.Reader) *html2json.Tag {
+	resp, err := http.Post(testServer()+path, contentType, body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var tag html2json.Tag
+
+	if err := json.NewDecoder(resp.Body).Decode(&tag); err != nil {
+		t.Fatal(err)
+	}
+
+	return &tag
+}
+
+// findElement returns the first element named data in depth-first order.
+func findElement(t *html2json.Tag, data string) *html2json.Tag {
+	if t.Type == html.ElementNode && t.Data == data {
+		return t
+	}
+
+	for _, child := range t.Children {
+		if found := findElement(child, data); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+func checkPage(t *testing.T, name string, tag *html2json.Tag) {
+	p := findElement(tag, "p")
+
+	if p == nil {
+		t.Fatalf("%s: no <p> in %+v", name, tag)
+	}
+
+	if len(p.Attributes) != 1 || p.Attributes[0].Key != "class" || p.Attributes[0].Val != "x" {
+		t.Errorf("%s: got attributes %v, want class=x", name, p.Attributes)
+	}
+
+	if len(p.Children) != 1 || p.Children[0].Data != "Hello" {
+		t.Errorf("%s: got children %v, want the text Hello", name, p.Children)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	up := upstream(testPage)
+	defer up.Close()
+
+	checkPage(t, "/fetch", postTag(t, "/fetch", "text/plain", strings.NewReader(up.URL)))
+	checkPage(t, "/", postTag(t, "/", "text/plain", strings.NewReader(up.URL)))
+}
+
+func TestConvert(t *testing.T) {
+	checkPage(t, "/convert", postTag(t, "/convert", "text/html", strings.NewReader(testPage)))
+	checkPage(t, "/", postTag(t, "/", "text/html; charset=utf-8", strings.NewReader(testPage)))
+}
+
+func TestFragment(t *testing.T) {
+	const fragment = `<b>a &amp; b</b></title>`
+
+	tests := []struct {
+		context string
+		want    string
+	}{
+		{"", `[{"type":"element","data":"b","children":["a & b"]}]`},
+		{"ul", `[{"type":"element","data":"b","children":["a & b"]}]`},
+		// Raw text and RCDATA contexts.
+		{"script", `["<b>a &amp; b</b></title>"]`},
+		{"style", `["<b>a &amp; b</b></title>"]`},
+		{"plaintext", `["<b>a &amp; b</b></title>"]`},
+		{"textarea", `["<b>a & b</b></title>"]`},
+		{"title", `["<b>a & b</b>"]`},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Post(testServer()+"/fragment?schema=compact&context="+test.context, "text/html", strings.NewReader(fragment))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got, want interface{}
+
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("context %q: got %v, want %s", test.context, got, test.want)
+		}
+	}
+}
+
+func TestConvertMultipart(t *testing.T) {
+	var b bytes.Buffer
+	var w = multipart.NewWriter(&b)
+
+	w.WriteField("comment", "not the document")
+	fw, err := w.CreateFormFile("file", "page.html")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(fw, testPage)
+	w.Close()
+
+	checkPage(t, "/", postTag(t, "/", w.FormDataContentType(), &b))
+}
+
+// postError posts body to path and returns the Error of the goweb response
+// and its status.
+func postError(t *testing.T, path, contentType, body string) (*html2json.Error, int) {
+	resp, err := http.Post(testServer()+path, contentType, strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var v struct {
+		S int
+		D *html2json.Error
+		E []string
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.D == nil {
+		t.Fatalf("%s: got no Error in %+v", path, v)
+	}
+
+	if v.S != resp.StatusCode || v.D.Status != resp.StatusCode || len(v.E) != 1 || v.E[0] != v.D.Message {
+		t.Errorf("%s: got status %d and %+v", path, resp.StatusCode, v)
+	}
+
+	return v.D, resp.StatusCode
+}
+
+func TestFetchError(t *testing.T) {
+	var mux = http.NewServeMux()
+
+	mux.HandleFunc("/missing", http.NotFound)
+
+	up := httptest.NewServer(mux)
+	defer up.Close()
+
+	closed := httptest.NewServer(mux)
+	closed.Close()
+
+	tests := []struct {
+		path, body string
+		status     int
+		code       string
+		url        string
+		upstream   int
+	}{
+		{"/fetch", "no-such-scheme://x", http.StatusBadRequest, CodeInvalidURL, "no-such-scheme://x", 0},
+		{"/fetch", "example.com/page", http.StatusBadRequest, CodeInvalidURL, "example.com/page", 0},
+		{"/fetch", up.URL + "/missing", http.StatusBadGateway, CodeUpstreamStatus, up.URL + "/missing", http.StatusNotFound},
+		{"/metadata", closed.URL + "/", http.StatusBadGateway, CodeUpstreamUnreachable, closed.URL + "/", 0},
+		{"/fetch", "http://blocked.example/", http.StatusForbidden, CodeBlockedURL, "http://blocked.example/", 0},
+		{"/fetch?schema=nested", up.URL, http.StatusBadRequest, CodeInvalidRequest, "", 0},
+		{"/extract", `{"html": "<p>"}`, http.StatusBadRequest, CodeInvalidRequest, "", 0},
+		{"/convert?metadata=true&sanitize=true", "<p>", http.StatusBadRequest, CodeInvalidRequest, "", 0},
+		{"/render", `{"Data": `, http.StatusUnprocessableEntity, CodeParseFailure, "", 0},
+		{"/render", `{"type":"element","data":"br","children":["x"]}`, http.StatusUnprocessableEntity, CodeParseFailure, "", 0},
+	}
+
+	for _, test := range tests {
+		e, status := postError(t, test.path, "text/plain", test.body)
+
+		if status != test.status || e.Code != test.code || e.URL != test.url || e.UpstreamStatus != test.upstream {
+			t.Errorf("%s %q: got status %d and %+v, want %d %s", test.path, test.body, status, e, test.status, test.code)
+		}
+	}
+}
+
+func TestFetchRequest(t *testing.T) {
+	var mux = http.NewServeMux()
+
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Upstream", "yes")
+		fmt.Fprintf(w, "<p>%s %s %s %s</p>", r.Method, r.Header.Get("Accept-Language"), r.Header.Get("Content-Type"), body)
+	})
+	mux.Handle("/redirect", http.RedirectHandler("/echo", http.StatusFound))
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	up := httptest.NewServer(mux)
+	defer up.Close()
+
+	var body = fmt.Sprintf(`{"url": %q, "method": "post", "headers": {"Accept-Language": "fr"}, "body": "a=1", "maxRedirects": 1}`, up.URL+"/redirect")
+
+	resp, err := http.Post(testServer()+"/fetch?schema=compact", "application/json", strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var res FetchResult
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	var want = FetchResult{
+		URL:       up.URL + "/echo",
+		Redirects: []string{up.URL + "/redirect"},
+		Status:    http.StatusOK,
+	}
+
+	if res.URL != want.URL || !reflect.DeepEqual(res.Redirects, want.Redirects) || res.Status != want.Status || res.Header.Get("X-Upstream") != "yes" {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+
+	// The redirect is followed with GET, without the body.
+	if got := fmt.Sprint(res.Document); !strings.Contains(got, "GET fr") || strings.Contains(got, "a=1") {
+		t.Errorf("got document %s, want the echo of a GET in French", got)
+	}
+
+	resp, err = http.Post(testServer()+"/fetch?schema=compact", "application/json", strings.NewReader(fmt.Sprintf(`{"url": %q, "method": "POST", "body": "a=1"}`, up.URL+"/echo")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = FetchResult{}
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(fmt.Sprint(res.Document), "POST  application/x-www-form-urlencoded a=1") || len(res.Redirects) != 0 {
+		t.Errorf("got %+v, want the echo of a posted form", res)
+	}
+
+	tests := []struct {
+		path, body string
+		status     int
+		code       string
+	}{
+		{"/fetch", `{"url": %q, "method": "PUT"}`, http.StatusBadRequest, CodeInvalidRequest},
+		{"/fetch", `{"url": %q, "body": "a=1"}`, http.StatusBadRequest, CodeInvalidRequest},
+		{"/fetch", `{"url": %q, "headers": {"Host": "example.com"}}`, http.StatusBadRequest, CodeInvalidRequest},
+		{"/fetch", `{"url": %q, "timeout": 60}`, http.StatusBadRequest, CodeInvalidRequest},
+		{"/fetch", `{"url": %q, "maxRedirects": 11}`, http.StatusBadRequest, CodeInvalidRequest},
+		{"/fetch?stream=true", `{"url": %q}`, http.StatusBadRequest, CodeInvalidRequest},
+		{"/metadata", `{"url": %q, "maxRedirects": 0}`, http.StatusBadGateway, CodeUpstreamStatus},
+		{"/extract", `{"url": %q, "timeout": 0.05, "template": {"p": "p"}}`, http.StatusGatewayTimeout, CodeTimeout},
+	}
+
+	for i, test := range tests {
+		var u = up.URL + "/redirect"
+
+		if i == len(tests)-1 {
+			u = up.URL + "/slow"
+		}
+
+		body := fmt.Sprintf(test.body, u)
+		e, status := postError(t, test.path, "application/json", body)
+
+		if status != test.status || e.Code != test.code {
+			t.Errorf("%s %s: got status %d and %+v, want %d %s", test.path, body, status, e, test.status, test.code)
+		}
+	}
+}
+
+func TestErrorJSONP(t *testing.T) {
+	resp, err := http.Post(testServer()+"/fetch?callback=cb", "text/plain", strings.NewReader("x"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest || !strings.HasPrefix(string(b), "cb({") || !strings.Contains(string(b), CodeInvalidURL) {
+		t.Errorf("got status %d and %s, want a JSONP error", resp.StatusCode, b)
+	}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorValue(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{&url.Error{Op: "Get", URL: "http://x/", Err: timeoutError{}}, http.StatusGatewayTimeout, CodeTimeout},
+		{parseFailure(timeoutError{}), http.StatusGatewayTimeout, CodeTimeout},
+		{parseFailure(&html2json.LimitError{Limit: "bytes"}), http.StatusRequestEntityTooLarge, CodeTooLarge},
+		{parseFailure(&html2json.LimitError{Limit: "nodes"}), http.StatusUnprocessableEntity, CodeLimitExceeded},
+		{parseFailure(io.ErrUnexpectedEOF), http.StatusUnprocessableEntity, CodeParseFailure},
+		{&url.Error{Op: "Get", URL: "http://x/", Err: io.EOF}, http.StatusBadGateway, CodeUpstreamUnreachable},
+		{io.ErrShortWrite, http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, test := range tests {
+		e := errorValue(test.err)
+
+		if e.Status != test.status || e.Code != test.code || e.Error != http.StatusText(test.status) {
+			t.Errorf("%v: got %+v, want %d %s", test.err, e, test.status, test.code)
+		}
+	}
+}
+
+func ExampleConverter() {
+	var cv = &Converter{
+		Fetcher: &HTTPFetcher{},
+	}
+
+	cv.Map()
+	fmt.Println(goweb.ListenAndServe(":8080"))
+}
+
+func TestConvertCompact(t *testing.T) {
+	resp, err := http.Post(testServer()+"/convert?schema=compact", "text/html", strings.NewReader(`<p class="x">Hello</p>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var doc html2json.Compact
+
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Type != "document" || len(doc.Children) != 1 {
+		t.Errorf("got %+v, want a document with one child", doc)
+	}
+}
+
+func TestConvertStream(t *testing.T) {
+	resp, err := http.Post(testServer()+"/convert?schema=compact&stream=true", "text/html", strings.NewReader(`<p class="x">Hello<p>World`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var doc html2json.Compact
+
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the parser there is no html or body element around the
+	// paragraphs.
+	if doc.Type != "document" || len(doc.Children) != 2 {
+		t.Errorf("got %+v, want a document with two paragraphs", doc)
+	}
+}
+
+func TestConvertPositions(t *testing.T) {
+	resp, err := http.Post(testServer()+"/convert?positions=true&select=p", "text/html", strings.NewReader("<div>\n  <p>Hello</p>\n</div>"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var result map[string][]html2json.Tag
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	var p = result["p"]
+
+	if len(p) != 1 || p[0].Start == nil || p[0].End == nil {
+		t.Fatalf("got %+v, want one located paragraph", result)
+	}
+
+	if p[0].Start.String() != "2:3" || p[0].End.String() != "2:15" || p[0].Start.Offset != 8 {
+		t.Errorf("got %v (offset %d) to %v, want 2:3 (offset 8) to 2:15", p[0].Start, p[0].Start.Offset, p[0].End)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	resp, err := http.Post(testServer()+"/convert?errors=true&schema=compact", "text/html", strings.NewReader("<p>a</b>"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var report struct {
+		Document html2json.Compact
+		Errors   []html.ParseError
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Document.Type != "document" {
+		t.Errorf("got document %+v, want the converted document", report.Document)
+	}
+
+	var codes []string
+
+	for _, e := range report.Errors {
+		codes = append(codes, e.Code)
+	}
+
+	if got := strings.Join(codes, " "); got != "expected-doctype-but-got-start-tag unexpected-end-tag" {
+		t.Errorf("got errors %q", got)
+	}
+}
+
+func TestConvertScripting(t *testing.T) {
+	const page = `<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN">` +
+		`<body><noscript><a href="/plain">plain</a></noscript>`
+
+	for _, scripting := range []bool{true, false} {
+		resp, err := http.Post(testServer()+"/convert?select=noscript>a&scripting="+strconv.FormatBool(scripting), "text/html", strings.NewReader(page))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result map[string][]html2json.Tag
+
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// With scripting, the content of the noscript element is text.
+		if got := len(result["noscript>a"]); (got == 0) != scripting {
+			t.Errorf("scripting=%t: got %d links in noscript", scripting, got)
+		}
+
+		if mode := resp.Header.Get(ModeHeader); mode != "quirks" {
+			t.Errorf("got mode %q, want quirks", mode)
+		}
+	}
+}
+
+func TestConvertCharset(t *testing.T) {
+	tests := []struct {
+		contentType, body, want, encoding string
+	}{
+		{"text/html; charset=Shift_JIS", "<p>\x93\xFA\x96\x7B</p>", "日本", "Shift_JIS"},
+		{"text/html", "<meta charset=iso-8859-1><p>caf\xE9</p>", "café", "windows-1252"},
+		{"text/html", "<p>caf\xC3\xA9</p>", "café", "UTF-8"},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Post(testServer()+"/convert?xpath=string(//p)", test.contentType, strings.NewReader(test.body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result map[string]string
+
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := result["string(//p)"]; got != test.want {
+			t.Errorf("%q: got %q, want %q", test.body, got, test.want)
+		}
+
+		if got := resp.Header.Get(EncodingHeader); got != test.encoding {
+			t.Errorf("%q: got encoding %q, want %q", test.body, got, test.encoding)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	const doc = `{"type":"document","children":[{"type":"element","data":"p","attributes":{"class":"x"},"children":["a < b"]}]}`
+
+	resp, err := http.Post(testServer()+"/render", "application/json", strings.NewReader(doc))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `<p class="x">a &lt; b</p>`; string(b) != want {
+		t.Errorf("got %q, want %q", b, want)
+	}
+
+	const fragment = `[{"type":"element","data":"li","children":["a"]},{"type":"element","data":"li","children":["b"]}]`
+
+	resp, err = http.Post(testServer()+"/render", "application/json", strings.NewReader(fragment))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	if b, err = ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `<li>a</li><li>b</li>`; string(b) != want {
+		t.Errorf("got %q, want %q", b, want)
+	}
+}
+
+func TestConvertArticle(t *testing.T) {
+	const page = `<!DOCTYPE html><title>A Day at the Coast | Example</title>` +
+		`<ul class="menu"><li><a href="/">Home</a></li></ul>` +
+		`<div class="post"><p class="byline">By Ann</p>` +
+		`<p>We walked along the beach, past the rocks and the old lighthouse, until the tide came in.</p>` +
+		`<p><img src="/coast.jpg">The sea was grey, the wind was strong, and the gulls were loud.</p></div>` +
+		`<div class="footer">Example</div>`
+
+	resp, err := http.Post(testServer()+"/convert?article=true&schema=compact", "text/html", strings.NewReader(page))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var article struct {
+		html2json.Article
+		Content html2json.Compact
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&article); err != nil {
+		t.Fatal(err)
+	}
+
+	if article.Title != "A Day at the Coast" || article.Byline != "By Ann" || article.Image != "/coast.jpg" {
+		t.Errorf("got %+v", article.Article)
+	}
+
+	if len(article.Content.Children) != 1 || len(article.Content.Children[0].(map[string]interface{})["children"].([]interface{})) != 2 {
+		t.Errorf("got content %+v, want the div with two paragraphs", article.Content)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	resp, err := http.Post(testServer()+"/fragment?sanitize=true&schema=compact", "text/html",
+		strings.NewReader(`<p onclick="x()">a<script>b</script><a href="javascript:c">d</a></p>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got interface{}
+
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want interface{}
+
+	json.Unmarshal([]byte(`[{"type":"element","data":"p","children":["a",{"type":"element","data":"a","children":["d"]}]}]`), &want)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	const doc = `{"type":"element","data":"DIV","attributes":{"onclick":"x()"},"children":[{"type":"element","data":"script","children":["y()"]},"z"]}`
+
+	resp, err = http.Post(testServer()+"/render?sanitize=true", "application/json", strings.NewReader(doc))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `<div>z</div>`; string(b) != want {
+		t.Errorf("got %q, want %q", b, want)
+	}
+}
+
+func TestConvertFormat(t *testing.T) {
+	const page = `<!DOCTYPE html><h1>Title</h1><ul><li>a<li><a href="/b">b</a></ul>` +
+		`<table><tr><th>x<th>y<tr><td>1<td>2</table>`
+
+	for _, test := range []struct {
+		format, contentType, want string
+	}{
+		{"text", "text/plain; charset=utf-8", "Title\n\n* a\n* b\n\nx\ty\n1\t2\n"},
+		{"markdown", "text/markdown; charset=utf-8", "# Title\n\n- a\n- [b](/b)\n\n| x | y |\n| --- | --- |\n| 1 | 2 |\n"},
+	} {
+		resp, err := http.Post(testServer()+"/convert?format="+test.format, "text/html", strings.NewReader(page))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := resp.Header.Get("Content-Type"); got != test.contentType {
+			t.Errorf("%s: got Content-Type %q, want %q", test.format, got, test.contentType)
+		}
+
+		if string(b) != test.want {
+			t.Errorf("%s: got %q, want %q", test.format, b, test.want)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	const page = `<title>t</title><meta property="og:title" content="o">` +
+		`<script type="application/ld+json">{"@type": "Thing"}</script>` +
+		`<p itemscope itemtype="https://schema.org/Thing"><span itemprop="name">n</span></p>`
+
+	up := upstream(page)
+	defer up.Close()
+
+	for _, test := range []struct {
+		path, contentType, body string
+	}{
+		{"/metadata", "text/html", page},
+		{"/metadata", "text/plain", up.URL},
+		{"/convert?metadata=true", "text/html", page},
+	} {
+		resp, err := http.Post(testServer()+test.path, test.contentType, strings.NewReader(test.body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got interface{}
+
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var want interface{}
+
+		json.Unmarshal([]byte(`{"Title":"t","OpenGraph":{"og:title":["o"]},"JSONLD":[{"@type":"Thing"}],`+
+			`"Items":[{"Type":["https://schema.org/Thing"],"Properties":{"name":["n"]}}]}`), &want)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s %s: got %v, want %v", test.path, test.contentType, got, want)
+		}
+	}
+}
+
+func TestResources(t *testing.T) {
+	const page = `<a href="x.html">x</a><img src="/i.png"><script src="s.js"></script><a href="x.html">again</a>`
+
+	var mux = http.NewServeMux()
+
+	mux.Handle("/old", http.RedirectHandler("/new/page", http.StatusMovedPermanently))
+	mux.HandleFunc("/new/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, page)
+	})
+
+	up := httptest.NewServer(mux)
+	defer up.Close()
+
+	resp, err := http.Post(testServer()+"/fetch?resources=true", "text/plain", strings.NewReader(up.URL+"/old"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []struct{ URL, Kind string }
+
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = []struct{ URL, Kind string }{
+		{up.URL + "/new/x.html", "link"},
+		{up.URL + "/i.png", "image"},
+		{up.URL + "/new/s.js", "script"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	resp, err = http.Post(testServer()+"/fetch?resources=true&sanitize=true", "text/plain", strings.NewReader(up.URL+"/old"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got = nil
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want = want[:2]; !reflect.DeepEqual(got, want) {
+		t.Errorf("sanitized: got %v, want %v", got, want)
+	}
+
+	tag := postTag(t, "/convert?absolute=true&base="+url.QueryEscape("http://example.com/a/b"), "text/html", strings.NewReader(page))
+
+	if a := findElement(tag, "a"); a == nil || a.Attributes[0].Val != "http://example.com/a/x.html" {
+		t.Errorf("got %+v, want an absolute href", a)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	var long = strings.Repeat("<p>a</p>", 1<<14)
+	var deep = strings.Repeat("<div>", 100)
+
+	// The upstream page has few nodes but is too long, without a
+	// Content-Length to refuse it by.
+	up := upstream(strings.Repeat("a", 1<<17))
+	defer up.Close()
+
+	tests := []struct {
+		path, contentType, body string
+		status                  int
+	}{
+		{"/convert", "text/html", long, http.StatusRequestEntityTooLarge},
+		{"/convert", "text/html", deep, http.StatusUnprocessableEntity},
+		{"/convert", "text/html", strings.Repeat("<p>", 1<<13), http.StatusUnprocessableEntity},
+		{"/convert", "text/html", "<p" + strings.Repeat(" a", 20) + ">", http.StatusUnprocessableEntity},
+		{"/fetch", "text/plain", up.URL, http.StatusRequestEntityTooLarge},
+		{"/render", "application/json", strings.Repeat(" ", 1<<17), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		e, status := postError(t, test.path, test.contentType, test.body)
+
+		if status != test.status || e.Error != http.StatusText(test.status) {
+			t.Errorf("%s %.20q: got status %d and %+v, want %d", test.path, test.body, status, e, test.status)
+		}
+	}
+
+	for _, body := range []string{long, deep} {
+		resp, err := http.Post(testServer()+"/convert?truncate=true&schema=compact", "text/html", strings.NewReader(body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var v interface{}
+
+		err = json.NewDecoder(resp.Body).Decode(&v)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK || resp.Header.Get(TruncatedHeader) == "" {
+			t.Errorf("%.20q: got status %d and %s %q, want a truncated result", body, resp.StatusCode, TruncatedHeader, resp.Header.Get(TruncatedHeader))
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	const page = `<table><caption>c</caption><thead><tr><th>a<th>b</thead><tr><td rowspan=2>1<td>2<tr><td>3</table>`
+
+	resp, err := http.Post(testServer()+"/convert?tables=true", "text/html", strings.NewReader(page))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got interface{}
+
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want interface{}
+
+	json.Unmarshal([]byte(`[{"Caption":"c","Headers":["a","b"],"Rows":[["1","2"],["1","3"]]}]`), &want)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	resp, err = http.Post(testServer()+"/convert?format=csv", "text/html", strings.NewReader(page))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+
+	if want := "a,b\n1,2\n1,3\n"; string(b) != want {
+		t.Errorf("got %q, want %q", b, want)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	var bodies []string
+
+	for _, page := range []string{"<ul>\n  <li>a<!-- b --></li>\n</ul>", "<ul><li>a</li></ul>"} {
+		resp, err := http.Post(testServer()+"/fragment?prune=whitespace,comments", "text/html", strings.NewReader(page))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bodies = append(bodies, string(b))
+	}
+
+	if bodies[0] != bodies[1] {
+		t.Errorf("got %s, want %s", bodies[0], bodies[1])
+	}
+
+	e, status := postError(t, "/fragment?prune=spaces", "text/html", "<p>")
+
+	if status != http.StatusBadRequest || !strings.Contains(e.Message, "unknown pruning") {
+		t.Errorf("got status %d and %+v for an unknown pruning", status, e)
+	}
+}
+
+func TestConvertSelect(t *testing.T) {
+	resp, err := http.Post(testServer()+"/convert?select=p.x&select=a", "text/html", strings.NewReader(testPage))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var result map[string][]*html2json.Tag
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 2 || len(result["a"]) != 0 || len(result["p.x"]) != 1 || result["p.x"][0].Data != "p" {
+		t.Errorf("got %v, want one p and no a", result)
+	}
+}
+
+func TestConvertXPath(t *testing.T) {
+	var query = url.Values{"xpath": {"//p/@class", "count(//p)"}}
+
+	resp, err := http.Post(testServer()+"/convert?"+query.Encode(), "text/html", strings.NewReader(testPage))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if classes, _ := result["//p/@class"].([]interface{}); len(classes) != 1 || classes[0] != "x" {
+		t.Errorf("got %v for //p/@class, want [x]", result["//p/@class"])
+	}
+
+	if result["count(//p)"] != 1.0 {
+		t.Errorf("got %v for count(//p), want 1", result["count(//p)"])
+	}
+}
+
+func TestExtract(t *testing.T) {
+	up := upstream(testPage)
+	defer up.Close()
+
+	for _, body := range []string{
+		`{"url": "` + up.URL + `", "template": {"title": "title", "class": {"selector": "p", "extract": "attr", "attr": "class"}}}`,
+		`{"html": ` + strconv.Quote(testPage) + `, "template": {"title": "title", "class": {"selector": "p", "extract": "attr", "attr": "class"}}}`,
+	} {
+		resp, err := http.Post(testServer()+"/extract", "application/json", strings.NewReader(body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result map[string]string
+
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result["title"] != "test" || result["class"] != "x" {
+			t.Errorf("got %v, want title test and class x", result)
+		}
+	}
+}
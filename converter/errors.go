@@ -0,0 +1,139 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"html2json"
+	"net"
+	"net/http"
+	"net/url"
+	"readability"
+	"strings"
+)
+
+// The codes of the errors the converter reports, in the Code field of the
+// html2json.Error it responds with, and their http status.
+const (
+	CodeInvalidRequest      = "invalid-request"      // 400: a bad parameter, body or template
+	CodeInvalidURL          = "invalid-url"          // 400: an url to fetch that is not absolute http or https
+	CodeBlockedURL          = "blocked-url"          // 403: an url, or an address it resolves to, that the fetch policy forbids
+	CodeUpstreamUnreachable = "upstream-unreachable" // 502: the host of the url could not be resolved or reached
+	CodeUpstreamStatus      = "upstream-status"      // 502: the document was served with a status other than 2xx
+	CodeTimeout             = "timeout"              // 504: fetching or reading the document took too long
+	CodeTooLarge            = "too-large"            // 413: the document or request exceeds the byte limit
+	CodeLimitExceeded       = "limit-exceeded"       // 422: the document exceeds the depth, node or attribute limits
+	CodeParseFailure        = "parse-failure"        // 422: the document could not be decoded or parsed
+	CodeNoContent           = "no-content"           // 422: the document holds no article
+	CodeInternal            = "internal"             // 500: anything else
+)
+
+// A failure is an error classified by the code and http status it is
+// reported with.
+type failure struct {
+	err    error
+	code   string
+	status int
+	// url and upstream are the address of a fetched document and the
+	// status it was served with, if they are why the request failed.
+	url      string
+	upstream int
+}
+
+func (f *failure) Error() string {
+	return f.err.Error()
+}
+
+func (f *failure) Unwrap() error {
+	return f.err
+}
+
+// invalidRequest classifies err as the fault of the request.
+func invalidRequest(err error) error {
+	return &failure{err: err, code: CodeInvalidRequest, status: http.StatusBadRequest}
+}
+
+// parseFailure classifies err as a failure to decode or parse a document.
+func parseFailure(err error) error {
+	return &failure{err: err, code: CodeParseFailure, status: http.StatusUnprocessableEntity}
+}
+
+// resultError classifies err, returned while laying out a document: a
+// document without an article or, since the rest are caused by queries,
+// templates and formats, an invalid request.
+func resultError(err error) error {
+	if errors.Is(err, readability.ErrNoContent) {
+		return &failure{err: err, code: CodeNoContent, status: http.StatusUnprocessableEntity}
+	}
+
+	return invalidRequest(err)
+}
+
+// upstreamStatus returns the failure of a document at u, served by resp
+// with a status other than 2xx.
+func upstreamStatus(resp *http.Response, u *url.URL) error {
+	return &failure{
+		err:      fmt.Errorf("%s responded %s", u, resp.Status),
+		code:     CodeUpstreamStatus,
+		status:   http.StatusBadGateway,
+		url:      u.String(),
+		upstream: resp.StatusCode,
+	}
+}
+
+// fetchURL returns rawurl, the address of a document to fetch, without the
+// white space around it, or an invalid-url failure if it is not an
+// absolute http or https url.
+func fetchURL(rawurl string) (string, error) {
+	rawurl = strings.TrimSpace(rawurl)
+
+	u, err := url.Parse(rawurl)
+
+	if err == nil && (u.Scheme != "http" && u.Scheme != "https" || u.Host == "") {
+		err = fmt.Errorf("%q is not an absolute http or https url", rawurl)
+	}
+
+	if err != nil {
+		return "", &failure{err: err, code: CodeInvalidURL, status: http.StatusBadRequest, url: rawurl}
+	}
+
+	return rawurl, nil
+}
+
+// errorValue returns the Error that reports err. Limits and timeouts are
+// told apart from the failures they cause, and errors of the Fetcher that
+// are not timeouts or refusals of its policy mean that the document could
+// not be reached.
+func errorValue(err error) *html2json.Error {
+	var limit *html2json.LimitError
+	var timeout net.Error
+	var f *failure
+	var blocked *PolicyError
+	var fetch *url.Error
+	var e *html2json.Error
+
+	switch {
+	case errors.As(err, &limit) && limit.Limit == "bytes":
+		e = html2json.NewError(limit.Status(), CodeTooLarge, err)
+	case limit != nil:
+		e = html2json.NewError(limit.Status(), CodeLimitExceeded, err)
+	case errors.As(err, &timeout) && timeout.Timeout():
+		e = html2json.NewError(http.StatusGatewayTimeout, CodeTimeout, err)
+	case errors.As(err, &blocked):
+		e = html2json.NewError(http.StatusForbidden, CodeBlockedURL, err)
+	case errors.As(err, &f):
+		e = html2json.NewError(f.status, f.code, err)
+		e.UpstreamStatus = f.upstream
+	case errors.As(err, &fetch):
+		e = html2json.NewError(http.StatusBadGateway, CodeUpstreamUnreachable, err)
+	default:
+		e = html2json.NewError(http.StatusInternalServerError, CodeInternal, err)
+	}
+
+	if errors.As(err, &f) && f.url != "" {
+		e.URL = f.url
+	} else if errors.As(err, &fetch) {
+		e.URL = fetch.URL
+	}
+
+	return e
+}
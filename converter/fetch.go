@@ -0,0 +1,245 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Fetcher retrieves the document described by req on behalf of the
+// incoming request r. Implementations exist for plain net/http and App
+// Engine.
+type Fetcher interface {
+	Fetch(r *http.Request, req *FetchRequest) (*http.Response, error)
+}
+
+// HTTPFetcher fetches documents with a standard net/http client.
+type HTTPFetcher struct {
+	// Client is the client used for fetching. If nil, http.DefaultClient
+	// is used.
+	Client *http.Client
+	// Policy decides which urls and addresses may be fetched, as applied
+	// by FetchPolicy.Client. If nil, DefaultFetchPolicy applies.
+	Policy *FetchPolicy
+
+	once   sync.Once
+	client *http.Client
+}
+
+func (f *HTTPFetcher) Fetch(r *http.Request, req *FetchRequest) (*http.Response, error) {
+	f.once.Do(func() {
+		var policy = f.Policy
+
+		if policy == nil {
+			policy = &DefaultFetchPolicy
+		}
+
+		f.client = policy.Client(f.Client)
+	})
+
+	return req.Do(f.client)
+}
+
+// A FetchRequest describes how to fetch a document. It is the body of a
+// fetch request with Content-Type application/json; a plain url is a
+// FetchRequest with only the URL set.
+type FetchRequest struct {
+	URL string
+	// Method is GET, the default, or POST, which sends Body, with
+	// Content-Type application/x-www-form-urlencoded unless Headers set
+	// another.
+	Method  string
+	Headers map[string]string
+	Body    string
+	// Timeout is the number of seconds after which fetching and reading
+	// the document is given up, and MaxRedirects the number of redirects
+	// followed, with 0 for none. Unset, the caps of the FetchLimits apply.
+	Timeout      float64
+	MaxRedirects *int
+}
+
+// Do sends req with client, within its timeout, and returns the response.
+// A redirect past MaxRedirects is returned as the response, leaving the
+// client's own CheckRedirect to judge the others.
+func (req *FetchRequest) Do(client *http.Client) (*http.Response, error) {
+	var method = req.Method
+
+	if method == "" {
+		method = "GET"
+	}
+
+	hr, err := http.NewRequest(method, req.URL, strings.NewReader(req.Body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if method == "POST" {
+		hr.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	for name, value := range req.Headers {
+		hr.Header.Set(name, value)
+	}
+
+	var c = *client
+
+	if t := req.timeout(); t > 0 {
+		c.Timeout = t
+	}
+
+	if req.MaxRedirects != nil {
+		var max, check = *req.MaxRedirects, client.CheckRedirect
+
+		c.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+			if len(via) > max {
+				return http.ErrUseLastResponse
+			}
+
+			if check != nil {
+				return check(next, via)
+			}
+
+			return nil
+		}
+	}
+
+	return c.Do(hr)
+}
+
+// timeout returns the Timeout of req as a duration.
+func (req *FetchRequest) timeout() time.Duration {
+	return time.Duration(req.Timeout * float64(time.Second))
+}
+
+// FetchLimits cap what a FetchRequest may ask for, so that the converter
+// cannot be made to hold connections open, follow endless redirects or
+// forward large requests. Zero Timeout, MaxHeaders and MaxBody fields are
+// unlimited.
+type FetchLimits struct {
+	// Timeout is the longest a fetch may take, and the timeout of those
+	// that do not set one.
+	Timeout time.Duration
+	// MaxRedirects is the most redirects a fetch may follow, and the
+	// number followed by those that do not set one.
+	MaxRedirects int
+	// MaxHeaders bounds the number of headers sent and MaxBody the length
+	// of the body.
+	MaxHeaders int
+	MaxBody    int64
+}
+
+// DefaultFetchLimits are the caps of a Converter without its own: fetches
+// of up to 30 seconds, following up to 10 redirects, as net/http does, and
+// sending up to 32 headers and 1 MiB of body.
+var DefaultFetchLimits = FetchLimits{
+	Timeout:      30 * time.Second,
+	MaxRedirects: 10,
+	MaxHeaders:   32,
+	MaxBody:      1 << 20,
+}
+
+// forbiddenHeaders are the headers a FetchRequest may not set, since the
+// client sets them itself or they concern the connection, not the request.
+var forbiddenHeaders = map[string]bool{
+	"Connection":          true,
+	"Content-Length":      true,
+	"Host":                true,
+	"Keep-Alive":          true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// apply checks req against l, filling in its method and the timeout and
+// redirects it leaves unset.
+func (l FetchLimits) apply(req *FetchRequest) error {
+	req.Method = strings.ToUpper(req.Method)
+
+	switch req.Method {
+	case "":
+		req.Method = "GET"
+	case "GET", "POST":
+	default:
+		return fmt.Errorf("method %q is not GET or POST", req.Method)
+	}
+
+	if req.Body != "" && req.Method != "POST" {
+		return errors.New("only POST requests have a body")
+	}
+
+	if l.MaxBody > 0 && int64(len(req.Body)) > l.MaxBody {
+		return fmt.Errorf("body exceeds the limit of %d bytes", l.MaxBody)
+	}
+
+	if l.MaxHeaders > 0 && len(req.Headers) > l.MaxHeaders {
+		return fmt.Errorf("more than %d headers", l.MaxHeaders)
+	}
+
+	for name, value := range req.Headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") || strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("invalid header %q", name)
+		}
+
+		if canonical := http.CanonicalHeaderKey(name); forbiddenHeaders[canonical] || strings.HasPrefix(canonical, "Proxy-") {
+			return fmt.Errorf("header %q cannot be set", name)
+		}
+	}
+
+	switch t := req.timeout(); {
+	case req.Timeout < 0:
+		return errors.New("negative timeout")
+	case t == 0:
+		req.Timeout = l.Timeout.Seconds()
+	case l.Timeout > 0 && t > l.Timeout:
+		return fmt.Errorf("timeout exceeds the limit of %v", l.Timeout)
+	}
+
+	switch {
+	case req.MaxRedirects == nil:
+		var max = l.MaxRedirects
+		req.MaxRedirects = &max
+	case *req.MaxRedirects < 0:
+		return errors.New("negative redirect limit")
+	case *req.MaxRedirects > l.MaxRedirects:
+		return fmt.Errorf("redirects exceed the limit of %d", l.MaxRedirects)
+	}
+
+	return nil
+}
+
+// A FetchResult is the output for a FetchRequest posted as json: the
+// converted Document along with how it was fetched.
+type FetchResult struct {
+	// URL is the address the document was fetched from, after Redirects,
+	// the addresses redirected from in order, and Status and Header are
+	// the status and headers it was served with.
+	URL       string
+	Redirects []string `json:",omitempty"`
+	Status    int
+	Header    http.Header
+	Document  interface{}
+}
+
+// fetchResult returns the FetchResult of the document served by resp,
+// without its Document.
+func fetchResult(resp *http.Response, rawurl string) *FetchResult {
+	var res = &FetchResult{
+		URL:    responseURL(resp, rawurl).String(),
+		Status: resp.StatusCode,
+		Header: resp.Header,
+	}
+
+	// Each request made for a redirect holds the response that caused it.
+	for r := resp.Request; r != nil && r.Response != nil && r.Response.Request != nil; r = r.Response.Request {
+		res.Redirects = append([]string{r.Response.Request.URL.String()}, res.Redirects...)
+	}
+
+	return res
+}
@@ -0,0 +1,279 @@
+package converter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A FetchPolicy decides which urls a Fetcher may fetch, so that the
+// converter cannot be made to reach the network it runs in, such as the
+// cloud metadata service at 169.254.169.254 or the services on localhost.
+// Redirects are held to it as well.
+type FetchPolicy struct {
+	// Schemes are the schemes allowed, http and https if empty.
+	Schemes []string
+	// AllowHosts, if not empty, are the only hosts that may be fetched, and
+	// DenyHosts hosts that may not be. A host matches the names equal to
+	// it, ignoring case, and their subdomains.
+	AllowHosts []string
+	DenyHosts  []string
+	// Ports are the ports allowed, any port if empty. Urls without one
+	// have the default port of their scheme.
+	Ports []int
+	// AllowPrivate allows the addresses that are not on the public
+	// internet: loopback, private, link-local, shared, multicast and other
+	// reserved ranges. Otherwise only those in AllowNetworks, given in
+	// CIDR notation such as "10.1.0.0/16", are allowed.
+	AllowPrivate  bool
+	AllowNetworks []string
+}
+
+// DefaultFetchPolicy is the policy of an HTTPFetcher without its own: http
+// and https urls on their default ports, at public addresses.
+var DefaultFetchPolicy = FetchPolicy{
+	Ports: []int{80, 443},
+}
+
+// A PolicyError reports an url or address that a FetchPolicy does not
+// allow.
+type PolicyError struct {
+	// Addr is the url, or the address an url resolved to, and Reason why
+	// it is not allowed.
+	Addr   string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("converter: fetch policy forbids %s: %s", e.Addr, e.Reason)
+}
+
+// reservedNetworks are the ranges, besides those told apart by the methods
+// of net.IP, that are not on the public internet or that translate to
+// addresses that may not be.
+var reservedNetworks = parseNetworks(
+	"0.0.0.0/8",       // this network
+	"100.64.0.0/10",   // shared address space
+	"192.0.0.0/24",    // protocol assignments
+	"192.0.2.0/24",    // documentation
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"240.0.0.0/4",     // reserved, and broadcast
+	"64:ff9b::/96",    // IPv4/IPv6 translation
+	"64:ff9b:1::/48",  // local IPv4/IPv6 translation
+	"2001:db8::/32",   // documentation
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var networks = make([]*net.IPNet, len(cidrs))
+
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+
+		if err != nil {
+			panic(err)
+		}
+
+		networks[i] = n
+	}
+
+	return networks
+}
+
+// CheckURL returns a *PolicyError if p does not allow the scheme, host or
+// port of u. Its addresses are checked once the host is resolved.
+func (p *FetchPolicy) CheckURL(u *url.URL) error {
+	var schemes = p.Schemes
+
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+
+	if !containsFold(schemes, u.Scheme) {
+		return &PolicyError{Addr: u.String(), Reason: fmt.Sprintf("scheme %q is not allowed", u.Scheme)}
+	}
+
+	var host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	if len(p.AllowHosts) > 0 && !matchHost(p.AllowHosts, host) || matchHost(p.DenyHosts, host) {
+		return &PolicyError{Addr: u.String(), Reason: fmt.Sprintf("host %q is not allowed", host)}
+	}
+
+	if len(p.Ports) == 0 {
+		return nil
+	}
+
+	var port = u.Port()
+
+	if port == "" {
+		port = defaultPort(u.Scheme)
+	}
+
+	for _, allowed := range p.Ports {
+		if port == strconv.Itoa(allowed) {
+			return nil
+		}
+	}
+
+	return &PolicyError{Addr: u.String(), Reason: fmt.Sprintf("port %s is not allowed", port)}
+}
+
+// CheckIP returns a *PolicyError if p does not allow ip, an address a host
+// resolved to.
+func (p *FetchPolicy) CheckIP(ip net.IP) error {
+	if p.AllowPrivate || isPublic(ip) {
+		return nil
+	}
+
+	for _, cidr := range p.AllowNetworks {
+		_, n, err := net.ParseCIDR(cidr)
+
+		if err != nil {
+			return err
+		}
+
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+
+	return &PolicyError{Addr: ip.String(), Reason: "address is not public"}
+}
+
+// isPublic reports whether ip is an address on the public internet.
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, n := range reservedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Client returns a copy of client, or of http.DefaultClient if nil, whose
+// requests, redirects included, are checked against p. Through an
+// *http.Transport, the addresses checked are those connected to, so that
+// a host cannot resolve to another address once checked; the transport is
+// copied, without its proxy, whose address would be checked instead. Other
+// transports, such as App Engine's, check the addresses the host resolves
+// to before each request.
+func (p *FetchPolicy) Client(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var c = *client
+	var rt = c.Transport
+
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	t, dials := rt.(*http.Transport)
+
+	if dials {
+		var d = &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   p.control,
+		}
+
+		t = t.Clone()
+		t.Proxy = nil
+		t.DialContext = d.DialContext
+		rt = t
+	}
+
+	c.Transport = &policyTransport{policy: p, rt: rt, resolve: !dials}
+
+	return &c
+}
+
+// control checks the address a connection is about to be made to.
+func (p *FetchPolicy) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	var ip = net.ParseIP(host)
+
+	if ip == nil {
+		return &PolicyError{Addr: address, Reason: "address is not an ip"}
+	}
+
+	return p.CheckIP(ip)
+}
+
+// A policyTransport checks the url of each request against policy before
+// rt sends it, and the addresses its host resolves to if resolve is set.
+type policyTransport struct {
+	policy  *FetchPolicy
+	rt      http.RoundTripper
+	resolve bool
+}
+
+func (t *policyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.policy.CheckURL(r.URL); err != nil {
+		return nil, err
+	}
+
+	if t.resolve {
+		addrs, err := net.DefaultResolver.LookupIPAddr(r.Context(), r.URL.Hostname())
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range addrs {
+			if err := t.policy.CheckIP(addr.IP); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return t.rt.RoundTrip(r)
+}
+
+// matchHost reports whether host is one of names or a subdomain of one.
+func matchHost(names []string, host string) bool {
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+		if host == name || strings.HasSuffix(host, "."+name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+
+	return "80"
+}
@@ -0,0 +1,178 @@
+package converter
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	var policy = &FetchPolicy{
+		Schemes:    []string{"https"},
+		AllowHosts: []string{"example.com", "example.org"},
+		DenyHosts:  []string{"private.example.com"},
+		Ports:      []int{443, 8443},
+	}
+
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.com/", true},
+		{"https://WWW.Example.com./a", true},
+		{"https://example.org:8443/", true},
+		{"http://example.com/", false},
+		{"https://example.net/", false},
+		{"https://badexample.com/", false},
+		{"https://private.example.com/", false},
+		{"https://a.private.example.com/", false},
+		{"https://example.com:80/", false},
+		{"https://example.com:0443/", false},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = policy.CheckURL(u)
+
+		if _, blocked := err.(*PolicyError); blocked == test.ok || err != nil && !blocked {
+			t.Errorf("%s: got %v, want allowed %v", test.url, err, test.ok)
+		}
+	}
+
+	if err := DefaultFetchPolicy.CheckURL(&url.URL{Scheme: "http", Host: "example.com:8080"}); err == nil {
+		t.Error("DefaultFetchPolicy allows port 8080")
+	}
+}
+
+func TestCheckIP(t *testing.T) {
+	tests := []struct {
+		ip string
+		ok bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+
+	for _, test := range tests {
+		if err := DefaultFetchPolicy.CheckIP(net.ParseIP(test.ip)); (err == nil) != test.ok {
+			t.Errorf("%s: got %v, want allowed %v", test.ip, err, test.ok)
+		}
+	}
+
+	var policy = &FetchPolicy{AllowNetworks: []string{"10.1.0.0/16"}}
+
+	if err := policy.CheckIP(net.ParseIP("10.1.2.3")); err != nil {
+		t.Errorf("10.1.2.3: got %v with AllowNetworks 10.1.0.0/16", err)
+	}
+
+	if err := policy.CheckIP(net.ParseIP("10.2.0.1")); err == nil {
+		t.Error("10.2.0.1: allowed with AllowNetworks 10.1.0.0/16")
+	}
+}
+
+// roundTripperFunc is a transport that is not an *http.Transport, such as
+// App Engine's.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestPolicyFetch(t *testing.T) {
+	// inner stands in for an internal service, on another loopback address
+	// than the page that redirects to it.
+	l, err := net.Listen("tcp", "127.0.0.2:0")
+
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.2: %v", err)
+	}
+
+	inner := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secret")
+	}))
+	inner.Listener.Close()
+	inner.Listener = l
+	inner.Start()
+	defer inner.Close()
+
+	var mux = http.NewServeMux()
+
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<p>page")
+	})
+	mux.Handle("/inner", http.RedirectHandler(inner.URL+"/", http.StatusFound))
+	mux.Handle("/denied", http.RedirectHandler("http://blocked.example/", http.StatusFound))
+
+	up := httptest.NewServer(mux)
+	defer up.Close()
+
+	_, port, _ := net.SplitHostPort(up.Listener.Addr().String())
+
+	var public = &FetchPolicy{}
+	var upOnly = &FetchPolicy{AllowNetworks: []string{"127.0.0.1/32"}, DenyHosts: []string{"blocked.example"}}
+	var direct = &http.Client{Transport: roundTripperFunc(http.DefaultTransport.RoundTrip)}
+
+	tests := []struct {
+		fetcher *HTTPFetcher
+		url     string
+		ok      bool
+	}{
+		{&HTTPFetcher{Policy: public}, up.URL + "/page", false},
+		// localhost passes the url checks, but not once resolved.
+		{&HTTPFetcher{Policy: public}, "http://localhost:" + port + "/page", false},
+		{&HTTPFetcher{Policy: public, Client: direct}, "http://localhost:" + port + "/page", false},
+		{&HTTPFetcher{Policy: upOnly}, up.URL + "/page", true},
+		{&HTTPFetcher{Policy: upOnly, Client: direct}, up.URL + "/page", true},
+		{&HTTPFetcher{Policy: upOnly}, inner.URL + "/", false},
+		{&HTTPFetcher{Policy: upOnly}, up.URL + "/inner", false},
+		{&HTTPFetcher{Policy: upOnly, Client: direct}, up.URL + "/inner", false},
+		{&HTTPFetcher{Policy: upOnly}, up.URL + "/denied", false},
+		{&HTTPFetcher{Policy: &FetchPolicy{AllowPrivate: true, Ports: []int{80}}}, up.URL + "/page", false},
+		{&HTTPFetcher{Policy: &FetchPolicy{AllowPrivate: true}}, up.URL + "/inner", true},
+	}
+
+	for _, test := range tests {
+		resp, err := test.fetcher.Fetch(nil, &FetchRequest{URL: test.url})
+
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		var blocked *PolicyError
+
+		if test.ok && err != nil || !test.ok && !errors.As(err, &blocked) {
+			t.Errorf("%s with %+v: got %v, want allowed %v", test.url, test.fetcher.Policy, err, test.ok)
+		}
+
+		if err != nil && errorValue(err).Code != CodeBlockedURL && !test.ok {
+			t.Errorf("%s: got code %s, want %s", test.url, errorValue(err).Code, CodeBlockedURL)
+		}
+	}
+}
@@ -5,15 +5,74 @@
 package html
 
 import (
+	"strconv"
 	"strings"
 )
 
+// A DocumentMode is the rendering mode that a document's doctype selects
+// (section 12.2.5.4.1). Browsers emulate the layout bugs of their ancestors
+// for documents in quirks mode, and a few of them in limited-quirks mode.
+type DocumentMode int
+
+const (
+	NoQuirks DocumentMode = iota
+	LimitedQuirks
+	Quirks
+)
+
+var documentModeNames = [...]string{
+	NoQuirks:      "no-quirks",
+	LimitedQuirks: "limited-quirks",
+	Quirks:        "quirks",
+}
+
+// String returns the name of the mode in the HTML5 specification, such as
+// "limited-quirks".
+func (m DocumentMode) String() string {
+	if 0 <= m && int(m) < len(documentModeNames) {
+		return documentModeNames[m]
+	}
+	return "Invalid(" + strconv.Itoa(int(m)) + ")"
+}
+
 // parseDoctype parses the data from a DoctypeToken into a name,
 // public identifier, and system identifier. It returns a Node whose Type 
 // is DoctypeNode, whose Data is the name, and which has attributes
 // named "system" and "public" for the two identifiers if they were present.
-// quirks is whether the document should be parsed in "quirks mode".
-func parseDoctype(s string) (n *Node, quirks bool) {
+// mode is the mode the document should be parsed in.
+func parseDoctype(s string) (n *Node, mode DocumentMode) {
+	n, quirks := parseQuirks(s)
+	if quirks {
+		return n, Quirks
+	}
+	if len(n.Attr) > 0 && n.Attr[0].Key == "public" {
+		public := strings.ToLower(n.Attr[0].Val)
+		for _, q := range limitedQuirkyIDs {
+			if strings.HasPrefix(public, q) {
+				return n, LimitedQuirks
+			}
+		}
+		// The following two public IDs only cause limited-quirks mode if
+		// there is a system ID; without one they cause quirks mode.
+		if strings.HasPrefix(public, "-//w3c//dtd html 4.01 frameset//") ||
+			strings.HasPrefix(public, "-//w3c//dtd html 4.01 transitional//") {
+			return n, LimitedQuirks
+		}
+	}
+	return n, NoQuirks
+}
+
+// limitedQuirkyIDs is a list of public doctype identifiers that cause a
+// document to be interpreted in limited-quirks mode. The identifiers should
+// be in lower case.
+var limitedQuirkyIDs = []string{
+	"-//w3c//dtd xhtml 1.0 frameset//",
+	"-//w3c//dtd xhtml 1.0 transitional//",
+}
+
+// parseQuirks is parseDoctype without the limited-quirks mode. quirks is
+// whether the document should be parsed in "quirks mode".
+func parseQuirks(s string) (n *Node, quirks bool) {
 	n = &Node{Type: DoctypeNode}
 
 	// Find the name.
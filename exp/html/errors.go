@@ -0,0 +1,446 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// A ParseError is a parse error, as defined by the HTML5 specification, that
+// the parser recovered from. Browsers render such documents anyway, but a
+// conforming document has none.
+type ParseError struct {
+	// Code identifies the kind of error. The codes are those of the html5lib
+	// parser, such as "unexpected-end-tag" or "duplicate-attribute".
+	Code string
+	// Data is the tag name of the token that caused the error, if any.
+	Data string
+	// Pos is the start of the token that caused the error.
+	Pos Position
+}
+
+func (e *ParseError) Error() string {
+	if e.Data != "" {
+		return fmt.Sprintf("html: %v: %s (%s)", e.Pos, e.Code, e.Data)
+	}
+	return fmt.Sprintf("html: %v: %s", e.Pos, e.Code)
+}
+
+// ParseWithErrors is like Parse, but also returns the parse errors of the
+// document in the order they were found. The returned error is only
+// non-nil if reading r failed.
+func ParseWithErrors(r io.Reader) (*Node, []*ParseError, error) {
+	res, err := ParseWithOptions(r, &ParseOptions{Errors: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	return res.Doc, res.Errors, nil
+}
+
+// parseError records a parse error caused by the current token.
+func (p *parser) parseError(code string) {
+	if !p.collectErrors || p.quiet {
+		return
+	}
+	var data string
+	switch p.tok.Type {
+	case StartTagToken, EndTagToken, SelfClosingTagToken:
+		data = p.tok.Data
+	}
+	p.errors = append(p.errors, &ParseError{Code: code, Data: data, Pos: p.start})
+}
+
+// conformingDoctype reports whether the doctype n is one that does not
+// make a parse error: <!DOCTYPE html>, optionally with the system
+// identifier "about:legacy-compat".
+func conformingDoctype(n *Node) bool {
+	if n.Data != "html" {
+		return false
+	}
+	for _, a := range n.Attr {
+		if a.Key != "system" || a.Val != "about:legacy-compat" {
+			return false
+		}
+	}
+	return true
+}
+
+// unexpected records that the current token is not allowed where it is,
+// and is ignored or processed as if it was somewhere else.
+func (p *parser) unexpected() {
+	switch p.tok.Type {
+	case TextToken:
+		p.parseError("unexpected-char")
+	case StartTagToken:
+		p.parseError("unexpected-start-tag")
+	case EndTagToken:
+		p.parseError("unexpected-end-tag")
+	case DoctypeToken:
+		p.parseError("unexpected-doctype")
+	}
+}
+
+// checkEndTag records the parse errors of an end tag that closes the
+// innermost of the elements called tags that is in scope s. There must be
+// one, and the elements opened after it must all have optional end tags.
+func (p *parser) checkEndTag(s scope, tags ...string) {
+	if !p.collectErrors {
+		return
+	}
+	i := p.indexOfElementInScope(s, tags...)
+	if i == -1 {
+		p.parseError("unexpected-end-tag")
+		return
+	}
+	p.checkClosed(i, "end-tag-too-early")
+}
+
+// checkClosed records a parse error with the given code if closing the
+// open element at index i of the stack would close elements after it
+// whose end tags are not optional.
+func (p *parser) checkClosed(i int, code string) {
+	for _, n := range p.oe[i+1:] {
+		switch n.Data {
+		case "dd", "dt", "li", "optgroup", "option", "p", "rp", "rt":
+			if n.Namespace == "" {
+				continue
+			}
+		}
+		p.parseError(code)
+		return
+	}
+}
+
+// checkOpenElements records a parse error with the given code if elements
+// other than those whose end tags may be omitted at the end of the body are
+// still open.
+func (p *parser) checkOpenElements(code string) {
+	if !p.collectErrors {
+		return
+	}
+	for _, n := range p.oe {
+		switch n.Data {
+		case "dd", "dt", "li", "optgroup", "option", "p", "rp", "rt",
+			"tbody", "td", "tfoot", "th", "thead", "tr", "body", "html":
+			if n.Namespace == "" {
+				continue
+			}
+		}
+		p.parseError(code)
+		return
+	}
+}
+
+// rawTokenErrors records the parse errors that the tokenizer recovered from
+// in raw, the source of the current token. It must be called before the
+// token's text is unescaped. data is whether the token was read as markup,
+// not as the content of a raw text or RCDATA element.
+func (p *parser) rawTokenErrors(tt TokenType, raw []byte, data bool) {
+	switch tt {
+	case TextToken:
+		if bytes.IndexByte(raw, 0) != -1 {
+			p.parseError("invalid-codepoint")
+		}
+		if data {
+			p.tagOpenErrors(raw)
+		}
+		if !p.tokenizer.textIsRaw {
+			p.charRefErrors(raw, false)
+		}
+	case CommentToken:
+		switch {
+		case bytes.HasPrefix(raw, []byte("<!--")):
+			switch {
+			case bytes.Equal(raw, []byte("<!-->")), bytes.Equal(raw, []byte("<!--->")):
+				p.parseError("incorrect-comment")
+			case len(raw) < len("<!---->") || !bytes.HasSuffix(raw, []byte("-->")):
+				p.parseError("eof-in-comment")
+			case bytes.HasSuffix(raw, []byte("--!>")):
+				p.parseError("unexpected-bang-after-double-dash-in-comment")
+			}
+			// A "<!--" inside the comment does not start another one.
+			if len(raw) > len("<!---->") && bytes.Contains(raw[len("<!--"):len(raw)-len("-->")], []byte("<!--")) {
+				p.parseError("unexpected-char-in-comment")
+			}
+		case bytes.HasPrefix(raw, []byte("<?")):
+			p.parseError("expected-tag-name-but-got-question-mark")
+		case bytes.HasPrefix(raw, []byte("</")):
+			p.parseError("expected-closing-tag-but-got-char")
+		default:
+			p.parseError("expected-dashes-or-doctype")
+		}
+	case DoctypeToken:
+		p.doctypeErrors(raw[len("<!doctype"):])
+		if !bytes.HasSuffix(raw, []byte(">")) {
+			p.parseError("eof-in-doctype")
+		}
+	case StartTagToken, EndTagToken, SelfClosingTagToken:
+		if !bytes.HasSuffix(raw, []byte(">")) {
+			p.parseError("eof-in-tag")
+		}
+	case ErrorToken:
+		// The tokenizer drops a tag cut short by the end of the input.
+		if len(raw) > 1 && raw[0] == '<' {
+			p.parseError("eof-in-tag-name")
+		}
+	}
+}
+
+// attributeErrors records the parse errors in the attributes of the tag
+// raw, character references in their values included. It follows the
+// states of the tokenizer from the tag name to the closing '>'.
+func (p *parser) attributeErrors(raw []byte) {
+	const (
+		tagName = iota
+		beforeName
+		name
+		afterName
+		beforeValue
+		value
+		afterValue
+	)
+	state, quote, start := tagName, byte(0), 0
+	for i := 1; i < len(raw); i++ {
+		c := raw[i]
+		if state == value {
+			switch {
+			case quote != 0 && c == quote:
+				p.charRefErrors(raw[start:i], true)
+				state = afterValue
+			case quote == 0 && isSpace(c):
+				p.charRefErrors(raw[start:i], true)
+				state = beforeName
+			case quote == 0 && c == '>':
+				p.charRefErrors(raw[start:i], true)
+				return
+			case quote == 0 && (c == '"' || c == '\'' || c == '<' || c == '=' || c == '`'):
+				p.parseError("unexpected-character-in-unquoted-attribute-value")
+			}
+			continue
+		}
+		switch {
+		case c == '>':
+			if state == beforeValue {
+				p.parseError("expected-attribute-value-but-got-right-bracket")
+			}
+			return
+		case c == '/' && state != beforeValue:
+			if i+1 < len(raw) && raw[i+1] != '>' {
+				p.parseError("unexpected-character-after-solidus-in-tag")
+			}
+			state = beforeName
+		case isSpace(c):
+			switch state {
+			case tagName, afterValue:
+				state = beforeName
+			case name:
+				state = afterName
+			}
+		case c == '=' && (state == name || state == afterName):
+			state = beforeValue
+		case state == beforeValue:
+			state, quote, start = value, 0, i
+			if c == '"' || c == '\'' {
+				quote, start = c, i+1
+			} else if c == '<' || c == '=' || c == '`' {
+				p.parseError("equals-in-unquoted-attribute-value")
+			}
+		case state == tagName:
+		default:
+			if state == afterValue {
+				p.parseError("unexpected-character-after-attribute-value")
+			}
+			if state != name && c == '=' {
+				p.parseError("invalid-character-in-attribute-name")
+			} else if c == '"' || c == '\'' || c == '<' {
+				p.parseError("invalid-character-in-attribute-name")
+			}
+			state = name
+		}
+	}
+}
+
+// tagOpenErrors records the parse errors of the '<' characters in the text
+// raw, each of which would have started a tag if a letter followed it.
+func (p *parser) tagOpenErrors(raw []byte) {
+	for {
+		i := bytes.IndexByte(raw, '<')
+		if i == -1 {
+			return
+		}
+		raw = raw[i+1:]
+		switch {
+		case len(raw) == 0:
+			p.parseError("expected-tag-name")
+		case raw[0] == '>':
+			p.parseError("expected-tag-name-but-got-right-bracket")
+		case raw[0] == '/' && len(raw) == 1:
+			p.parseError("expected-closing-tag-but-got-eof")
+		default:
+			p.parseError("expected-tag-name")
+		}
+	}
+}
+
+// doctypeErrors records the parse errors of a doctype, where raw follows
+// the "<!doctype": a missing name, or keywords other than PUBLIC and SYSTEM
+// after it.
+func (p *parser) doctypeErrors(raw []byte) {
+	if len(raw) == 0 {
+		return
+	}
+	if !isSpace(raw[0]) && raw[0] != '>' {
+		p.parseError("need-space-after-doctype")
+	}
+	raw = bytes.TrimLeft(raw, whitespace)
+	if len(raw) == 0 {
+		return
+	}
+	if raw[0] == '>' {
+		p.parseError("expected-doctype-name-but-got-right-bracket")
+		return
+	}
+	i := bytes.IndexAny(raw, whitespace+">")
+	if i == -1 {
+		return
+	}
+	raw = bytes.TrimLeft(raw[i:], whitespace)
+	if len(raw) == 0 || raw[0] == '>' {
+		return
+	}
+	if len(raw) < 6 || !bytes.EqualFold(raw[:6], []byte("public")) && !bytes.EqualFold(raw[:6], []byte("system")) {
+		p.parseError("expected-space-or-right-bracket-in-doctype")
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// tokenErrors records the parse errors of the attributes of the current
+// token, whose source is raw.
+func (p *parser) tokenErrors(raw []byte) {
+	switch p.tok.Type {
+	case StartTagToken, SelfClosingTagToken:
+		p.attributeErrors(raw)
+		for i, a := range p.tok.Attr {
+			for _, b := range p.tok.Attr[:i] {
+				if a.Key == b.Key {
+					p.parseError("duplicate-attribute")
+					break
+				}
+			}
+		}
+	case EndTagToken:
+		// Skip the "</" and the tag name.
+		rest := raw[2:]
+		if i := bytes.IndexAny(rest, whitespace+"/>"); i != -1 {
+			rest = rest[i:]
+		}
+		rest = bytes.TrimRight(rest, ">")
+		if len(bytes.Trim(rest, whitespace+"/")) > 0 {
+			// attributeErrors skips the '/' as it would the '<' of a
+			// start tag.
+			p.attributeErrors(raw[1:])
+			p.parseError("attributes-in-end-tag")
+		} else if bytes.HasSuffix(rest, []byte("/")) {
+			p.parseError("self-closing-flag-on-end-tag")
+		}
+	}
+}
+
+// charRefErrors records the parse errors of the character references in
+// the text s, or in an attribute value if attr is set.
+func (p *parser) charRefErrors(s []byte, attr bool) {
+	for {
+		i := bytes.IndexByte(s, '&')
+		if i == -1 || i+1 >= len(s) {
+			return
+		}
+		s = s[i+1:]
+		if s[0] == '#' {
+			p.numericCharRefErrors(s[1:])
+			continue
+		}
+		j := 0
+		for j < len(s) && isAlnum(s[j]) {
+			j++
+		}
+		if j == 0 {
+			continue
+		}
+		if j < len(s) && s[j] == ';' {
+			name := string(s[:j+1])
+			if _, ok := entity[name]; !ok {
+				if _, ok := entity2[name]; !ok {
+					p.parseError("expected-named-entity")
+				}
+			}
+			continue
+		}
+		// A reference without a semicolon is still recognized if it is a
+		// prefix of the name, except in an attribute value where it is
+		// followed by a letter, a digit or '='.
+		for k := j; k > 0; k-- {
+			if k <= longestEntityWithoutSemicolon {
+				if _, ok := entity[string(s[:k])]; ok {
+					if !attr || k == len(s) || !isAlnum(s[k]) && s[k] != '=' {
+						p.parseError("named-entity-without-semicolon")
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+// numericCharRefErrors records the parse errors of a numeric character
+// reference, where s follows the "&#".
+func (p *parser) numericCharRefErrors(s []byte) {
+	base := 10
+	if len(s) > 0 && (s[0] == 'x' || s[0] == 'X') {
+		base, s = 16, s[1:]
+	}
+	x, i := 0, 0
+	for ; i < len(s); i++ {
+		d := digitValue(s[i])
+		if d < 0 || d >= base {
+			break
+		}
+		// Stop growing past the largest code point.
+		if x = x*base + d; x > 0x10FFFF {
+			x = 0x110000
+		}
+	}
+	if i == 0 {
+		p.parseError("expected-numeric-entity")
+		return
+	}
+	if i == len(s) || s[i] != ';' {
+		p.parseError("numeric-entity-without-semicolon")
+	}
+	if x == 0 || 0x80 <= x && x <= 0x9F || 0xD800 <= x && x <= 0xDFFF || x > 0x10FFFF {
+		p.parseError("illegal-codepoint-for-numeric-entity")
+	}
+}
+
+// digitValue returns the value of the hexadecimal digit c, or -1.
+func digitValue(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
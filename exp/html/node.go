@@ -30,13 +30,21 @@ var scopeMarker = Node{Type: scopeMarkerNode}
 // An empty Namespace implies a "http://www.w3.org/1999/xhtml" namespace.
 // Similarly, "math" is short for "http://www.w3.org/1998/Math/MathML", and
 // "svg" is short for "http://www.w3.org/2000/svg".
+//
+// Start and End locate the node in the input of the parser that created
+// it. Start is the start of the token that opened the node, End is just
+// past its end tag, or past its last descendant if it was closed
+// implicitly, if ParseOptions.Positions asked for it, and past the token
+// otherwise. Nodes implied by the parser are located at the token that
+// implied them. Both are zero for nodes that did not come from a parser.
 type Node struct {
-	Parent    *Node
-	Child     []*Node
-	Type      NodeType
-	Data      string
-	Namespace string
-	Attr      []Attribute
+	Parent     *Node
+	Child      []*Node
+	Type       NodeType
+	Data       string
+	Namespace  string
+	Attr       []Attribute
+	Start, End Position
 }
 
 // Add adds a node as a child of n.
@@ -79,13 +87,15 @@ func reparentChildren(dst, src *Node) {
 	src.Child = nil
 }
 
-// clone returns a new node with the same type, data and attributes.
-// The clone has no parent and no children.
+// clone returns a new node with the same type, data, attributes and
+// positions. The clone has no parent and no children.
 func (n *Node) clone() *Node {
 	m := &Node{
-		Type: n.Type,
-		Data: n.Data,
-		Attr: make([]Attribute, len(n.Attr)),
+		Type:  n.Type,
+		Data:  n.Data,
+		Attr:  make([]Attribute, len(n.Attr)),
+		Start: n.Start,
+		End:   n.End,
 	}
 	copy(m.Attr, n.Attr)
 	return m
@@ -37,11 +37,34 @@ type parser struct {
 	// fosterParenting is whether new elements should be inserted according to
 	// the foster parenting rules (section 12.2.5.3).
 	fosterParenting bool
-	// quirks is whether the parser is operating in "quirks mode."
-	quirks bool
+	// mode is the document mode that the parser is operating in.
+	mode DocumentMode
 	// context is the context element when parsing an HTML fragment
 	// (section 12.4).
 	context *Node
+	// start and end are the positions of the current token. Nodes created
+	// for it are located there.
+	start, end Position
+	// positions is whether elements are extended to their end tag or last
+	// descendant. oeBefore is then the stack of open elements before the
+	// current end tag was processed, used to find the element it closed.
+	positions bool
+	oeBefore  nodeStack
+	// collectErrors is whether parse errors are recorded in errors. quiet
+	// silences them while the parser processes a token of its own making.
+	collectErrors, quiet bool
+	errors               []*ParseError
+	// stopped is whether parsing stopped at EOF after the body, where the
+	// elements left open are not an error.
+	stopped bool
+	// maxDepth, maxNodes and maxAttributes bound the parse tree, if
+	// positive. nodes counts the nodes added to it, and truncated names
+	// the first bound the input exceeded, which ends the parse if
+	// stopAtLimit is set.
+	maxDepth, maxNodes, maxAttributes int
+	nodes                             int
+	truncated                         string
+	stopAtLimit                       bool
 }
 
 func (p *parser) top() *Node {
@@ -97,6 +120,15 @@ func (p *parser) popUntil(s scope, matchTags ...string) bool {
 	return false
 }
 
+// closeP closes the p element in button scope, if there is one. Elements
+// opened in it whose end tags are not optional make a parse error.
+func (p *parser) closeP() {
+	if i := p.indexOfElementInScope(buttonScope, "p"); i != -1 {
+		p.checkClosed(i, "unexpected-start-tag-implies-end-tag")
+		p.oe = p.oe[:i]
+	}
+}
+
 // indexOfElementInScope returns the index in p.oe of the highest element whose
 // tag is in matchTags that is in scope. If no matching element is in scope, it
 // returns -1.
@@ -205,17 +237,51 @@ loop:
 // addChild adds a child node n to the top element, and pushes n onto the stack
 // of open elements if it is an element node.
 func (p *parser) addChild(n *Node) {
+	p.positioned(n)
 	if p.fosterParenting {
 		p.fosterParent(n)
+	} else if top := p.top(); n.Type == ElementNode && p.maxDepth > 0 && len(p.oe) >= p.maxDepth && top.Parent != nil && !structuralElements[top.Data] && !structuralElements[n.Data] {
+		// Past the maximum depth, elements are added next to the current
+		// node instead of in it, as browsers do, and take its place on the
+		// stack of open elements, so that neither the tree nor the stack
+		// gets deeper. The current node is closed as by its end tag, so
+		// that it is not reconstructed as an active formatting element.
+		p.truncate("depth")
+		top.Parent.Add(n)
+		p.oe.pop()
+		p.afe.remove(top)
 	} else {
-		p.top().Add(n)
+		top.Add(n)
 	}
+	p.nodes++
 
 	if n.Type == ElementNode {
 		p.oe = append(p.oe, n)
 	}
 }
 
+// structuralElements are the elements whose place on the stack of open
+// elements the insertion modes rely on, such as the rows of a table or a
+// select. Past the maximum depth, they neither take the place of the
+// current node nor give theirs up.
+var structuralElements = map[string]bool{
+	"body":     true,
+	"caption":  true,
+	"colgroup": true,
+	"frameset": true,
+	"head":     true,
+	"html":     true,
+	"select":   true,
+	"table":    true,
+	"tbody":    true,
+	"td":       true,
+	"template": true,
+	"tfoot":    true,
+	"th":       true,
+	"thead":    true,
+	"tr":       true,
+}
+
 // fosterParent adds a child node according to the foster parenting rules.
 // Section 12.2.5.3, "foster parenting".
 func (p *parser) fosterParent(n *Node) {
@@ -248,6 +314,7 @@ func (p *parser) fosterParent(n *Node) {
 
 	if i > 0 && parent.Child[i-1].Type == TextNode && n.Type == TextNode {
 		parent.Child[i-1].Data += n.Data
+		parent.Child[i-1].End = n.End
 		return
 	}
 
@@ -268,6 +335,7 @@ func (p *parser) addText(text string) {
 	t := p.top()
 	if i := len(t.Child); i > 0 && t.Child[i-1].Type == TextNode {
 		t.Child[i-1].Data += text
+		t.Child[i-1].End = p.end
 		return
 	}
 	p.addChild(&Node{
@@ -331,13 +399,55 @@ func (p *parser) reconstructActiveFormattingElements() {
 	}
 }
 
-// read reads the next token from the tokenizer.
+// positioned locates n at the current token, unless it already has a
+// position, and returns it.
+func (p *parser) positioned(n *Node) *Node {
+	if n.Start.Line == 0 {
+		n.Start, n.End = p.start, p.end
+	}
+	return n
+}
+
+// truncate records that the input exceeded the bound called limit.
+func (p *parser) truncate(limit string) {
+	if p.truncated == "" {
+		p.truncated = limit
+	}
+}
+
+// read reads the next token from the tokenizer. Once the tree has as many
+// nodes as it may hold, the input ends.
 func (p *parser) read() error {
-	p.tokenizer.Next()
+	if p.maxNodes > 0 && p.nodes >= p.maxNodes {
+		if p.tokenizer.Next() != ErrorToken {
+			p.truncate("nodes")
+		}
+		p.tok = Token{Type: ErrorToken}
+		return io.EOF
+	}
+	data := p.tokenizer.rawTag == ""
+	tt := p.tokenizer.Next()
+	p.start, p.end = p.tokenizer.Pos()
+	var raw []byte
+	if p.collectErrors {
+		raw = append(raw, p.tokenizer.Raw()...)
+		p.tok = Token{Type: tt}
+		p.rawTokenErrors(tt, raw, data)
+	}
 	p.tok = p.tokenizer.Token()
 	if p.tok.Type == ErrorToken {
 		return p.tokenizer.Err()
 	}
+	if p.collectErrors {
+		p.tokenErrors(raw)
+	}
+	if p.maxAttributes > 0 && len(p.tok.Attr) > p.maxAttributes {
+		p.truncate("attributes")
+		p.tok.Attr = p.tok.Attr[:p.maxAttributes]
+	}
+	if p.tok.Type == StartTagToken && p.tok.Data == "noscript" && !p.scripting {
+		p.tokenizer.NextIsNotRawText()
+	}
 	return nil
 }
 
@@ -413,19 +523,32 @@ func initialIM(p *parser) bool {
 			return true
 		}
 	case CommentToken:
-		p.doc.Add(&Node{
+		p.doc.Add(p.positioned(&Node{
 			Type: CommentNode,
 			Data: p.tok.Data,
-		})
+		}))
 		return true
 	case DoctypeToken:
-		n, quirks := parseDoctype(p.tok.Data)
-		p.doc.Add(n)
-		p.quirks = quirks
+		n, mode := parseDoctype(p.tok.Data)
+		p.doc.Add(p.positioned(n))
+		p.mode = mode
 		p.im = beforeHTMLIM
+		if !conformingDoctype(n) {
+			p.parseError("unknown-doctype")
+		}
 		return true
 	}
-	p.quirks = true
+	switch p.tok.Type {
+	case TextToken:
+		p.parseError("expected-doctype-but-got-chars")
+	case StartTagToken:
+		p.parseError("expected-doctype-but-got-start-tag")
+	case EndTagToken:
+		p.parseError("expected-doctype-but-got-end-tag")
+	case ErrorToken:
+		p.parseError("expected-doctype-but-got-eof")
+	}
+	p.mode = Quirks
 	p.im = beforeHTMLIM
 	return false
 }
@@ -435,6 +558,7 @@ func beforeHTMLIM(p *parser) bool {
 	switch p.tok.Type {
 	case DoctypeToken:
 		// Ignore the token.
+		p.unexpected()
 		return true
 	case TextToken:
 		p.tok.Data = strings.TrimLeft(p.tok.Data, whitespace)
@@ -455,13 +579,14 @@ func beforeHTMLIM(p *parser) bool {
 			return false
 		default:
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case CommentToken:
-		p.doc.Add(&Node{
+		p.doc.Add(p.positioned(&Node{
 			Type: CommentNode,
 			Data: p.tok.Data,
-		})
+		}))
 		return true
 	}
 	p.parseImpliedToken(StartTagToken, "html", nil)
@@ -494,6 +619,7 @@ func beforeHeadIM(p *parser) bool {
 			return false
 		default:
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case CommentToken:
@@ -504,6 +630,7 @@ func beforeHeadIM(p *parser) bool {
 		return true
 	case DoctypeToken:
 		// Ignore the token.
+		p.unexpected()
 		return true
 	}
 
@@ -533,13 +660,23 @@ func inHeadIM(p *parser) bool {
 			p.oe.pop()
 			p.acknowledgeSelfClosingTag()
 			return true
-		case "script", "title", "noscript", "noframes", "style":
+		case "noscript":
+			p.addElement(p.tok.Data, p.tok.Attr)
+			if !p.scripting {
+				p.im = inHeadNoscriptIM
+				return true
+			}
+			p.setOriginalIM()
+			p.im = textIM
+			return true
+		case "script", "title", "noframes", "style":
 			p.addElement(p.tok.Data, p.tok.Attr)
 			p.setOriginalIM()
 			p.im = textIM
 			return true
 		case "head":
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case EndTagToken:
@@ -556,6 +693,7 @@ func inHeadIM(p *parser) bool {
 			return false
 		default:
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case CommentToken:
@@ -566,6 +704,7 @@ func inHeadIM(p *parser) bool {
 		return true
 	case DoctypeToken:
 		// Ignore the token.
+		p.unexpected()
 		return true
 	}
 
@@ -573,6 +712,63 @@ func inHeadIM(p *parser) bool {
 	return false
 }
 
+// Section 12.2.5.4.5.
+func inHeadNoscriptIM(p *parser) bool {
+	switch p.tok.Type {
+	case ErrorToken:
+		p.parseError("eof-in-head-noscript")
+	case TextToken:
+		s := strings.TrimLeft(p.tok.Data, whitespace)
+		if len(s) < len(p.tok.Data) {
+			// Add the initial whitespace to the current node.
+			p.addText(p.tok.Data[:len(p.tok.Data)-len(s)])
+			if s == "" {
+				return true
+			}
+			p.tok.Data = s
+		}
+		p.parseError("char-in-head-noscript")
+	case StartTagToken:
+		switch p.tok.Data {
+		case "html":
+			return inBodyIM(p)
+		case "basefont", "bgsound", "link", "meta", "noframes", "style":
+			return inHeadIM(p)
+		case "head", "noscript":
+			// Ignore the token.
+			p.unexpected()
+			return true
+		}
+		p.parseError("unexpected-inhead-noscript-tag")
+	case EndTagToken:
+		switch p.tok.Data {
+		case "noscript":
+			p.oe.pop()
+			p.im = inHeadIM
+			return true
+		case "br":
+			p.parseError("unexpected-inhead-noscript-tag")
+		default:
+			// Ignore the token.
+			p.unexpected()
+			return true
+		}
+	case CommentToken:
+		return inHeadIM(p)
+	case DoctypeToken:
+		// Ignore the token.
+		p.unexpected()
+		return true
+	}
+
+	n := p.oe.pop()
+	if n.Data != "noscript" {
+		panic("html: bad parser state: <noscript> element not found, in the in-head-noscript insertion mode")
+	}
+	p.im = inHeadIM
+	return false
+}
+
 // Section 12.2.5.4.6.
 func afterHeadIM(p *parser) bool {
 	switch p.tok.Type {
@@ -600,11 +796,13 @@ func afterHeadIM(p *parser) bool {
 			p.im = inFramesetIM
 			return true
 		case "base", "basefont", "bgsound", "link", "meta", "noframes", "script", "style", "title":
+			p.parseError("unexpected-start-tag-out-of-my-head")
 			p.oe = append(p.oe, p.head)
 			defer p.oe.pop()
 			return inHeadIM(p)
 		case "head":
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case EndTagToken:
@@ -613,6 +811,7 @@ func afterHeadIM(p *parser) bool {
 			// Drop down to creating an implied <body> tag.
 		default:
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case CommentToken:
@@ -623,6 +822,7 @@ func afterHeadIM(p *parser) bool {
 		return true
 	case DoctypeToken:
 		// Ignore the token.
+		p.unexpected()
 		return true
 	}
 
@@ -675,10 +875,12 @@ func inBodyIM(p *parser) bool {
 	case StartTagToken:
 		switch p.tok.Data {
 		case "html":
+			p.parseError("non-html-root")
 			copyAttributes(p.oe[0], p.tok)
 		case "base", "basefont", "bgsound", "command", "link", "meta", "noframes", "script", "style", "title":
 			return inHeadIM(p)
 		case "body":
+			p.unexpected()
 			if len(p.oe) >= 2 {
 				body := p.oe[1]
 				if body.Type == ElementNode && body.Data == "body" {
@@ -687,6 +889,7 @@ func inBodyIM(p *parser) bool {
 				}
 			}
 		case "frameset":
+			p.unexpected()
 			if !p.framesetOK || len(p.oe) < 2 || p.oe[1].Data != "body" {
 				// Ignore the token.
 				return true
@@ -700,25 +903,28 @@ func inBodyIM(p *parser) bool {
 			p.im = inFramesetIM
 			return true
 		case "address", "article", "aside", "blockquote", "center", "details", "dir", "div", "dl", "fieldset", "figcaption", "figure", "footer", "header", "hgroup", "menu", "nav", "ol", "p", "section", "summary", "ul":
-			p.popUntil(buttonScope, "p")
+			p.closeP()
 			p.addElement(p.tok.Data, p.tok.Attr)
 		case "h1", "h2", "h3", "h4", "h5", "h6":
-			p.popUntil(buttonScope, "p")
+			p.closeP()
 			switch n := p.top(); n.Data {
 			case "h1", "h2", "h3", "h4", "h5", "h6":
+				p.unexpected()
 				p.oe.pop()
 			}
 			p.addElement(p.tok.Data, p.tok.Attr)
 		case "pre", "listing":
-			p.popUntil(buttonScope, "p")
+			p.closeP()
 			p.addElement(p.tok.Data, p.tok.Attr)
 			// The newline, if any, will be dealt with by the TextToken case.
 			p.framesetOK = false
 		case "form":
 			if p.form == nil {
-				p.popUntil(buttonScope, "p")
+				p.closeP()
 				p.addElement(p.tok.Data, p.tok.Attr)
 				p.form = p.top()
+			} else {
+				p.unexpected()
 			}
 		case "li":
 			p.framesetOK = false
@@ -726,6 +932,7 @@ func inBodyIM(p *parser) bool {
 				node := p.oe[i]
 				switch node.Data {
 				case "li":
+					p.checkClosed(i, "missing-end-tag")
 					p.oe = p.oe[:i]
 				case "address", "div", "p":
 					continue
@@ -736,7 +943,7 @@ func inBodyIM(p *parser) bool {
 				}
 				break
 			}
-			p.popUntil(buttonScope, "p")
+			p.closeP()
 			p.addElement(p.tok.Data, p.tok.Attr)
 		case "dd", "dt":
 			p.framesetOK = false
@@ -744,6 +951,7 @@ func inBodyIM(p *parser) bool {
 				node := p.oe[i]
 				switch node.Data {
 				case "dd", "dt":
+					p.checkClosed(i, "missing-end-tag")
 					p.oe = p.oe[:i]
 				case "address", "div", "p":
 					continue
@@ -754,12 +962,15 @@ func inBodyIM(p *parser) bool {
 				}
 				break
 			}
-			p.popUntil(buttonScope, "p")
+			p.closeP()
 			p.addElement(p.tok.Data, p.tok.Attr)
 		case "plaintext":
-			p.popUntil(buttonScope, "p")
+			p.closeP()
 			p.addElement(p.tok.Data, p.tok.Attr)
 		case "button":
+			if p.elementInScope(defaultScope, "button") {
+				p.parseError("unexpected-start-tag-implies-end-tag")
+			}
 			p.popUntil(defaultScope, "button")
 			p.reconstructActiveFormattingElements()
 			p.addElement(p.tok.Data, p.tok.Attr)
@@ -767,6 +978,7 @@ func inBodyIM(p *parser) bool {
 		case "a":
 			for i := len(p.afe) - 1; i >= 0 && p.afe[i].Type != scopeMarkerNode; i-- {
 				if n := p.afe[i]; n.Type == ElementNode && n.Data == "a" {
+					p.parseError("unexpected-start-tag-implies-end-tag")
 					p.inBodyEndTagFormatting("a")
 					p.oe.remove(n)
 					p.afe.remove(n)
@@ -781,6 +993,7 @@ func inBodyIM(p *parser) bool {
 		case "nobr":
 			p.reconstructActiveFormattingElements()
 			if p.elementInScope(defaultScope, "nobr") {
+				p.parseError("unexpected-start-tag-implies-end-tag")
 				p.inBodyEndTagFormatting("nobr")
 				p.reconstructActiveFormattingElements()
 			}
@@ -791,8 +1004,8 @@ func inBodyIM(p *parser) bool {
 			p.afe = append(p.afe, &scopeMarker)
 			p.framesetOK = false
 		case "table":
-			if !p.quirks {
-				p.popUntil(buttonScope, "p")
+			if p.mode != Quirks {
+				p.closeP()
 			}
 			p.addElement(p.tok.Data, p.tok.Attr)
 			p.framesetOK = false
@@ -819,17 +1032,20 @@ func inBodyIM(p *parser) bool {
 			p.oe.pop()
 			p.acknowledgeSelfClosingTag()
 		case "hr":
-			p.popUntil(buttonScope, "p")
+			p.closeP()
 			p.addElement(p.tok.Data, p.tok.Attr)
 			p.oe.pop()
 			p.acknowledgeSelfClosingTag()
 			p.framesetOK = false
 		case "image":
+			p.parseError("unexpected-start-tag-treated-as")
 			p.tok.Data = "img"
 			return false
 		case "isindex":
+			p.parseError("deprecated-tag")
 			if p.form != nil {
 				// Ignore the token.
+				p.unexpected()
 				return true
 			}
 			action := ""
@@ -848,7 +1064,7 @@ func inBodyIM(p *parser) bool {
 				}
 			}
 			p.acknowledgeSelfClosingTag()
-			p.popUntil(buttonScope, "p")
+			p.closeP()
 			p.addElement("form", nil)
 			p.form = p.top()
 			if action != "" {
@@ -857,13 +1073,16 @@ func inBodyIM(p *parser) bool {
 			p.addElement("hr", nil)
 			p.oe.pop()
 			p.addElement("label", nil)
+			label := p.top()
 			p.addText(prompt)
 			p.addElement("input", attr)
 			p.oe.pop()
-			p.oe.pop()
+			// Past the maximum depth, the label and form may have been
+			// closed already.
+			p.oe.remove(label)
 			p.addElement("hr", nil)
 			p.oe.pop()
-			p.oe.pop()
+			p.oe.remove(p.form)
 			p.form = nil
 		case "textarea":
 			p.addElement(p.tok.Data, p.tok.Attr)
@@ -871,7 +1090,7 @@ func inBodyIM(p *parser) bool {
 			p.framesetOK = false
 			p.im = textIM
 		case "xmp":
-			p.popUntil(buttonScope, "p")
+			p.closeP()
 			p.reconstructActiveFormattingElements()
 			p.framesetOK = false
 			p.addElement(p.tok.Data, p.tok.Attr)
@@ -883,6 +1102,12 @@ func inBodyIM(p *parser) bool {
 			p.setOriginalIM()
 			p.im = textIM
 		case "noembed", "noscript":
+			if p.tok.Data == "noscript" && !p.scripting {
+				// Without scripting, a <noscript> is an ordinary element.
+				p.reconstructActiveFormattingElements()
+				p.addElement(p.tok.Data, p.tok.Attr)
+				break
+			}
 			p.addElement(p.tok.Data, p.tok.Attr)
 			p.setOriginalIM()
 			p.im = textIM
@@ -916,6 +1141,7 @@ func inBodyIM(p *parser) bool {
 			return true
 		case "caption", "col", "colgroup", "frame", "head", "tbody", "td", "tfoot", "th", "thead", "tr":
 			// Ignore the token.
+			p.unexpected()
 		default:
 			p.reconstructActiveFormattingElements()
 			p.addElement(p.tok.Data, p.tok.Attr)
@@ -924,15 +1150,23 @@ func inBodyIM(p *parser) bool {
 		switch p.tok.Data {
 		case "body":
 			if p.elementInScope(defaultScope, "body") {
+				p.checkOpenElements("expected-one-end-tag-but-got-another")
 				p.im = afterBodyIM
+			} else {
+				p.unexpected()
 			}
 		case "html":
 			if p.elementInScope(defaultScope, "body") {
+				p.checkOpenElements("expected-one-end-tag-but-got-another")
+				p.quiet = true
 				p.parseImpliedToken(EndTagToken, "body", nil)
+				p.quiet = false
 				return false
 			}
+			p.unexpected()
 			return true
 		case "address", "article", "aside", "blockquote", "button", "center", "details", "dir", "div", "dl", "fieldset", "figcaption", "figure", "footer", "header", "hgroup", "listing", "menu", "nav", "ol", "pre", "section", "summary", "ul":
+			p.checkEndTag(defaultScope, p.tok.Data)
 			p.popUntil(defaultScope, p.tok.Data)
 		case "form":
 			node := p.form
@@ -940,30 +1174,49 @@ func inBodyIM(p *parser) bool {
 			i := p.indexOfElementInScope(defaultScope, "form")
 			if node == nil || i == -1 || p.oe[i] != node {
 				// Ignore the token.
+				p.unexpected()
 				return true
 			}
 			p.generateImpliedEndTags()
+			if p.top() != node {
+				p.parseError("end-tag-too-early-ignored")
+			}
 			p.oe.remove(node)
 		case "p":
 			if !p.elementInScope(buttonScope, "p") {
+				p.parseError("unexpected-end-tag")
 				p.addElement("p", nil)
 			}
+			p.checkEndTag(buttonScope, "p")
 			p.popUntil(buttonScope, "p")
 		case "li":
+			p.checkEndTag(listItemScope, "li")
 			p.popUntil(listItemScope, "li")
 		case "dd", "dt":
+			p.checkEndTag(defaultScope, p.tok.Data)
 			p.popUntil(defaultScope, p.tok.Data)
 		case "h1", "h2", "h3", "h4", "h5", "h6":
+			if i := p.indexOfElementInScope(defaultScope, "h1", "h2", "h3", "h4", "h5", "h6"); i != -1 && p.oe[i].Data != p.tok.Data {
+				// The end tag closes a heading of another level.
+				p.parseError("end-tag-too-early")
+			} else {
+				p.checkEndTag(defaultScope, "h1", "h2", "h3", "h4", "h5", "h6")
+			}
 			p.popUntil(defaultScope, "h1", "h2", "h3", "h4", "h5", "h6")
 		case "a", "b", "big", "code", "em", "font", "i", "nobr", "s", "small", "strike", "strong", "tt", "u":
 			p.inBodyEndTagFormatting(p.tok.Data)
 		case "applet", "marquee", "object":
+			p.checkEndTag(defaultScope, p.tok.Data)
 			if p.popUntil(defaultScope, p.tok.Data) {
 				p.clearActiveFormattingElements()
 			}
 		case "br":
+			p.parseError("unexpected-end-tag-treated-as")
+			// Handle it here rather than reprocessing it, so that the
+			// foster parenting of a table doesn't see it twice.
 			p.tok.Type = StartTagToken
-			return false
+			p.tok.Attr = nil
+			return inBodyIM(p)
 		default:
 			p.inBodyEndTagOther(p.tok.Data)
 		}
@@ -972,6 +1225,9 @@ func inBodyIM(p *parser) bool {
 			Type: CommentNode,
 			Data: p.tok.Data,
 		})
+	case DoctypeToken:
+		// Ignore the token.
+		p.unexpected()
 	}
 
 	return true
@@ -1004,13 +1260,18 @@ func (p *parser) inBodyEndTagFormatting(tag string) {
 		}
 		feIndex := p.oe.index(formattingElement)
 		if feIndex == -1 {
+			p.parseError("adoption-agency-1.2")
 			p.afe.remove(formattingElement)
 			return
 		}
 		if !p.elementInScope(defaultScope, tag) {
 			// Ignore the tag.
+			p.parseError("adoption-agency-4.4")
 			return
 		}
+		if formattingElement != p.top() {
+			p.parseError("adoption-agency-1.3")
+		}
 
 		// Steps 5-6. Find the furthest block.
 		var furthestBlock *Node
@@ -1105,10 +1366,12 @@ func (p *parser) inBodyEndTagFormatting(tag string) {
 func (p *parser) inBodyEndTagOther(tag string) {
 	for i := len(p.oe) - 1; i >= 0; i-- {
 		if p.oe[i].Data == tag {
+			p.checkClosed(i, "end-tag-too-early")
 			p.oe = p.oe[:i]
 			break
 		}
 		if isSpecialElement(p.oe[i]) {
+			p.unexpected()
 			break
 		}
 	}
@@ -1118,6 +1381,7 @@ func (p *parser) inBodyEndTagOther(tag string) {
 func textIM(p *parser) bool {
 	switch p.tok.Type {
 	case ErrorToken:
+		p.parseError("expected-named-closing-tag-but-got-eof")
 		p.oe.pop()
 	case TextToken:
 		d := p.tok.Data
@@ -1183,17 +1447,20 @@ func inTableIM(p *parser) bool {
 			p.parseImpliedToken(StartTagToken, "tbody", nil)
 			return false
 		case "table":
+			p.parseError("unexpected-start-tag-implies-end-tag")
 			if p.popUntil(tableScope, "table") {
 				p.resetInsertionMode()
 				return false
 			}
 			// Ignore the token.
+			p.unexpected()
 			return true
 		case "style", "script":
 			return inHeadIM(p)
 		case "input":
 			for _, a := range p.tok.Attr {
 				if a.Key == "type" && strings.ToLower(a.Val) == "hidden" {
+					p.parseError("unexpected-hidden-input-in-table")
 					p.addElement(p.tok.Data, p.tok.Attr)
 					p.oe.pop()
 					return true
@@ -1201,13 +1468,16 @@ func inTableIM(p *parser) bool {
 			}
 			// Otherwise drop down to the default action.
 		case "form":
+			p.parseError("unexpected-form-in-table")
 			if p.form != nil {
 				// Ignore the token.
 				return true
 			}
 			p.addElement(p.tok.Data, p.tok.Attr)
 			p.form = p.oe.pop()
+			return true
 		case "select":
+			p.parseError("unexpected-start-tag-implies-table-voodoo")
 			p.reconstructActiveFormattingElements()
 			switch p.top().Data {
 			case "table", "tbody", "tfoot", "thead", "tr":
@@ -1227,9 +1497,11 @@ func inTableIM(p *parser) bool {
 				return true
 			}
 			// Ignore the token.
+			p.unexpected()
 			return true
 		case "body", "caption", "col", "colgroup", "html", "tbody", "td", "tfoot", "th", "thead", "tr":
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case CommentToken:
@@ -1240,6 +1512,7 @@ func inTableIM(p *parser) bool {
 		return true
 	case DoctypeToken:
 		// Ignore the token.
+		p.unexpected()
 		return true
 	}
 
@@ -1249,6 +1522,14 @@ func inTableIM(p *parser) bool {
 		defer func() { p.fosterParenting = false }()
 	}
 
+	switch p.tok.Type {
+	case TextToken:
+		p.parseError("unexpected-char-implies-table-voodoo")
+	case StartTagToken:
+		p.parseError("unexpected-start-tag-implies-table-voodoo")
+	case EndTagToken:
+		p.parseError("unexpected-end-tag-implies-table-voodoo")
+	}
 	return inBodyIM(p)
 }
 
@@ -1258,14 +1539,17 @@ func inCaptionIM(p *parser) bool {
 	case StartTagToken:
 		switch p.tok.Data {
 		case "caption", "col", "colgroup", "tbody", "td", "tfoot", "thead", "tr":
-			if p.popUntil(tableScope, "caption") {
-				p.clearActiveFormattingElements()
-				p.im = inTableIM
-				return false
-			} else {
+			i := p.indexOfElementInScope(tableScope, "caption")
+			if i == -1 {
 				// Ignore the token.
+				p.unexpected()
 				return true
 			}
+			p.checkClosed(i, "unexpected-start-tag-implies-end-tag")
+			p.popUntil(tableScope, "caption")
+			p.clearActiveFormattingElements()
+			p.im = inTableIM
+			return false
 		case "select":
 			p.reconstructActiveFormattingElements()
 			p.addElement(p.tok.Data, p.tok.Attr)
@@ -1276,22 +1560,24 @@ func inCaptionIM(p *parser) bool {
 	case EndTagToken:
 		switch p.tok.Data {
 		case "caption":
+			p.checkEndTag(tableScope, "caption")
 			if p.popUntil(tableScope, "caption") {
 				p.clearActiveFormattingElements()
 				p.im = inTableIM
 			}
 			return true
 		case "table":
+			p.checkEndTag(tableScope, "caption")
 			if p.popUntil(tableScope, "caption") {
 				p.clearActiveFormattingElements()
 				p.im = inTableIM
 				return false
-			} else {
-				// Ignore the token.
-				return true
 			}
+			// Ignore the token.
+			return true
 		case "body", "col", "colgroup", "html", "tbody", "td", "tfoot", "th", "thead", "tr":
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	}
@@ -1319,6 +1605,7 @@ func inColumnGroupIM(p *parser) bool {
 		return true
 	case DoctypeToken:
 		// Ignore the token.
+		p.unexpected()
 		return true
 	case StartTagToken:
 		switch p.tok.Data {
@@ -1340,6 +1627,7 @@ func inColumnGroupIM(p *parser) bool {
 			return true
 		case "col":
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	}
@@ -1362,6 +1650,7 @@ func inTableBodyIM(p *parser) bool {
 			p.im = inRowIM
 			return true
 		case "td", "th":
+			p.parseError("unexpected-cell-in-table-body")
 			p.parseImpliedToken(StartTagToken, "tr", nil)
 			return false
 		case "caption", "col", "colgroup", "tbody", "tfoot", "thead":
@@ -1370,6 +1659,7 @@ func inTableBodyIM(p *parser) bool {
 				return false
 			}
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case EndTagToken:
@@ -1379,6 +1669,8 @@ func inTableBodyIM(p *parser) bool {
 				p.clearStackToContext(tableBodyScope)
 				p.oe.pop()
 				p.im = inTableIM
+			} else {
+				p.unexpected()
 			}
 			return true
 		case "table":
@@ -1387,9 +1679,11 @@ func inTableBodyIM(p *parser) bool {
 				return false
 			}
 			// Ignore the token.
+			p.unexpected()
 			return true
 		case "body", "caption", "col", "colgroup", "html", "td", "th", "tr":
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case CommentToken:
@@ -1420,6 +1714,7 @@ func inRowIM(p *parser) bool {
 				return false
 			}
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	case EndTagToken:
@@ -1430,6 +1725,7 @@ func inRowIM(p *parser) bool {
 				return true
 			}
 			// Ignore the token.
+			p.unexpected()
 			return true
 		case "table":
 			if p.popUntil(tableScope, "tr") {
@@ -1437,6 +1733,7 @@ func inRowIM(p *parser) bool {
 				return false
 			}
 			// Ignore the token.
+			p.unexpected()
 			return true
 		case "tbody", "tfoot", "thead":
 			if p.elementInScope(tableScope, p.tok.Data) {
@@ -1444,9 +1741,11 @@ func inRowIM(p *parser) bool {
 				return false
 			}
 			// Ignore the token.
+			p.unexpected()
 			return true
 		case "body", "caption", "col", "colgroup", "html", "td", "th":
 			// Ignore the token.
+			p.unexpected()
 			return true
 		}
 	}
@@ -1460,13 +1759,13 @@ func inCellIM(p *parser) bool {
 	case StartTagToken:
 		switch p.tok.Data {
 		case "caption", "col", "colgroup", "tbody", "td", "tfoot", "th", "thead", "tr":
-			if p.popUntil(tableScope, "td", "th") {
+			if p.elementInScope(tableScope, "td", "th") {
 				// Close the cell and reprocess.
-				p.clearActiveFormattingElements()
-				p.im = inRowIM
+				p.closeCell()
 				return false
 			}
 			// Ignore the token.
+			p.unexpected()
 			return true
 		case "select":
 			p.reconstructActiveFormattingElements()
@@ -1478,6 +1777,7 @@ func inCellIM(p *parser) bool {
 	case EndTagToken:
 		switch p.tok.Data {
 		case "td", "th":
+			p.checkEndTag(tableScope, p.tok.Data)
 			if !p.popUntil(tableScope, p.tok.Data) {
 				// Ignore the token.
 				return true
@@ -1487,22 +1787,31 @@ func inCellIM(p *parser) bool {
 			return true
 		case "body", "caption", "col", "colgroup", "html":
 			// Ignore the token.
+			p.unexpected()
 			return true
 		case "table", "tbody", "tfoot", "thead", "tr":
 			if !p.elementInScope(tableScope, p.tok.Data) {
 				// Ignore the token.
+				p.unexpected()
 				return true
 			}
 			// Close the cell and reprocess.
-			p.popUntil(tableScope, "td", "th")
-			p.clearActiveFormattingElements()
-			p.im = inRowIM
+			p.closeCell()
 			return false
 		}
 	}
 	return inBodyIM(p)
 }
 
+// closeCell closes the td or th element in table scope, whose content has
+// ended, and switches to the "in row" insertion mode.
+func (p *parser) closeCell() {
+	p.checkClosed(p.indexOfElementInScope(tableScope, "td", "th"), "unexpected-cell-end-tag")
+	p.popUntil(tableScope, "td", "th")
+	p.clearActiveFormattingElements()
+	p.im = inRowIM
+}
+
 // Section 12.2.5.4.16.
 func inSelectIM(p *parser) bool {
 	switch p.tok.Type {
@@ -1529,9 +1838,11 @@ func inSelectIM(p *parser) bool {
 			}
 			p.addElement(p.tok.Data, p.tok.Attr)
 		case "select":
+			p.parseError("unexpected-select-in-select")
 			p.tok.Type = EndTagToken
 			return false
 		case "input", "keygen", "textarea":
+			p.unexpected()
 			if p.elementInScope(selectScope, "select") {
 				p.parseImpliedToken(EndTagToken, "select", nil)
 				return false
@@ -1540,12 +1851,17 @@ func inSelectIM(p *parser) bool {
 			return true
 		case "script":
 			return inHeadIM(p)
+		default:
+			// Ignore the token.
+			p.unexpected()
 		}
 	case EndTagToken:
 		switch p.tok.Data {
 		case "option":
 			if p.top().Data == "option" {
 				p.oe.pop()
+			} else {
+				p.unexpected()
 			}
 		case "optgroup":
 			i := len(p.oe) - 1
@@ -1554,19 +1870,27 @@ func inSelectIM(p *parser) bool {
 			}
 			if p.oe[i].Data == "optgroup" {
 				p.oe = p.oe[:i]
+			} else {
+				p.unexpected()
 			}
 		case "select":
 			if p.popUntil(selectScope, "select") {
 				p.resetInsertionMode()
+			} else {
+				p.unexpected()
 			}
+		default:
+			// Ignore the token.
+			p.unexpected()
 		}
 	case CommentToken:
-		p.doc.Add(&Node{
+		p.doc.Add(p.positioned(&Node{
 			Type: CommentNode,
 			Data: p.tok.Data,
-		})
+		}))
 	case DoctypeToken:
 		// Ignore the token.
+		p.unexpected()
 		return true
 	}
 
@@ -1580,10 +1904,12 @@ func inSelectInTableIM(p *parser) bool {
 		switch p.tok.Data {
 		case "caption", "table", "tbody", "tfoot", "thead", "tr", "td", "th":
 			if p.tok.Type == StartTagToken || p.elementInScope(tableScope, p.tok.Data) {
+				p.unexpected()
 				p.parseImpliedToken(EndTagToken, "select", nil)
 				return false
 			} else {
 				// Ignore the token.
+				p.unexpected()
 				return true
 			}
 		}
@@ -1596,6 +1922,7 @@ func afterBodyIM(p *parser) bool {
 	switch p.tok.Type {
 	case ErrorToken:
 		// Stop parsing.
+		p.stopped = true
 		return true
 	case TextToken:
 		s := strings.TrimLeft(p.tok.Data, whitespace)
@@ -1617,12 +1944,17 @@ func afterBodyIM(p *parser) bool {
 		if len(p.oe) < 1 || p.oe[0].Data != "html" {
 			panic("html: bad parser state: <html> element not found, in the after-body insertion mode")
 		}
-		p.oe[0].Add(&Node{
+		p.oe[0].Add(p.positioned(&Node{
 			Type: CommentNode,
 			Data: p.tok.Data,
-		})
+		}))
+		return true
+	case DoctypeToken:
+		// Ignore the token.
+		p.unexpected()
 		return true
 	}
+	p.unexpected()
 	p.im = inBodyIM
 	return false
 }
@@ -1644,6 +1976,9 @@ func inFramesetIM(p *parser) bool {
 			}
 			return -1
 		}, p.tok.Data)
+		if s != p.tok.Data {
+			p.unexpected()
+		}
 		if s != "" {
 			p.addText(s)
 		}
@@ -1659,6 +1994,9 @@ func inFramesetIM(p *parser) bool {
 			p.acknowledgeSelfClosingTag()
 		case "noframes":
 			return inHeadIM(p)
+		default:
+			// Ignore the token.
+			p.unexpected()
 		}
 	case EndTagToken:
 		switch p.tok.Data {
@@ -1669,10 +2007,16 @@ func inFramesetIM(p *parser) bool {
 					p.im = afterFramesetIM
 					return true
 				}
+			} else {
+				p.unexpected()
 			}
+		default:
+			// Ignore the token.
+			p.unexpected()
 		}
 	default:
 		// Ignore the token.
+		p.unexpected()
 	}
 	return true
 }
@@ -1694,6 +2038,9 @@ func afterFramesetIM(p *parser) bool {
 			}
 			return -1
 		}, p.tok.Data)
+		if s != p.tok.Data {
+			p.unexpected()
+		}
 		if s != "" {
 			p.addText(s)
 		}
@@ -1703,15 +2050,22 @@ func afterFramesetIM(p *parser) bool {
 			return inBodyIM(p)
 		case "noframes":
 			return inHeadIM(p)
+		default:
+			// Ignore the token.
+			p.unexpected()
 		}
 	case EndTagToken:
 		switch p.tok.Data {
 		case "html":
 			p.im = afterAfterFramesetIM
 			return true
+		default:
+			// Ignore the token.
+			p.unexpected()
 		}
 	default:
 		// Ignore the token.
+		p.unexpected()
 	}
 	return true
 }
@@ -1721,6 +2075,7 @@ func afterAfterBodyIM(p *parser) bool {
 	switch p.tok.Type {
 	case ErrorToken:
 		// Stop parsing.
+		p.stopped = true
 		return true
 	case TextToken:
 		s := strings.TrimLeft(p.tok.Data, whitespace)
@@ -1733,14 +2088,15 @@ func afterAfterBodyIM(p *parser) bool {
 			return inBodyIM(p)
 		}
 	case CommentToken:
-		p.doc.Add(&Node{
+		p.doc.Add(p.positioned(&Node{
 			Type: CommentNode,
 			Data: p.tok.Data,
-		})
+		}))
 		return true
 	case DoctypeToken:
 		return inBodyIM(p)
 	}
+	p.unexpected()
 	p.im = inBodyIM
 	return false
 }
@@ -1749,10 +2105,10 @@ func afterAfterBodyIM(p *parser) bool {
 func afterAfterFramesetIM(p *parser) bool {
 	switch p.tok.Type {
 	case CommentToken:
-		p.doc.Add(&Node{
+		p.doc.Add(p.positioned(&Node{
 			Type: CommentNode,
 			Data: p.tok.Data,
-		})
+		}))
 	case TextToken:
 		// Ignore all text but whitespace.
 		s := strings.Map(func(c rune) rune {
@@ -1762,6 +2118,9 @@ func afterAfterFramesetIM(p *parser) bool {
 			}
 			return -1
 		}, p.tok.Data)
+		if s != p.tok.Data {
+			p.unexpected()
+		}
 		if s != "" {
 			p.tok.Data = s
 			return inBodyIM(p)
@@ -1772,11 +2131,15 @@ func afterAfterFramesetIM(p *parser) bool {
 			return inBodyIM(p)
 		case "noframes":
 			return inHeadIM(p)
+		default:
+			// Ignore the token.
+			p.unexpected()
 		}
 	case DoctypeToken:
 		return inBodyIM(p)
 	default:
 		// Ignore the token.
+		p.unexpected()
 	}
 	return true
 }
@@ -1808,6 +2171,7 @@ func parseForeignContent(p *parser) bool {
 			}
 		}
 		if b {
+			p.parseError("unexpected-html-element-in-foreign-content")
 			for i := len(p.oe) - 1; i >= 0; i-- {
 				n := p.oe[i]
 				if n.Namespace == "" || htmlIntegrationPoint(n) || mathMLTextIntegrationPoint(n) {
@@ -1839,6 +2203,9 @@ func parseForeignContent(p *parser) bool {
 			p.acknowledgeSelfClosingTag()
 		}
 	case EndTagToken:
+		if !strings.EqualFold(p.top().Data, p.tok.Data) {
+			p.unexpected()
+		}
 		for i := len(p.oe) - 1; i >= 0; i-- {
 			if p.oe[i].Namespace == "" {
 				return p.im(p)
@@ -1851,6 +2218,7 @@ func parseForeignContent(p *parser) bool {
 		return true
 	default:
 		// Ignore the token.
+		p.unexpected()
 	}
 	return true
 }
@@ -1916,8 +2284,11 @@ func (p *parser) parseCurrentToken() {
 	}
 
 	if p.hasSelfClosingToken {
+		p.parseError("non-void-element-with-trailing-solidus")
 		p.hasSelfClosingToken = false
+		p.quiet = true
 		p.parseImpliedToken(EndTagToken, p.tok.Data, nil)
+		p.quiet = false
 	}
 }
 
@@ -1925,50 +2296,196 @@ func (p *parser) parse() error {
 	// Iterate until EOF. Any other error will cause an early return.
 	var err error
 	for err != io.EOF {
+		if p.stopAtLimit && p.truncated != "" {
+			break
+		}
 		err = p.read()
 		if err != nil && err != io.EOF {
 			return err
 		}
+		if p.tok.Type != EndTagToken || !p.positions {
+			p.parseCurrentToken()
+			continue
+		}
+		p.oeBefore = append(p.oeBefore[:0], p.oe...)
 		p.parseCurrentToken()
+		p.closedBy(p.tok.Data)
+	}
+	if !p.stopped {
+		p.checkOpenElements("expected-closing-tag-but-got-eof")
+	}
+	p.doc.Start = Position{Line: 1, Column: 1}
+	p.doc.End = p.end
+	if p.positions {
+		extendEnds(p.doc)
 	}
 	return nil
 }
 
+// closedBy extends the element closed by the end tag called name to the
+// end of the tag. That is the outermost element of that name that was
+// popped off the stack of open elements, or for </body> and </html>, which
+// leave their element open for what may follow, the element itself.
+func (p *parser) closedBy(name string) {
+	// The elements below the first one that changed are still open, and
+	// only those above it are looked up among the open elements.
+	i := 0
+	for i < len(p.oeBefore) && i < len(p.oe) && p.oeBefore[i] == p.oe[i] {
+		i++
+	}
+	var open map[*Node]bool
+	for _, n := range p.oeBefore[i:] {
+		if !strings.EqualFold(n.Data, name) {
+			continue
+		}
+		if open == nil {
+			open = make(map[*Node]bool, len(p.oe)-i)
+			for _, m := range p.oe[i:] {
+				open[m] = true
+			}
+		}
+		if !open[n] {
+			n.End = p.end
+			return
+		}
+	}
+	if name == "body" || name == "html" {
+		for _, n := range p.oe {
+			if n.Data == name && n.End.Offset < p.end.Offset {
+				n.End = p.end
+			}
+		}
+	}
+}
+
+// extendEnds moves the end of each node in the tree rooted at n past the
+// end of its last descendant.
+func extendEnds(n *Node) {
+	for _, c := range n.Child {
+		extendEnds(c)
+		if c.End.Offset > n.End.Offset {
+			n.End = c.End
+		}
+	}
+}
+
+// ParseOptions control ParseWithOptions. The zero value parses a document
+// as Parse does.
+type ParseOptions struct {
+	// DisableScripting parses the document as a browser with scripting
+	// disabled would: the content of noscript elements is markup instead
+	// of text.
+	DisableScripting bool
+	// Fragment parses a fragment of HTML, as ParseFragment does, instead of
+	// a document. Context is the element whose InnerHTML the fragment is,
+	// if any.
+	Fragment bool
+	Context  *Node
+	// Errors records the parse errors of the input in ParseResult.Errors.
+	Errors bool
+	// Positions extends the End of each element past its end tag, or past
+	// its last descendant if it was closed implicitly, as Node describes.
+	// Without it, an element ends with its start tag, which saves looking
+	// up the element each end tag closes.
+	Positions bool
+	// MaxDepth, MaxNodes and MaxAttributes, if positive, bound the parse
+	// tree of hostile or broken input. Past MaxDepth open elements, new
+	// elements are added next to the current node instead of in it, as
+	// browsers do, and close it. Once the tree holds MaxNodes nodes, the
+	// rest of the input is ignored. Attributes past the first
+	// MaxAttributes of a tag are dropped. ParseResult.Truncated tells
+	// whether any of them was reached. StopAtLimit ends the parse there,
+	// for callers that refuse such input rather than use what fits.
+	MaxDepth      int
+	MaxNodes      int
+	MaxAttributes int
+	StopAtLimit   bool
+}
+
+// A ParseResult is what ParseWithOptions found in its input.
+type ParseResult struct {
+	// Doc is the parse tree of a document. It is nil for fragments.
+	Doc *Node
+	// Nodes are the top-level nodes of a fragment.
+	Nodes []*Node
+	// Mode is the document mode selected by the doctype of a document, or
+	// the lack of one. Fragments are always parsed in no-quirks mode.
+	Mode DocumentMode
+	// Errors are the parse errors of the input, in the order they were
+	// found, if they were asked for.
+	Errors []*ParseError
+	// Truncated names the first bound of ParseOptions that the input
+	// exceeded, "depth", "nodes" or "attributes", and is empty if the tree
+	// holds all of it.
+	Truncated string
+}
+
 // Parse returns the parse tree for the HTML from the given Reader.
 // The input is assumed to be UTF-8 encoded.
 func Parse(r io.Reader) (*Node, error) {
+	res, err := ParseWithOptions(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Doc, nil
+}
+
+// ParseWithOptions parses the HTML from the given Reader as opts select.
+// A nil opts selects the defaults. The input is assumed to be UTF-8
+// encoded.
+func ParseWithOptions(r io.Reader, opts *ParseOptions) (*ParseResult, error) {
+	if opts == nil {
+		opts = &ParseOptions{}
+	}
 	p := &parser{
 		tokenizer: NewTokenizer(r),
 		doc: &Node{
 			Type: DocumentNode,
 		},
-		scripting:  true,
-		framesetOK: true,
-		im:         initialIM,
-	}
-	err := p.parse()
-	if err != nil {
+		scripting:     !opts.DisableScripting,
+		framesetOK:    true,
+		im:            initialIM,
+		collectErrors: opts.Errors,
+		positions:     opts.Positions,
+		maxDepth:      opts.MaxDepth,
+		maxNodes:      opts.MaxNodes,
+		maxAttributes: opts.MaxAttributes,
+		stopAtLimit:   opts.StopAtLimit,
+	}
+	if opts.Fragment {
+		return p.parseFragment(opts.Context)
+	}
+	if err := p.parse(); err != nil {
 		return nil, err
 	}
-	return p.doc, nil
+	return &ParseResult{Doc: p.doc, Mode: p.mode, Errors: p.errors, Truncated: p.truncated}, nil
 }
 
-// ParseFragment parses a fragment of HTML and returns the nodes that were 
+// ParseFragment parses a fragment of HTML and returns the nodes that were
 // found. If the fragment is the InnerHTML for an existing element, pass that
 // element in context.
 func ParseFragment(r io.Reader, context *Node) ([]*Node, error) {
-	p := &parser{
-		tokenizer: NewTokenizer(r),
-		doc: &Node{
-			Type: DocumentNode,
-		},
-		scripting: true,
-		context:   context,
+	res, err := ParseWithOptions(r, &ParseOptions{Fragment: true, Context: context})
+	if err != nil {
+		return nil, err
 	}
+	return res.Nodes, nil
+}
+
+// parseFragment parses the fragment of HTML whose InnerHTML is context, if
+// not nil.
+func (p *parser) parseFragment(context *Node) (*ParseResult, error) {
+	p.framesetOK = false
+	p.im = nil
+	p.context = context
 
 	if context != nil {
 		switch context.Data {
-		case "iframe", "noembed", "noframes", "noscript", "plaintext", "script", "style", "title", "textarea", "xmp":
+		case "noscript":
+			if p.scripting {
+				p.tokenizer.rawTag = context.Data
+			}
+		case "iframe", "noembed", "noframes", "plaintext", "script", "style", "title", "textarea", "xmp":
 			p.tokenizer.rawTag = context.Data
 		}
 	}
@@ -2003,5 +2520,5 @@ func ParseFragment(r io.Reader, context *Node) ([]*Node, error) {
 	for _, n := range result {
 		n.Parent = nil
 	}
-	return result, nil
+	return &ParseResult{Nodes: result, Mode: p.mode, Errors: p.errors, Truncated: p.truncated}, nil
 }
@@ -19,22 +19,23 @@ import (
 
 var updateLogs = flag.Bool("update-logs", false, "Update the log files that show the test results")
 
-// readParseTest reads a single test case from r.
-func readParseTest(r *bufio.Reader) (text, want, context string, err error) {
+// readParseTest reads a single test case from r. errs are the lines of its
+// #errors section.
+func readParseTest(r *bufio.Reader) (text, want, context string, errs []string, err error) {
 	line, err := r.ReadSlice('\n')
 	if err != nil {
-		return "", "", "", err
+		return "", "", "", nil, err
 	}
 	var b []byte
 
 	// Read the HTML.
 	if string(line) != "#data\n" {
-		return "", "", "", fmt.Errorf(`got %q want "#data\n"`, line)
+		return "", "", "", nil, fmt.Errorf(`got %q want "#data\n"`, line)
 	}
 	for {
 		line, err = r.ReadSlice('\n')
 		if err != nil {
-			return "", "", "", err
+			return "", "", "", nil, err
 		}
 		if line[0] == '#' {
 			break
@@ -44,41 +45,42 @@ func readParseTest(r *bufio.Reader) (text, want, context string, err error) {
 	text = strings.TrimRight(string(b), "\n")
 	b = b[:0]
 
-	// Skip the error list.
+	// Read the error list.
 	if string(line) != "#errors\n" {
-		return "", "", "", fmt.Errorf(`got %q want "#errors\n"`, line)
+		return "", "", "", nil, fmt.Errorf(`got %q want "#errors\n"`, line)
 	}
 	for {
 		line, err = r.ReadSlice('\n')
 		if err != nil {
-			return "", "", "", err
+			return "", "", "", nil, err
 		}
 		if line[0] == '#' {
 			break
 		}
+		errs = append(errs, strings.TrimRight(string(line), "\n"))
 	}
 
 	if string(line) == "#document-fragment\n" {
 		line, err = r.ReadSlice('\n')
 		if err != nil {
-			return "", "", "", err
+			return "", "", "", nil, err
 		}
 		context = strings.TrimSpace(string(line))
 		line, err = r.ReadSlice('\n')
 		if err != nil {
-			return "", "", "", err
+			return "", "", "", nil, err
 		}
 	}
 
 	// Read the dump of what the parse tree should be.
 	if string(line) != "#document\n" {
-		return "", "", "", fmt.Errorf(`got %q want "#document\n"`, line)
+		return "", "", "", nil, fmt.Errorf(`got %q want "#document\n"`, line)
 	}
 	inQuote := false
 	for {
 		line, err = r.ReadSlice('\n')
 		if err != nil && err != io.EOF {
-			return "", "", "", err
+			return "", "", "", nil, err
 		}
 		trimmed := bytes.Trim(line, "| \n")
 		if len(trimmed) > 0 {
@@ -94,7 +96,7 @@ func readParseTest(r *bufio.Reader) (text, want, context string, err error) {
 		}
 		b = append(b, line...)
 	}
-	return text, string(b), context, nil
+	return text, string(b), context, errs, nil
 }
 
 func dumpIndent(w io.Writer, level int) {
@@ -238,7 +240,7 @@ func TestParser(t *testing.T) {
 		defer lf.Close()
 
 		for i := 0; ; i++ {
-			text, want, context, err := readParseTest(r)
+			text, want, context, _, err := readParseTest(r)
 			if err == io.EOF {
 				break
 			}
@@ -373,3 +375,550 @@ var renderTestBlacklist = map[string]bool{
 	// A <plaintext> element can't have anything after it in HTML.
 	`<table><plaintext><td>`: true,
 }
+
+func TestParserPos(t *testing.T) {
+	input := "<!DOCTYPE html>\n<title>t</title>\n<div>a<b>b</div>c<!-- x --><p>d"
+	res, err := ParseWithOptions(strings.NewReader(input), &ParseOptions{Positions: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := res.Doc
+	var got []string
+	var f func(n *Node)
+	f = func(n *Node) {
+		got = append(got, fmt.Sprintf("%s %v-%v", describe(n), n.Start, n.End))
+		for _, c := range n.Child {
+			f(c)
+		}
+	}
+	f(doc)
+	want := []string{
+		"document 1:1-3:32",
+		"doctype html 1:1-1:16",
+		"<html> 2:1-3:32",
+		"<head> 2:1-3:1",
+		"<title> 2:1-2:17",
+		`"t" 2:8-2:9`,
+		`"\n" 2:17-3:1`,
+		"<body> 3:1-3:32",
+		"<div> 3:1-3:17",
+		`"a" 3:6-3:7`,
+		// Closed implicitly by </div>, and then reopened as a clone.
+		"<b> 3:7-3:11",
+		`"b" 3:10-3:11`,
+		"<b> 3:7-3:32",
+		`"c" 3:17-3:18`,
+		"comment  x  3:18-3:28",
+		"<p> 3:28-3:32",
+		`"d" 3:31-3:32`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// describe returns a short description of n for TestParserPos.
+func describe(n *Node) string {
+	switch n.Type {
+	case DocumentNode:
+		return "document"
+	case DoctypeNode:
+		return "doctype " + n.Data
+	case ElementNode:
+		return "<" + n.Data + ">"
+	case TextNode:
+		return fmt.Sprintf("%q", n.Data)
+	case CommentNode:
+		return "comment " + n.Data
+	}
+	return "?"
+}
+
+// errorsLogName lists the documents whose #errors sections are skipped,
+// each with the reason its errors differ from the current spec.
+const errorsLogName = testLogDir + "errors.log"
+
+// TestParseErrors checks the number of errors ParseWithErrors reports
+// against the #errors sections of the test data, and that a missing
+// doctype is reported first. Documents listed without errors are not
+// checked. The sections come from several parsers and versions of the
+// spec, so the documents whose lists predate it are skipped, as recorded
+// in errors.log. Documents the parser gets wrong, according to the logs,
+// are skipped too.
+func TestParseErrors(t *testing.T) {
+	skip := map[string]string{}
+	lf, err := os.Open(errorsLogName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	lbr := bufio.NewReader(lf)
+	for {
+		var name, text string
+		if _, err := fmt.Fscanf(lbr, "%s %q", &name, &text); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		reason, err := lbr.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(reason) == "" {
+			t.Fatalf("%s: %s %q has no reason", errorsLogName, name, text)
+		}
+		skip[name+" "+text] = reason
+	}
+
+	testFiles, err := filepath.Glob(testDataDir + "*.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tf := range testFiles {
+		f, err := os.Open(tf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		r := bufio.NewReader(f)
+
+		name := tf[len(testDataDir):]
+		lf, err := os.Open(testLogDir + name + ".log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lf.Close()
+		lbr := bufio.NewReader(lf)
+
+		for i := 0; ; i++ {
+			text, _, context, want, err := readParseTest(r)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result, logText string
+			if _, err := fmt.Fscanf(lbr, "%s %q\n", &result, &logText); err != nil {
+				t.Fatal(err)
+			}
+			if result == "FAIL" || context != "" || len(want) == 0 {
+				continue
+			}
+			_, got, err := ParseWithErrors(strings.NewReader(text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasSuffix(want[0], "Expected DOCTYPE.") && (len(got) == 0 || !strings.HasPrefix(got[0].Code, "expected-doctype-but-got-")) {
+				t.Errorf("%s test #%d %q: got %v, want a missing doctype first", tf, i, text, got)
+			}
+			key := name + " " + text
+			if _, ok := skip[key]; ok {
+				delete(skip, key)
+				if len(got) == len(want) {
+					t.Errorf("%s test #%d %q: got %d errors, as many as listed, but %s skips it", tf, i, text, len(got), errorsLogName)
+				}
+				continue
+			}
+			if len(got) != len(want) {
+				t.Errorf("%s test #%d %q: got %d errors %v, want %d %q", tf, i, text, len(got), got, len(want), want)
+			}
+		}
+	}
+	for key := range skip {
+		t.Errorf("%s: %s is not a document with errors listed", errorsLogName, key)
+	}
+}
+
+func TestParseErrorCodes(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"<!DOCTYPE html><title>t</title><p>a &amp; b<br/><img src=x alt=''></p>", nil},
+		{"<!doctype html><html><head></head><body><ul><li>a<li>b</ul></body></html>", nil},
+		{"<p>a", []string{"1:1: expected-doctype-but-got-start-tag (p)"}},
+		{"<!DOCTYPE html><p id=a id=b>", []string{"1:16: duplicate-attribute (p)"}},
+		{"<!DOCTYPE html><div><span></div>", []string{"1:27: end-tag-too-early (div)"}},
+		{"<!DOCTYPE html></span>", []string{"1:16: unexpected-end-tag (span)"}},
+		{"<!DOCTYPE html><b><i></b></i>", []string{
+			"1:22: adoption-agency-1.3 (b)",
+			// The <i> was closed along with the <b>.
+			"1:26: adoption-agency-1.2 (i)",
+		}},
+		{"<!DOCTYPE html><div>", []string{"1:21: expected-closing-tag-but-got-eof"}},
+		{"<!DOCTYPE html><div/>x", []string{"1:16: non-void-element-with-trailing-solidus (div)"}},
+		{"<!DOCTYPE html>\n<table>x</table>", []string{"2:8: unexpected-char-implies-table-voodoo"}},
+		{"<!DOCTYPE html>a &amp b &#0; &#x41", []string{
+			"1:16: named-entity-without-semicolon",
+			"1:16: illegal-codepoint-for-numeric-entity",
+			"1:16: numeric-entity-without-semicolon",
+		}},
+		{"<!DOCTYPE html><!-- x", []string{"1:16: eof-in-comment"}},
+		{"<!DOCTYPE html><table><caption>x</table>", nil},
+		{"<!DOCTYPE html><table><caption><b>x<tr></table>", []string{"1:36: unexpected-start-tag-implies-end-tag (tr)"}},
+		{"<!DOCTYPE html><table><tr><td></th></table>", []string{"1:31: unexpected-end-tag (th)"}},
+		{"<!DOCTYPE html><table><tr><td><i>x</table>", []string{"1:35: unexpected-cell-end-tag (table)"}},
+		{"<!DOCTYPE html><select><input>", []string{"1:24: unexpected-start-tag (input)"}},
+		{"<!DOCTYPE html><a href=x/ title='y'class=z>", []string{
+			"1:16: unexpected-character-after-attribute-value (a)",
+			"1:44: expected-closing-tag-but-got-eof",
+		}},
+		{"<!DOCTYPE html><p><b><div>", []string{
+			// The <div> closed the <p> with the <b> still open.
+			"1:22: unexpected-start-tag-implies-end-tag (div)",
+			"1:27: expected-closing-tag-but-got-eof",
+		}},
+		{"<!DOCTYPE html><h1>x</h2>", []string{"1:21: end-tag-too-early (h2)"}},
+		{"<!DOCTYPE html><table><select></select></table>", []string{"1:23: unexpected-start-tag-implies-table-voodoo (select)"}},
+		{"<!DOCTYPE html><table><form><tr><td>x</table>", []string{"1:23: unexpected-form-in-table (form)"}},
+		{"<!DOCTYPE html><table></br></table>", []string{
+			"1:23: unexpected-end-tag-implies-table-voodoo (br)",
+			"1:23: unexpected-end-tag-treated-as (br)",
+		}},
+		{"<!DOCTYPE html><font><p><b>x</font>", []string{
+			// One for each pass of the adoption agency's outer loop.
+			"1:29: adoption-agency-1.3 (font)",
+			"1:29: adoption-agency-1.3 (font)",
+		}},
+		{"<!DOCTYPE html><div></body>", []string{"1:21: expected-one-end-tag-but-got-another (body)"}},
+		{"<!DOCTYPE html>a < b <>", []string{
+			"1:16: expected-tag-name",
+			"1:16: expected-tag-name-but-got-right-bracket",
+		}},
+		{"<!DOCTYPE html></", []string{"1:16: expected-closing-tag-but-got-eof"}},
+		{"<!doctype>", []string{
+			"1:1: expected-doctype-name-but-got-right-bracket",
+			"1:1: unknown-doctype",
+		}},
+		{"<!DOCTYPE html><!-- a <!-- b -->", []string{"1:16: unexpected-char-in-comment"}},
+		{"<!DOCTYPE html><a href=\"?a=1&copy=2\" title=\"&amp\"></a>", []string{"1:16: named-entity-without-semicolon (a)"}},
+	}
+	for _, test := range tests {
+		_, errs, err := ParseWithErrors(strings.NewReader(test.text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range errs {
+			got = append(got, strings.TrimPrefix(e.Error(), "html: "))
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%q: got\n%s\nwant\n%s", test.text, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
+
+func TestParseScripting(t *testing.T) {
+	tests := []struct {
+		text       string
+		want, noJS string
+		context    string
+	}{
+		{
+			"<head><noscript><link rel=x><p>a</noscript>",
+			`| <html>
+|   <head>
+|     <noscript>
+|       "<link rel=x><p>a"
+|   <body>
+`,
+			`| <html>
+|   <head>
+|     <noscript>
+|       <link>
+|         rel="x"
+|   <body>
+|     <p>
+|       "a"
+`,
+			"",
+		},
+		{
+			"<p><noscript><img src=x></noscript>",
+			`| <html>
+|   <head>
+|   <body>
+|     <p>
+|       <noscript>
+|         "<img src=x>"
+`,
+			`| <html>
+|   <head>
+|   <body>
+|     <p>
+|       <noscript>
+|         <img>
+|           src="x"
+`,
+			"",
+		},
+		{
+			"<b>a</b>",
+			`| "<b>a</b>"
+`,
+			`| <b>
+|   "a"
+`,
+			"noscript",
+		},
+	}
+	for _, test := range tests {
+		for _, disable := range []bool{false, true} {
+			opts := &ParseOptions{DisableScripting: disable}
+			if test.context != "" {
+				opts.Fragment = true
+				opts.Context = &Node{Type: ElementNode, Data: test.context}
+			}
+			res, err := ParseWithOptions(strings.NewReader(test.text), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := res.Doc
+			if opts.Fragment {
+				n = &Node{Type: DocumentNode}
+				for _, c := range res.Nodes {
+					n.Add(c)
+				}
+			}
+			got, err := dump(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := test.want
+			if disable {
+				want = test.noJS
+			}
+			if got != want {
+				t.Errorf("%q, scripting disabled %t: got\n%s\nwant\n%s", test.text, disable, got, want)
+			}
+		}
+	}
+}
+
+func TestDocumentMode(t *testing.T) {
+	tests := []struct {
+		text string
+		want DocumentMode
+	}{
+		{"<!DOCTYPE html><p>", NoQuirks},
+		{"<p>", Quirks},
+		{`<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01//EN" "http://www.w3.org/TR/html4/strict.dtd">`, NoQuirks},
+		{`<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN">`, Quirks},
+		{`<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN" "http://www.w3.org/TR/html4/loose.dtd">`, LimitedQuirks},
+		{`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">`, LimitedQuirks},
+		{`<!DOCTYPE HTML PUBLIC "-//IETF//DTD HTML 2.0//EN">`, Quirks},
+	}
+	for _, test := range tests {
+		res, err := ParseWithOptions(strings.NewReader(test.text), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Mode != test.want {
+			t.Errorf("%q: got %v, want %v", test.text, res.Mode, test.want)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		text      string
+		opts      ParseOptions
+		want      string
+		truncated string
+	}{
+		{
+			"<div><div><div><p>a</div>b",
+			ParseOptions{MaxDepth: 4},
+			`| <html>
+|   <head>
+|   <body>
+|     <div>
+|       <div>
+|       <div>
+|       <p>
+|         "a"
+|     "b"
+`,
+			"depth",
+		},
+		{
+			"<div><div><div><p>a</div>b",
+			ParseOptions{MaxDepth: 4, StopAtLimit: true},
+			`| <html>
+|   <head>
+|   <body>
+|     <div>
+|       <div>
+|       <div>
+`,
+			"depth",
+		},
+		{
+			"<p>a<p>b<p>c",
+			ParseOptions{MaxNodes: 6},
+			`| <html>
+|   <head>
+|   <body>
+|     <p>
+|       "a"
+|     <p>
+`,
+			"nodes",
+		},
+		{
+			"<p>a<p>b",
+			ParseOptions{MaxNodes: 7},
+			`| <html>
+|   <head>
+|   <body>
+|     <p>
+|       "a"
+|     <p>
+|       "b"
+`,
+			"",
+		},
+		{
+			`<p a=1 b=2 c=3>`,
+			ParseOptions{MaxAttributes: 2},
+			`| <html>
+|   <head>
+|   <body>
+|     <p>
+|       a="1"
+|       b="2"
+`,
+			"attributes",
+		},
+	}
+	for _, test := range tests {
+		res, err := ParseWithOptions(strings.NewReader(test.text), &test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := dump(res.Doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%q: got\n%s\nwant\n%s", test.text, got, test.want)
+		}
+		if res.Truncated != test.truncated {
+			t.Errorf("%q: got Truncated %q, want %q", test.text, res.Truncated, test.truncated)
+		}
+	}
+}
+
+// TestParseDepthLimit checks that the stack of open elements stops
+// growing past MaxDepth, without formatting elements being reconstructed
+// over and over, and that the html5lib test inputs parse with small
+// limits, as documents and as fragments, without the insertion modes
+// losing track of the elements they rely on.
+func TestParseDepthLimit(t *testing.T) {
+	p := &parser{
+		tokenizer:  NewTokenizer(strings.NewReader(strings.Repeat("<div><b><span>", 5000))),
+		doc:        &Node{Type: DocumentNode},
+		scripting:  true,
+		framesetOK: true,
+		im:         initialIM,
+		maxDepth:   8,
+	}
+	for err := error(nil); err != io.EOF; {
+		if err = p.read(); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		p.parseCurrentToken()
+		if len(p.oe) > p.maxDepth {
+			t.Fatalf("%d open elements with MaxDepth %d", len(p.oe), p.maxDepth)
+		}
+	}
+	if p.nodes > 3*5000+3 {
+		t.Errorf("%d nodes for 15000 start tags", p.nodes)
+	}
+
+	testFiles, err := filepath.Glob(testDataDir + "*.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inputs []string
+	for _, tf := range testFiles {
+		f, err := os.Open(tf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bufio.NewReader(f)
+		for {
+			text, _, _, _, err := readParseTest(r)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			inputs = append(inputs, text)
+		}
+		f.Close()
+	}
+	for _, depth := range []int{1, 2, 4} {
+		for _, context := range []string{"", "td", "select"} {
+			opts := &ParseOptions{MaxDepth: depth}
+			if context != "" {
+				opts.Fragment = true
+				opts.Context = &Node{Type: ElementNode, Data: context}
+			}
+			for _, text := range inputs {
+				if _, err := ParseWithOptions(strings.NewReader(text), opts); err != nil {
+					t.Errorf("%q with MaxDepth %d: %v", text, depth, err)
+				}
+			}
+		}
+	}
+}
+
+func TestParseFragmentRawText(t *testing.T) {
+	const text = `a &amp; <b>c</b></x>`
+	tests := []struct {
+		context, want string
+	}{
+		{"iframe", `a &amp; <b>c</b></x>`},
+		{"noembed", `a &amp; <b>c</b></x>`},
+		{"noframes", `a &amp; <b>c</b></x>`},
+		{"noscript", `a &amp; <b>c</b></x>`},
+		{"plaintext", `a &amp; <b>c</b></x>`},
+		{"script", `a &amp; <b>c</b></x>`},
+		{"style", `a &amp; <b>c</b></x>`},
+		{"xmp", `a &amp; <b>c</b></x>`},
+		// RCDATA decodes character references.
+		{"textarea", `a & <b>c</b></x>`},
+		{"title", `a & <b>c</b></x>`},
+	}
+	for _, test := range tests {
+		context := &Node{Type: ElementNode, Data: test.context}
+		nodes, err := ParseFragment(strings.NewReader(text), context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 || nodes[0].Type != TextNode || nodes[0].Data != test.want {
+			t.Errorf("<%s>: got %s, want the text %q", test.context, describeNodes(nodes), test.want)
+		}
+	}
+
+	// Up to the end tag of the context element, the text is raw.
+	context := &Node{Type: ElementNode, Data: "script"}
+	nodes, err := ParseFragment(strings.NewReader("a<b></script><i>c"), context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].Data != "a<b>" || nodes[1].Data != "i" {
+		t.Errorf("<script>: got %s, want a text and an <i>", describeNodes(nodes))
+	}
+}
+
+func describeNodes(nodes []*Node) string {
+	var s []string
+	for _, n := range nodes {
+		s = append(s, describe(n))
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
@@ -109,6 +109,36 @@ func (t Token) String() string {
 	return "Invalid(" + strconv.Itoa(int(t.Type)) + ")"
 }
 
+// A Position is a location in the input of a Tokenizer. Offset counts
+// bytes from 0; Line and Column count from 1, where columns are measured in
+// characters rather than bytes and lines end at "\n", "\r\n" or "\r".
+// The zero Position means that the location is unknown.
+type Position struct {
+	Offset, Line, Column int
+}
+
+func (p Position) String() string {
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+}
+
+// advance returns the position after the bytes b that follow p.
+func (p Position) advance(b []byte) Position {
+	p.Offset += len(b)
+	for i, c := range b {
+		switch {
+		case c == '\n' && i > 0 && b[i-1] == '\r':
+			// The line already ended at the '\r'.
+		case c == '\n' || c == '\r':
+			p.Line++
+			p.Column = 1
+		case c&0xc0 != 0x80:
+			// c is not a continuation byte of a UTF-8 sequence.
+			p.Column++
+		}
+	}
+	return p
+}
+
 // span is a range of bytes in a Tokenizer's buffer. The start is inclusive,
 // the end is exclusive.
 type span struct {
@@ -149,6 +179,8 @@ type Tokenizer struct {
 	rawTag string
 	// textIsRaw is whether the current text token's data is not escaped.
 	textIsRaw bool
+	// start and end are the positions of the current token in the input.
+	start, end Position
 }
 
 // Err returns the error associated with the most recent ErrorToken token.
@@ -160,6 +192,15 @@ func (z *Tokenizer) Err() error {
 	return z.err
 }
 
+// NextIsNotRawText instructs the tokenizer that the next token should not be
+// considered as 'raw text'. The tokenizer looks for raw text after the start
+// tag of elements such as script and title, but whether it is right to
+// depends on the state of the parser: a <noscript> only holds raw text if
+// scripting is enabled.
+func (z *Tokenizer) NextIsNotRawText() {
+	z.rawTag = ""
+}
+
 // readByte returns the next byte from the input stream, doing a buffered read
 // from z.r into z.buf if necessary. z.buf[z.raw.start:z.raw.end] remains a contiguous byte
 // slice that holds all the bytes read so far for the current token.
@@ -197,9 +238,18 @@ func (z *Tokenizer) readByte() byte {
 		}
 		z.raw.start, z.raw.end, z.buf = 0, d, buf1[:d]
 		// Now that we have copied the live bytes to the start of the buffer,
-		// we read from z.r into the remainder.
+		// we read from z.r into the remainder. A Reader may return data
+		// together with an error such as io.EOF, so the bytes are kept and
+		// the error is only recorded once nothing more can be read.
 		n, err := z.r.Read(buf1[d:cap(buf1)])
-		if err != nil {
+		for i := 0; n == 0 && err == nil; i++ {
+			if i == 100 {
+				err = io.ErrNoProgress
+				break
+			}
+			n, err = z.r.Read(buf1[d:cap(buf1)])
+		}
+		if n == 0 {
 			z.err = err
 			return 0
 		}
@@ -581,7 +631,24 @@ func (z *Tokenizer) readTagAttrVal() {
 
 // Next scans the next token and returns its type.
 func (z *Tokenizer) Next() TokenType {
+	z.start = z.end
+	if z.next() != ErrorToken {
+		z.end = z.start.advance(z.buf[z.raw.start:z.raw.end])
+	}
+	return z.tt
+}
+
+// Pos returns the positions of the start of the current token and of the
+// byte just after it.
+func (z *Tokenizer) Pos() (start, end Position) {
+	return z.start, z.end
+}
+
+// next scans the next token and returns its type.
+func (z *Tokenizer) next() TokenType {
 	if z.err != nil {
+		// Leave nothing of the last token in Raw.
+		z.raw.start = z.raw.end
 		z.tt = ErrorToken
 		return z.tt
 	}
@@ -594,6 +661,7 @@ func (z *Tokenizer) Next() TokenType {
 			for z.err == nil {
 				z.readByte()
 			}
+			z.data.end = z.raw.end
 			z.textIsRaw = true
 		} else {
 			z.readRawOrRCDATA()
@@ -656,6 +724,7 @@ loop:
 			if c == '>' {
 				// "</>" does not generate a token at all.
 				// Reset the tokenizer state and start again.
+				z.start = z.start.advance(z.buf[z.raw.start:z.raw.end])
 				z.raw.start = z.raw.end
 				z.data.start = z.raw.end
 				z.data.end = z.raw.end
@@ -775,5 +844,6 @@ func NewTokenizer(r io.Reader) *Tokenizer {
 	return &Tokenizer{
 		r:   r,
 		buf: make([]byte, 0, 4096),
+		end: Position{Line: 1, Column: 1},
 	}
 }
@@ -6,9 +6,11 @@ package html
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 type tokenTest struct {
@@ -589,3 +591,47 @@ loop:
 		t.Errorf("TestBufAPI: want %q got %q", u, v)
 	}
 }
+
+func TestDataErrReader(t *testing.T) {
+	// iotest.DataErrReader returns the final bytes together with io.EOF.
+	z := NewTokenizer(iotest.DataErrReader(strings.NewReader("<p>a</p>")))
+	var got []string
+	for z.Next() != ErrorToken {
+		got = append(got, z.Token().String())
+	}
+	if z.Err() != io.EOF {
+		t.Errorf("got error %v, want io.EOF", z.Err())
+	}
+	if want := "<p>,a,</p>"; strings.Join(got, ",") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, ","), want)
+	}
+}
+
+func TestTokenizerPos(t *testing.T) {
+	// The padding makes the tokenizer refill its buffer mid-document.
+	pad := strings.Repeat("x", 5000)
+	input := "<p id=a>\r\nhé</>llo</p>\n<!-- c\n-->" + pad + "<br/>"
+	want := []string{
+		`<p id="a">:0:1:1-8:1:9`,
+		"\r\nhé:8:1:9-13:2:3",
+		"llo:16:2:6-19:2:9",
+		"</p>:19:2:9-23:2:13",
+		"\n:23:2:13-24:3:1",
+		"<!-- c\n-->:24:3:1-34:4:4",
+		"pad:34:4:4-5034:4:5004",
+		"<br/>:5034:4:5004-5039:4:5009",
+	}
+	z := NewTokenizer(iotest.OneByteReader(strings.NewReader(input)))
+	var got []string
+	for z.Next() != ErrorToken {
+		start, end := z.Pos()
+		s := z.Token().String()
+		if s == pad {
+			s = "pad"
+		}
+		got = append(got, fmt.Sprintf("%s:%d:%v-%d:%v", s, start.Offset, start, end.Offset, end))
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
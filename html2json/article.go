@@ -0,0 +1,71 @@
+package html2json
+
+import (
+	"exp/html"
+	"readability"
+)
+
+// An Article is the json value of a document converted with
+// Options.Article: the metadata of its main content, as found by package
+// readability, and the content itself, laid out as selected by the other
+// options.
+type Article struct {
+	Title     string `json:",omitempty"`
+	Byline    string `json:",omitempty"`
+	Published string `json:",omitempty"`
+	Image     string `json:",omitempty"`
+	Content   interface{}
+}
+
+// NewArticle returns the Article for the main content of the document doc,
+// sanitized if opts asks for it. A nil opts selects the defaults.
+func NewArticle(doc *html.Node, opts *Options) (*Article, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	a, err := extract(doc, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := Transform(a.Content, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Article{
+		Title:     a.Title,
+		Byline:    a.Byline,
+		Published: a.Published,
+		Image:     a.Image,
+		Content:   v,
+	}, nil
+}
+
+// extract returns the main content of the document doc, sanitized if opts
+// asks for it.
+func extract(doc *html.Node, opts *Options) (*readability.Article, error) {
+	a, err := readability.Extract(doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Sanitize != nil {
+		var nodes = opts.Sanitize.SanitizeNodes([]*html.Node{a.Content})
+
+		if len(nodes) != 1 || nodes[0] != a.Content {
+			// The policy does not allow the div holding the content.
+			a.Content = &html.Node{Type: html.ElementNode, Data: "div"}
+
+			for _, n := range nodes {
+				a.Content.Add(n)
+			}
+		}
+	}
+
+	return a, nil
+}
@@ -0,0 +1,66 @@
+package html2json
+
+import (
+	"exp/html"
+)
+
+// A Compact is the compact json representation of a document, element,
+// comment or doctype node. Text nodes are represented by their text alone.
+type Compact struct {
+	Type       string            `json:"type"`
+	Data       string            `json:"data,omitempty"`
+	Namespace  string            `json:"namespace,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Children   []interface{}     `json:"children,omitempty"`
+}
+
+var typeNames = map[html.NodeType]string{
+	html.ErrorNode:    "error",
+	html.TextNode:     "text",
+	html.DocumentNode: "document",
+	html.ElementNode:  "element",
+	html.CommentNode:  "comment",
+	html.DoctypeNode:  "doctype",
+}
+
+// TypeName returns the name of t used by the compact schema.
+func TypeName(t html.NodeType) string {
+	return typeNames[t]
+}
+
+// NewCompact returns the compact representation of the tree rooted at n:
+// a string for text nodes and a *Compact for everything else. Namespaced
+// attributes are keyed as "namespace:key".
+func NewCompact(n *html.Node) interface{} {
+	var data = clean(n.Data)
+
+	if n.Type == html.TextNode {
+		return data
+	}
+
+	var c = &Compact{
+		Type:      TypeName(n.Type),
+		Data:      data,
+		Namespace: n.Namespace,
+	}
+
+	if len(n.Attr) > 0 {
+		c.Attributes = make(map[string]string, len(n.Attr))
+	}
+
+	for _, a := range n.Attr {
+		var key = a.Key
+
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + key
+		}
+
+		c.Attributes[key] = a.Val
+	}
+
+	for _, child := range n.Child {
+		c.Children = append(c.Children, NewCompact(child))
+	}
+
+	return c
+}
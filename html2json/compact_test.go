@@ -0,0 +1,46 @@
+package html2json
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	v, err := ConvertWith(strings.NewReader(`<!DOCTYPE html><p id="a" class="">x<!--c--></p><svg><a xlink:href="#b"/></svg>`), &Options{Schema: CompactSchema})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `{"type":"document","children":[` +
+		`{"type":"doctype","data":"html"},` +
+		`{"type":"element","data":"html","children":[` +
+		`{"type":"element","data":"head"},` +
+		`{"type":"element","data":"body","children":[` +
+		`{"type":"element","data":"p","attributes":{"class":"","id":"a"},"children":["x",{"type":"comment","data":"c"}]},` +
+		`{"type":"element","data":"svg","namespace":"svg","children":[` +
+		`{"type":"element","data":"a","namespace":"svg","attributes":{"xlink:href":"#b"}}]}]}]}]}`
+
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	for name, want := range map[string]Schema{"": TagSchema, "tag": TagSchema, "compact": CompactSchema} {
+		if got, err := ParseSchema(name); got != want || err != nil {
+			t.Errorf("ParseSchema(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+
+	if _, err := ParseSchema("xml"); err == nil {
+		t.Errorf("ParseSchema(%q) succeeded, want an error", "xml")
+	}
+}
@@ -0,0 +1,227 @@
+package html2json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"exp/html"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var errNoType = errors.New("html2json: json value is neither a Tag nor a Compact node")
+
+// Node returns the html.Node tree described by t. Tags do not record the
+// namespace of foreign elements, so svg and math elements come back in the
+// html namespace.
+func (t *Tag) Node() *html.Node {
+	var n = &html.Node{
+		Type: t.Type,
+		Data: t.Data,
+		Attr: t.Attributes,
+	}
+
+	if t.Start != nil && t.End != nil {
+		n.Start, n.End = *t.Start, *t.End
+	}
+
+	for _, child := range t.Children {
+		n.Add(child.Node())
+	}
+
+	return n
+}
+
+// CompactNode returns the html.Node tree described by v, the result of
+// decoding a compact schema document into an interface{}.
+func CompactNode(v interface{}) (*html.Node, error) {
+	switch v := v.(type) {
+	case string:
+		return &html.Node{Type: html.TextNode, Data: v}, nil
+	case map[string]interface{}:
+		return compactElement(v)
+	}
+
+	return nil, fmt.Errorf("html2json: unexpected %T in compact document", v)
+}
+
+func compactElement(m map[string]interface{}) (*html.Node, error) {
+	var name, _ = m["type"].(string)
+	var n = &html.Node{}
+
+	if n.Type = nodeType(name); n.Type == html.ErrorNode {
+		return nil, fmt.Errorf("html2json: unknown node type %q", name)
+	}
+
+	n.Data, _ = m["data"].(string)
+	n.Namespace, _ = m["namespace"].(string)
+
+	attrs, _ := m["attributes"].(map[string]interface{})
+	keys := make([]string, 0, len(attrs))
+
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var a = html.Attribute{Key: key}
+
+		if i := strings.Index(key, ":"); i > 0 && isAttrNamespace(key[:i]) {
+			a.Namespace, a.Key = key[:i], key[i+1:]
+		}
+
+		a.Val, _ = attrs[key].(string)
+		n.Attr = append(n.Attr, a)
+	}
+
+	children, _ := m["children"].([]interface{})
+
+	for _, child := range children {
+		c, err := CompactNode(child)
+
+		if err != nil {
+			return nil, err
+		}
+
+		n.Add(c)
+	}
+
+	return n, nil
+}
+
+// isAttrNamespace reports whether prefix is one of the namespaces the
+// parser assigns to foreign attributes.
+func isAttrNamespace(prefix string) bool {
+	switch prefix {
+	case "xlink", "xml", "xmlns":
+		return true
+	}
+
+	return false
+}
+
+func nodeType(name string) html.NodeType {
+	for t, n := range typeNames {
+		if n == name && t != html.ErrorNode {
+			return t
+		}
+	}
+
+	return html.ErrorNode
+}
+
+// DecodeNode reads a json document in either schema from r and returns
+// the html.Node tree it describes.
+func DecodeNode(r io.Reader) (*html.Node, error) {
+	var raw json.RawMessage
+
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	return decodeValue(raw)
+}
+
+// DecodeNodes reads a json document in either schema from r, a single node
+// or a list of them such as a fragment converts to, and returns the
+// html.Node trees it describes in order.
+func DecodeNodes(r io.Reader) ([]*html.Node, error) {
+	var raw json.RawMessage
+
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(bytes.TrimLeft(raw, " \t\r\n"), []byte("[")) {
+		n, err := decodeValue(raw)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []*html.Node{n}, nil
+	}
+
+	var list []json.RawMessage
+
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+
+	var nodes = make([]*html.Node, 0, len(list))
+
+	for _, v := range list {
+		n, err := decodeValue(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, n)
+	}
+
+	return nodes, nil
+}
+
+// decodeValue returns the html.Node tree described by a json node in
+// either schema.
+func decodeValue(raw json.RawMessage) (*html.Node, error) {
+	// A Tag has a numeric Type, a Compact a string one. encoding/json
+	// matches field names case-insensitively, so this probes both.
+	var probe struct {
+		Type interface{}
+	}
+
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		var v interface{}
+
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+
+		return CompactNode(v)
+	}
+
+	switch probe.Type.(type) {
+	case float64:
+		var t Tag
+
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, err
+		}
+
+		return t.Node(), nil
+	case string:
+		var v interface{}
+
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+
+		return CompactNode(v)
+	}
+
+	return nil, errNoType
+}
+
+// Render reads a json document in either schema from r, a single node or
+// a list of them, and writes the html it describes to w.
+func Render(w io.Writer, r io.Reader) error {
+	nodes, err := DecodeNodes(r)
+
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if err := html.Render(w, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
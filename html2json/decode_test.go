@@ -0,0 +1,113 @@
+package html2json
+
+import (
+	"bytes"
+	"encoding/json"
+	"exp/html"
+	"strings"
+	"testing"
+)
+
+var roundTripTests = []string{
+	`<!DOCTYPE html><html><head><title>t &amp; u</title></head><body><p class="a" id="b">x<br/>y</p></body></html>`,
+	`<html><head></head><body><!-- comment --><ul><li>a</li><li>b</li></ul></body></html>`,
+	`<html><head><script>if (a < b) {}</script></head><body><pre>  x</pre><textarea>&lt;</textarea></body></html>`,
+	`<html><head></head><body><table><tbody><tr><td>1</td></tr></tbody></table></body></html>`,
+}
+
+func renderHTML(t *testing.T, n *html.Node) string {
+	var b bytes.Buffer
+
+	if err := html.Render(&b, n); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+// roundTrip converts the html to json with opts, decodes it back and
+// returns the rendered html.
+func roundTrip(t *testing.T, src string, opts *Options) string {
+	v, err := ConvertWith(strings.NewReader(src), opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	if err := Render(&out, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, schema := range []Schema{TagSchema, CompactSchema} {
+		for _, src := range roundTripTests {
+			doc, err := html.Parse(strings.NewReader(src))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := renderHTML(t, doc)
+			got := roundTrip(t, src, &Options{Schema: schema})
+
+			if got != want {
+				t.Errorf("schema %d: got\n%s\nwant\n%s", schema, got, want)
+			}
+
+			if again := roundTrip(t, got, &Options{Schema: schema}); again != got {
+				t.Errorf("schema %d: second round trip changed\n%s\ninto\n%s", schema, got, again)
+			}
+		}
+	}
+}
+
+func TestDecodeNodeError(t *testing.T) {
+	for _, src := range []string{`{}`, `{"type":"bogus"}`, `[1]`, `{"type":"element","children":[3]}`} {
+		if _, err := DecodeNode(strings.NewReader(src)); err == nil {
+			t.Errorf("DecodeNode(%s) succeeded, want an error", src)
+		}
+	}
+}
+
+func TestDecodeNodes(t *testing.T) {
+	const src = `<p>a</p>b<!--c--><td>d`
+
+	for _, schema := range []Schema{TagSchema, CompactSchema} {
+		v, err := ConvertWith(strings.NewReader(src), &Options{Schema: schema, Fragment: true})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(v)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+
+		if err := Render(&out, bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := `<p>a</p>b<!--c-->d`; out.String() != want {
+			t.Errorf("schema %d: got %q, want %q", schema, out.String(), want)
+		}
+	}
+
+	if _, err := DecodeNodes(strings.NewReader(`[{"type":"text","data":"a"},3]`)); err == nil {
+		t.Error("DecodeNodes succeeded on a list holding a number, want an error")
+	}
+}
@@ -0,0 +1,32 @@
+package html2json
+
+import (
+	"net/http"
+)
+
+// An Error is the json representation of a failed conversion.
+type Error struct {
+	// Error is the text of the http Status of the failure and Message
+	// describes it.
+	Error, Message string
+	Status         int
+	// Code classifies the failure, such as "timeout" or "parse-failure",
+	// for programs to act on.
+	Code string
+	// URL is the address of the document that could not be fetched, and
+	// UpstreamStatus the http status it was served with, if that is why
+	// the conversion failed.
+	URL            string `json:",omitempty"`
+	UpstreamStatus int    `json:",omitempty"`
+}
+
+// NewError returns the Error for err, reported with the given http status
+// and classified by code.
+func NewError(status int, code string, err error) *Error {
+	return &Error{
+		Error:   http.StatusText(status),
+		Message: err.Error(),
+		Status:  status,
+		Code:    code,
+	}
+}
@@ -0,0 +1,174 @@
+package html2json
+
+import (
+	"encoding/json"
+	"errors"
+	"exp/html"
+	"fmt"
+	"io"
+	"readability"
+	"render"
+	"tables"
+)
+
+// A Format selects the output of a conversion.
+type Format int
+
+const (
+	// JSONFormat writes the json value of the document. It is the default.
+	JSONFormat Format = iota
+	// TextFormat writes the text of the document, laid out in lines and
+	// paragraphs by render.Text.
+	TextFormat
+	// MarkdownFormat writes the document as Markdown with render.Markdown.
+	MarkdownFormat
+	// CSVFormat writes the tables of the document as CSV, separated by
+	// empty lines.
+	CSVFormat
+)
+
+var formatNames = map[string]Format{
+	"":         JSONFormat,
+	"json":     JSONFormat,
+	"text":     TextFormat,
+	"markdown": MarkdownFormat,
+	"csv":      CSVFormat,
+}
+
+// ParseFormat returns the Format called name, "json", "text", "markdown"
+// or "csv". The empty name selects the default JSONFormat.
+func ParseFormat(name string) (Format, error) {
+	f, ok := formatNames[name]
+
+	if !ok {
+		return JSONFormat, fmt.Errorf("html2json: unknown format %q", name)
+	}
+
+	return f, nil
+}
+
+// ContentType returns the media type of the output in format f.
+func (f Format) ContentType() string {
+	switch f {
+	case TextFormat:
+		return "text/plain; charset=utf-8"
+	case MarkdownFormat:
+		return "text/markdown; charset=utf-8"
+	case CSVFormat:
+		return "text/csv; charset=utf-8"
+	}
+
+	return "application/json; charset=utf-8"
+}
+
+// ErrFormatQuery is returned by Write for options that only have a json
+// value, queries, templates, parse error reports, metadata and resources,
+// in another format, and for tables in formats other than json and CSV.
+var ErrFormatQuery = errors.New("html2json: queries, templates, error reports, metadata and resources are only available as json")
+
+// Write writes the document or fragment parsed into res to w in the format
+// selected by opts: its json value as returned by Result, its text or
+// Markdown, sanitized if opts asks for it, or its tables as CSV. The text
+// of an article starts with its title and byline. A nil opts selects the
+// defaults.
+func Write(w io.Writer, res *html.ParseResult, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Format == JSONFormat {
+		v, err := Result(res, opts)
+
+		if err != nil {
+			return err
+		}
+
+		return json.NewEncoder(w).Encode(v)
+	}
+
+	if opts.Template != nil || len(opts.Select) > 0 || len(opts.XPath) > 0 || opts.Errors || opts.Metadata || opts.Resources {
+		return ErrFormatQuery
+	}
+
+	if opts.Format == CSVFormat {
+		return writeCSV(w, prepare(res, opts))
+	}
+
+	if opts.Tables {
+		return ErrFormatQuery
+	}
+
+	prepare(res, opts)
+
+	var doc = res.Doc
+
+	if doc == nil {
+		doc = fragmentDocument(res.Nodes)
+	}
+
+	var write = render.Text
+
+	if opts.Format == MarkdownFormat {
+		write = render.Markdown
+	}
+
+	if !opts.Article {
+		return write(w, doc)
+	}
+
+	a, err := extract(doc, opts)
+
+	if err != nil {
+		return err
+	}
+
+	return write(w, articleNode(a, opts.Format))
+}
+
+// writeCSV writes the tables in the tree rooted at n as CSV, separated by
+// empty lines.
+func writeCSV(w io.Writer, n *html.Node) error {
+	for i, t := range tables.Extract(n) {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+
+		if err := t.WriteCSV(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// articleNode returns an article element holding the title and byline of
+// a, followed by its content.
+func articleNode(a *readability.Article, f Format) *html.Node {
+	var article = &html.Node{Type: html.ElementNode, Data: "article"}
+
+	if a.Title != "" {
+		var h1 = &html.Node{Type: html.ElementNode, Data: "h1"}
+
+		h1.Add(&html.Node{Type: html.TextNode, Data: a.Title})
+		article.Add(h1)
+	}
+
+	if a.Byline != "" {
+		var p = &html.Node{Type: html.ElementNode, Data: "p"}
+		var by = p
+
+		if f == MarkdownFormat {
+			by = &html.Node{Type: html.ElementNode, Data: "em"}
+			p.Add(by)
+		}
+
+		by.Add(&html.Node{Type: html.TextNode, Data: a.Byline})
+		article.Add(p)
+	}
+
+	article.Add(a.Content)
+
+	return article
+}
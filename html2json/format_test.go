@@ -0,0 +1,110 @@
+package html2json
+
+import (
+	"bytes"
+	"sanitize"
+	"strings"
+	"testing"
+)
+
+const formatPage = `<!DOCTYPE html><title>t</title><h1>A <em>b</em></h1>` +
+	`<p>one<br>two <a href="/x" onclick="y()">link</a></p><script>z()</script>`
+
+var formatTests = []struct {
+	opts *Options
+	want string
+}{
+	{&Options{Format: TextFormat}, "A b\n\none\ntwo link\n"},
+	{&Options{Format: MarkdownFormat}, "# A *b*\n\none\\\ntwo [link](/x)\n"},
+	{&Options{Format: MarkdownFormat, Sanitize: sanitize.DefaultPolicy()}, "# A *b*\n\none\\\ntwo [link](/x)\n"},
+	{&Options{Format: TextFormat, Fragment: true, Context: "ul"}, "* a\n* b\n"},
+}
+
+func TestWrite(t *testing.T) {
+	for _, test := range formatTests {
+		var src = formatPage
+
+		if test.opts.Fragment {
+			src = `<li>a<li>b`
+		}
+
+		res, err := Parse(strings.NewReader(src), test.opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var b bytes.Buffer
+
+		if err := Write(&b, res, test.opts); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := b.String(); got != test.want {
+			t.Errorf("%+v: got %q, want %q", *test.opts, got, test.want)
+		}
+	}
+}
+
+func TestWriteArticle(t *testing.T) {
+	const page = `<title>A Day at the Coast | Example</title><meta name=author content="Ann">` +
+		`<div class="post"><p>We walked along the beach, past the rocks and the old lighthouse, until the tide came in.</p>` +
+		`<p>The sea was grey, the wind was strong, and the gulls were loud.</p></div>`
+
+	var opts = &Options{Format: MarkdownFormat, Article: true}
+
+	res, err := Parse(strings.NewReader(page), opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+
+	if err := Write(&b, res, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "# A Day at the Coast\n\n*Ann*\n\nWe walked along the beach, past the rocks and the old lighthouse, until the tide came in.\n\n" +
+		"The sea was grey, the wind was strong, and the gulls were loud.\n"
+
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	const page = `<table><tr><th>a<th>b<tr><td colspan=2>x, y</table><p>text</p><table><tr><td>1</table>`
+
+	var opts = &Options{Format: CSVFormat}
+
+	res, err := Parse(strings.NewReader(page), opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+
+	if err := Write(&b, res, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := b.String(), "a,b\n\"x, y\",\"x, y\"\n\n1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteQuery(t *testing.T) {
+	var opts = &Options{Format: TextFormat, Select: []string{"p"}}
+
+	res, err := Parse(strings.NewReader(formatPage), opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(&bytes.Buffer{}, res, opts); err != ErrFormatQuery {
+		t.Errorf("got %v, want ErrFormatQuery", err)
+	}
+}
@@ -0,0 +1,112 @@
+package html2json
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Limits bound what a document may take to convert, so that hostile or
+// broken input cannot exhaust memory or nest deeper than the consumers of
+// the json can follow. Zero fields are unlimited.
+type Limits struct {
+	// Bytes bounds the length of the document as read by Parse or Stream.
+	Bytes int64
+	// Depth bounds the nesting of elements, Nodes the number of nodes in
+	// the tree and Attributes the number of attributes of each element, as
+	// described by html.ParseOptions.
+	Depth      int
+	Nodes      int
+	Attributes int
+	// Truncate makes Parse return what fits within the limits, with
+	// html.ParseResult.Truncated naming the limit reached, instead of a
+	// *LimitError.
+	Truncate bool
+}
+
+// A LimitError reports a document that exceeds one of its Limits.
+type LimitError struct {
+	// Limit names the limit: "bytes", "depth", "nodes" or "attributes".
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("html2json: document exceeds the %s limit of %d", e.Limit, e.Max)
+}
+
+// Status returns the http status that reports e: 413 for a document that
+// is too long, 422 for one that is too deep or has too many nodes or
+// attributes.
+func (e *LimitError) Status() int {
+	if e.Limit == "bytes" {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusUnprocessableEntity
+}
+
+// error returns the LimitError for the limit called name.
+func (l Limits) error(name string) *LimitError {
+	var max int64
+
+	switch name {
+	case "bytes":
+		max = l.Bytes
+	case "depth":
+		max = int64(l.Depth)
+	case "nodes":
+		max = int64(l.Nodes)
+	case "attributes":
+		max = int64(l.Attributes)
+	}
+
+	return &LimitError{Limit: name, Max: max}
+}
+
+// A limitReader reads at most max bytes from r, if max is positive. Past
+// them, it ends the input if truncate is set and fails with a *LimitError
+// otherwise.
+type limitReader struct {
+	r        io.Reader
+	max      int64
+	read     int64
+	truncate bool
+	// exceeded is set once r turned out to hold more than max bytes.
+	exceeded bool
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.max <= 0 {
+		return l.r.Read(p)
+	}
+
+	if l.exceeded {
+		return 0, l.err()
+	}
+
+	// One byte more than is left tells whether r goes on past max.
+	if left := l.max - l.read; int64(len(p)) > left+1 {
+		p = p[:left+1]
+	}
+
+	n, err := l.r.Read(p)
+
+	if l.read+int64(n) > l.max {
+		n = int(l.max - l.read)
+		l.exceeded = true
+		err = l.err()
+	}
+
+	l.read += int64(n)
+
+	return n, err
+}
+
+func (l *limitReader) err() error {
+	if l.truncate {
+		return io.EOF
+	}
+
+	return &LimitError{Limit: "bytes", Max: l.max}
+}
@@ -0,0 +1,152 @@
+package html2json
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var limitTests = []struct {
+	limits Limits
+	in     string
+	// limit is the limit exceeded, out the fragment cut to the limits.
+	limit, out string
+}{
+	{
+		Limits{Bytes: 13},
+		"<p>abc</p><p>def</p>",
+		"bytes",
+		`[{"type":"element","data":"p","children":["abc"]},{"type":"element","data":"p"}]`,
+	},
+	{
+		Limits{Bytes: 10},
+		"<p>abc</p>",
+		"",
+		`[{"type":"element","data":"p","children":["abc"]}]`,
+	},
+	{
+		Limits{Depth: 3},
+		"<div><div><div>a</div></div></div>",
+		"depth",
+		`[{"type":"element","data":"div","children":[{"type":"element","data":"div"},{"type":"element","data":"div","children":["a"]}]}]`,
+	},
+	{
+		Limits{Nodes: 3},
+		"<p>a</p><p>b</p>",
+		"nodes",
+		`[{"type":"element","data":"p","children":["a"]},{"type":"element","data":"p"}]`,
+	},
+	{
+		Limits{Attributes: 1},
+		`<p id=a class=b>`,
+		"attributes",
+		`[{"type":"element","data":"p","attributes":{"id":"a"}}]`,
+	},
+}
+
+func TestLimits(t *testing.T) {
+	for _, test := range limitTests {
+		var opts = &Options{Schema: CompactSchema, Fragment: true, Limits: test.limits}
+
+		_, err := ConvertWith(strings.NewReader(test.in), opts)
+
+		if test.limit == "" && err != nil {
+			t.Errorf("%q: %v", test.in, err)
+		}
+
+		if e, ok := err.(*LimitError); test.limit != "" && (!ok || e.Limit != test.limit) {
+			t.Errorf("%q: got error %v, want the %s limit", test.in, err, test.limit)
+		}
+
+		opts.Limits.Truncate = true
+
+		res, err := Parse(strings.NewReader(test.in), opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Truncated != test.limit {
+			t.Errorf("%q: got Truncated %q, want %q", test.in, res.Truncated, test.limit)
+		}
+
+		v, err := Result(res, opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(v)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != test.out {
+			t.Errorf("%q:\ngot  %s\nwant %s", test.in, b, test.out)
+		}
+	}
+}
+
+func TestLimitReport(t *testing.T) {
+	var opts = &Options{Errors: true, Limits: Limits{Nodes: 4, Truncate: true}}
+
+	v, err := ConvertWith(strings.NewReader("<!DOCTYPE html><p>a<p>b"), opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := v.(*Report); r.Truncated != "nodes" {
+		t.Errorf("got Truncated %q, want nodes", r.Truncated)
+	}
+}
+
+func TestLimitErrorStatus(t *testing.T) {
+	if s := (&LimitError{Limit: "bytes"}).Status(); s != http.StatusRequestEntityTooLarge {
+		t.Errorf("bytes: got status %d", s)
+	}
+
+	if s := (&LimitError{Limit: "depth"}).Status(); s != http.StatusUnprocessableEntity {
+		t.Errorf("depth: got status %d", s)
+	}
+}
+
+func TestStreamLimits(t *testing.T) {
+	tests := []struct {
+		limits  Limits
+		in, out string
+	}{
+		{
+			Limits{Depth: 2},
+			"<div><p>a<b>b</b></p>c</div>",
+			`{"type":"document","children":[{"type":"element","data":"div","children":[{"type":"element","data":"p","children":["a"]}]}]}`,
+		},
+		{
+			Limits{Nodes: 2},
+			"<p>a</p><p>b</p>",
+			`{"type":"document","children":[{"type":"element","data":"p","children":["a"]}]}`,
+		},
+		{
+			Limits{Bytes: 8},
+			"<p>a</p><p>b</p>",
+			`{"type":"document","children":[{"type":"element","data":"p","children":["a"]}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+
+		err := Stream(&b, strings.NewReader(test.in), &Options{Schema: CompactSchema, Limits: test.limits})
+
+		if _, ok := err.(*LimitError); !ok {
+			t.Errorf("%q: got error %v, want a LimitError", test.in, err)
+		}
+
+		if got := strings.TrimSpace(b.String()); got != test.out {
+			t.Errorf("%q:\ngot  %s\nwant %s", test.in, got, test.out)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package html2json
+
+import (
+	"errors"
+	"exp/html"
+	"fmt"
+	"io"
+	"metadata"
+	"net/url"
+	"resources"
+	"sanitize"
+	"strings"
+	"tables"
+)
+
+// A Schema selects the json layout of a converted document.
+type Schema int
+
+const (
+	// TagSchema encodes nodes as Tags. It is the default.
+	TagSchema Schema = iota
+	// CompactSchema encodes nodes as Compact values and text nodes as
+	// plain strings.
+	CompactSchema
+)
+
+var schemaNames = map[string]Schema{
+	"":        TagSchema,
+	"tag":     TagSchema,
+	"compact": CompactSchema,
+}
+
+// ParseSchema returns the Schema called name, "tag" or "compact". The
+// empty name selects the default TagSchema.
+func ParseSchema(name string) (Schema, error) {
+	s, ok := schemaNames[name]
+
+	if !ok {
+		return TagSchema, fmt.Errorf("html2json: unknown schema %q", name)
+	}
+
+	return s, nil
+}
+
+// Options control the conversion of a document. The zero value produces
+// the same output as Convert.
+type Options struct {
+	Schema Schema
+	// Select lists CSS selectors and XPath lists XPath expressions. If
+	// either is not empty, the output is an object mapping each of them to
+	// its result instead of the whole document.
+	Select []string
+	XPath  []string
+	// Template, if not nil, shapes the output instead and takes precedence
+	// over the queries.
+	Template *Template
+	// Positions adds the source positions of nodes to the output of the
+	// tag schema. The compact schema has no room for them.
+	Positions bool
+	// Errors makes ConvertWith return a Report of the parse errors in the
+	// document along with its json value.
+	Errors bool
+	// DisableScripting parses the document as a browser without scripting
+	// would, with the content of noscript elements as markup.
+	DisableScripting bool
+	// Fragment parses a fragment of html instead of a document, as the
+	// content of an element called Context, such as "tbody" or "textarea",
+	// or "body" if Context is empty. The json value of a fragment is the
+	// list of its top-level nodes.
+	Fragment bool
+	Context  string
+	// Sanitize, if not nil, removes what the policy does not allow from
+	// the document before it is laid out, its resources or tables are
+	// extracted, or, for Article, from the content of the article. It
+	// cannot be combined with Metadata, which is found in the elements a
+	// policy removes.
+	Sanitize *sanitize.Policy
+	// Article replaces the document by its main content, without the
+	// navigation, advertisements and footers around it, and lays out an
+	// Article instead.
+	Article bool
+	// Metadata replaces the document by its Metadata: its title, meta
+	// elements, links, JSON-LD and microdata, as found by package
+	// metadata. It takes precedence over the other options that shape the
+	// output.
+	Metadata bool
+	// URL is the address of the document, which relative URLs in it are
+	// resolved against along with its base element.
+	URL *url.URL
+	// AbsoluteURLs rewrites the URL attributes of the document, such as
+	// href and src, to absolute URLs before it is laid out.
+	AbsoluteURLs bool
+	// Resources replaces the document by the list of the links, images,
+	// scripts and other resources it refers to, as found by package
+	// resources, with absolute URLs.
+	Resources bool
+	// Tables replaces the document by the list of its Tables, as found by
+	// package tables, each with its headers and rows of cell text.
+	Tables bool
+	// Prune leaves white space, comments, the doctype or the content of
+	// scripts out of the output.
+	Prune Pruning
+	// Format selects the output of Write: json, or the text or Markdown
+	// of the document.
+	Format Format
+	// Limits bound the length of the document and the size of its tree.
+	Limits Limits
+}
+
+// A Report is the result of ConvertWith when Options.Errors is set: the
+// json value of the document and the parse errors the parser recovered
+// from, in document order. A conforming document has none.
+type Report struct {
+	Document interface{}
+	// Mode is the document mode, such as "quirks", that the doctype of
+	// the document selected.
+	Mode   string
+	Errors []*html.ParseError
+	// Truncated names the limit of Options.Limits that the document was
+	// cut to, if Limits.Truncate let it be.
+	Truncated string `json:",omitempty"`
+}
+
+// NewValue returns the json value for the tree rooted at n, laid out as
+// selected by opts. A nil opts selects the defaults.
+func NewValue(n *html.Node, opts *Options) interface{} {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	switch opts.Schema {
+	case CompactSchema:
+		return NewCompact(n)
+	}
+
+	return newTag(n, opts.Positions)
+}
+
+// ConvertWith parses the html read from r and returns its json value as
+// laid out by opts, wrapped in a Report if opts asks for the parse errors.
+func ConvertWith(r io.Reader, opts *Options) (interface{}, error) {
+	res, err := Parse(r, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Result(res, opts)
+}
+
+// Parse parses the html read from r with the parser options in opts. A
+// document that exceeds opts.Limits makes it return a *LimitError, or is
+// cut to them if Limits.Truncate is set, as the Truncated field of the
+// result then tells. A nil opts selects the defaults.
+func Parse(r io.Reader, opts *Options) (*html.ParseResult, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	var limits = opts.Limits
+	var lr = &limitReader{r: r, max: limits.Bytes, truncate: limits.Truncate}
+
+	res, err := html.ParseWithOptions(lr, &html.ParseOptions{
+		DisableScripting: opts.DisableScripting,
+		Fragment:         opts.Fragment,
+		Context:          contextNode(opts.Context),
+		Errors:           opts.Errors,
+		Positions:        opts.Positions,
+		MaxDepth:         limits.Depth,
+		MaxNodes:         limits.Nodes,
+		MaxAttributes:    limits.Attributes,
+		StopAtLimit:      !limits.Truncate,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if lr.exceeded && res.Truncated == "" {
+		res.Truncated = "bytes"
+	}
+
+	if res.Truncated != "" && !limits.Truncate {
+		return nil, limits.error(res.Truncated)
+	}
+
+	return res, nil
+}
+
+// contextNode returns the element called name that a fragment is parsed
+// in. Without one, html.ParseFragment would add the html, head and body
+// elements of a document, so it defaults to a body element.
+func contextNode(name string) *html.Node {
+	if name == "" {
+		name = "body"
+	}
+
+	var n = &html.Node{Type: html.ElementNode, Data: strings.ToLower(name)}
+
+	switch n.Data {
+	case "math", "svg":
+		n.Namespace = n.Data
+	}
+
+	return n
+}
+
+// ErrSanitizeMetadata is returned by Result for Options that ask for both
+// the Metadata of a document and a Sanitize policy.
+var ErrSanitizeMetadata = errors.New("html2json: metadata cannot be extracted from a sanitized document")
+
+// Result returns the json value of the document or fragment parsed into
+// res as laid out by opts, wrapped in a Report if opts asks for the parse
+// errors.
+func Result(res *html.ParseResult, opts *Options) (interface{}, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Metadata && opts.Sanitize != nil {
+		return nil, ErrSanitizeMetadata
+	}
+
+	var v interface{}
+	var err error
+	var root = prepare(res, opts)
+
+	switch {
+	case opts.Metadata:
+		v = metadata.Extract(root)
+	case opts.Resources:
+		v = resources.Extract(root, resources.Base(root, opts.URL))
+	case opts.Tables:
+		v = tables.Extract(root)
+	case opts.Article && res.Doc != nil:
+		v, err = NewArticle(res.Doc, opts)
+	case opts.Article:
+		v, err = NewArticle(fragmentDocument(res.Nodes), opts)
+	case res.Doc != nil:
+		v, err = Transform(res.Doc, opts)
+	default:
+		v, err = TransformFragment(res.Nodes, opts)
+	}
+
+	if err != nil || !opts.Errors {
+		return v, err
+	}
+
+	var errs = res.Errors
+
+	if errs == nil {
+		errs = []*html.ParseError{}
+	}
+
+	return &Report{Document: v, Mode: res.Mode.String(), Errors: errs, Truncated: res.Truncated}, nil
+}
+
+// prepare prunes the document or fragment parsed into res, makes its URL
+// attributes absolute and sanitizes it as opts asks, and returns its root.
+// The root of a fragment is a document node that leaves the parent of its
+// nodes unset. An article is left for NewArticle to sanitize, since
+// readability scores the class and id attributes a policy removes.
+func prepare(res *html.ParseResult, opts *Options) *html.Node {
+	prune(res, opts)
+
+	var root = res.Doc
+
+	if root == nil {
+		root = &html.Node{Type: html.DocumentNode, Child: res.Nodes}
+	}
+
+	if opts.AbsoluteURLs {
+		resources.Resolve(root, resources.Base(root, opts.URL))
+	}
+
+	if opts.Sanitize == nil || opts.Article {
+		return root
+	}
+
+	if res.Doc != nil {
+		opts.Sanitize.Sanitize(res.Doc)
+		return root
+	}
+
+	res.Nodes = opts.Sanitize.SanitizeNodes(res.Nodes)
+
+	return &html.Node{Type: html.DocumentNode, Child: res.Nodes}
+}
+
+// Transform returns the json value for the document n as laid out by opts.
+// A nil opts selects the defaults.
+func Transform(n *html.Node, opts *Options) (interface{}, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Template != nil {
+		return opts.Template.Apply(n, opts)
+	}
+
+	if len(opts.Select) > 0 || len(opts.XPath) > 0 {
+		return query(n, opts)
+	}
+
+	return NewValue(n, opts), nil
+}
+
+// TransformFragment returns the json value for the top-level nodes of a
+// fragment as laid out by opts: the list of their values, or the result of
+// the template or queries of opts on a document holding them. A nil opts
+// selects the defaults.
+func TransformFragment(nodes []*html.Node, opts *Options) (interface{}, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Template != nil || len(opts.Select) > 0 || len(opts.XPath) > 0 {
+		return Transform(fragmentDocument(nodes), opts)
+	}
+
+	var values = make([]interface{}, len(nodes))
+
+	for i, n := range nodes {
+		values[i] = NewValue(n, opts)
+	}
+
+	return values, nil
+}
+
+// fragmentDocument returns a document node holding the top-level nodes of
+// a fragment.
+func fragmentDocument(nodes []*html.Node) *html.Node {
+	var doc = &html.Node{Type: html.DocumentNode}
+
+	for _, n := range nodes {
+		doc.Add(n)
+	}
+
+	return doc
+}
+
+// query returns the results of the selectors and XPath expressions in opts
+// keyed by their source text.
+func query(n *html.Node, opts *Options) (map[string]interface{}, error) {
+	var result = make(map[string]interface{})
+
+	selected, err := Select(n, opts.Select, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for s, v := range selected {
+		result[s] = v
+	}
+
+	for _, x := range opts.XPath {
+		v, err := XPath(n, x, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result[x] = v
+	}
+
+	return result, nil
+}
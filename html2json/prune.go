@@ -0,0 +1,250 @@
+package html2json
+
+import (
+	"exp/html"
+	"fmt"
+	"strings"
+)
+
+// Pruning leaves parts of a document out of its output. The zero value
+// keeps everything.
+type Pruning struct {
+	// Whitespace drops the text nodes that hold only white space, such as
+	// the indentation between elements. White space that separates inline
+	// content, as in "<b>a</b> <i>b</i>", is kept, as is the content of
+	// pre, textarea and listing elements. Elements are taken to have their
+	// default display, since no CSS is applied.
+	Whitespace bool
+	// Collapse replaces each run of white space in text by a single space,
+	// outside of those elements and of scripts and styles.
+	Collapse bool
+	// Comments drops comments and Doctype drops the doctype.
+	Comments bool
+	Doctype  bool
+	// Scripts drops the content of script and style elements.
+	Scripts bool
+}
+
+// ParsePruning returns the Pruning that drops what names lists, separated
+// by commas: "whitespace", "collapse", "comments", "doctype" and
+// "scripts", or "all" of them. Each name may also be given separately.
+func ParsePruning(names ...string) (Pruning, error) {
+	var p Pruning
+
+	for _, list := range names {
+		for _, name := range strings.Split(list, ",") {
+			switch strings.TrimSpace(name) {
+			case "":
+			case "whitespace":
+				p.Whitespace = true
+			case "collapse":
+				p.Collapse = true
+			case "comments":
+				p.Comments = true
+			case "doctype":
+				p.Doctype = true
+			case "scripts":
+				p.Scripts = true
+			case "all":
+				p = Pruning{true, true, true, true, true}
+			default:
+				return Pruning{}, fmt.Errorf("html2json: unknown pruning %q", name)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// inlineElements are the elements displayed inline by default, between
+// which white space is shown.
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "acronym": true, "area": true, "audio": true,
+	"b": true, "bdi": true, "bdo": true, "big": true, "br": true,
+	"button": true, "canvas": true, "cite": true, "code": true,
+	"data": true, "del": true, "dfn": true, "em": true, "embed": true,
+	"font": true, "i": true, "iframe": true, "img": true, "input": true,
+	"ins": true, "kbd": true, "label": true, "map": true, "mark": true,
+	"math": true, "meter": true, "nobr": true, "object": true,
+	"output": true, "picture": true, "progress": true, "q": true,
+	"rp": true, "rt": true, "ruby": true, "s": true, "samp": true,
+	"select": true, "small": true, "span": true, "strike": true,
+	"strong": true, "sub": true, "sup": true, "svg": true,
+	"textarea": true, "time": true, "tt": true, "u": true, "var": true,
+	"video": true, "wbr": true,
+}
+
+// preformatted are the elements whose white space is shown as it is.
+var preformatted = map[string]bool{
+	"listing":   true,
+	"plaintext": true,
+	"pre":       true,
+	"textarea":  true,
+}
+
+// rawTextElements hold text that is not html: their white space is left
+// alone.
+var rawTextElements = map[string]bool{
+	"iframe":   true,
+	"noembed":  true,
+	"noframes": true,
+	"script":   true,
+	"style":    true,
+	"xmp":      true,
+}
+
+// prune applies opts.Prune to the document or fragment parsed into res.
+func prune(res *html.ParseResult, opts *Options) {
+	var p = opts.Prune
+
+	if p == (Pruning{}) {
+		return
+	}
+
+	if res.Doc != nil {
+		res.Doc.Child = p.nodes(res.Doc, res.Doc.Child, false)
+		return
+	}
+
+	res.Nodes = p.nodes(contextNode(opts.Context), res.Nodes, preformatted[strings.ToLower(opts.Context)])
+}
+
+// nodes returns the children of parent that p keeps, pruned in turn. pre
+// is set inside elements whose white space is shown as it is.
+func (p Pruning) nodes(parent *html.Node, children []*html.Node, pre bool) []*html.Node {
+	var kept = make([]*html.Node, 0, len(children))
+	var raw = parent.Type == html.ElementNode && rawTextElements[parent.Data]
+
+	for i, n := range children {
+		switch n.Type {
+		case html.CommentNode:
+			if p.Comments {
+				continue
+			}
+		case html.DoctypeNode:
+			if p.Doctype {
+				continue
+			}
+		case html.TextNode:
+			if raw {
+				if p.Scripts && (parent.Data == "script" || parent.Data == "style") {
+					continue
+				}
+
+				break
+			}
+
+			if pre {
+				break
+			}
+
+			if p.Whitespace && isWhitespace(n.Data) {
+				if !(p.inlineBefore(parent, children, i) && p.inlineAfter(parent, children, i)) {
+					continue
+				}
+
+				// White space split by dropped comments is kept as one
+				// text node, as Stream holds it back as one.
+				if last := len(kept) - 1; last >= 0 && kept[last].Type == html.TextNode && isWhitespace(kept[last].Data) {
+					kept[last].Data += n.Data
+					kept[last].End = n.End
+
+					if p.Collapse {
+						kept[last].Data = collapse(kept[last].Data)
+					}
+
+					continue
+				}
+			}
+
+			if p.Collapse {
+				n.Data = collapse(n.Data)
+			}
+		case html.ElementNode:
+			n.Child = p.nodes(n, n.Child, pre || preformatted[n.Data])
+		}
+
+		kept = append(kept, n)
+	}
+
+	return kept
+}
+
+// inlineBefore reports whether the node at i in the children of parent
+// follows inline content: text, a comment or an inline element, or the
+// start of an inline parent. White space and the comments that p drops
+// are passed over.
+func (p Pruning) inlineBefore(parent *html.Node, children []*html.Node, i int) bool {
+	for i--; i >= 0 && p.passed(children[i]); i-- {
+	}
+
+	if i < 0 {
+		return parent.Type == html.ElementNode && inlineElements[parent.Data]
+	}
+
+	return isInline(children[i])
+}
+
+// inlineAfter reports whether the node at i in the children of parent is
+// followed by inline content, or by the end of an inline parent.
+func (p Pruning) inlineAfter(parent *html.Node, children []*html.Node, i int) bool {
+	for i++; i < len(children) && p.passed(children[i]); i++ {
+	}
+
+	if i == len(children) {
+		return parent.Type == html.ElementNode && inlineElements[parent.Data]
+	}
+
+	return isInline(children[i])
+}
+
+// passed reports whether inlineBefore and inlineAfter pass over n: a
+// comment that p leaves out, or white space.
+func (p Pruning) passed(n *html.Node) bool {
+	switch n.Type {
+	case html.CommentNode:
+		return p.Comments
+	case html.TextNode:
+		return isWhitespace(n.Data)
+	}
+
+	return false
+}
+
+func isInline(n *html.Node) bool {
+	switch n.Type {
+	case html.TextNode, html.CommentNode:
+		return true
+	case html.ElementNode:
+		return inlineElements[n.Data]
+	}
+
+	return false
+}
+
+// isWhitespace reports whether s holds only html white space.
+func isWhitespace(s string) bool {
+	return strings.Trim(s, " \t\n\f\r") == ""
+}
+
+// collapse replaces the runs of html white space in s by single spaces.
+func collapse(s string) string {
+	var b = make([]byte, 0, len(s))
+	var space bool
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n', '\f', '\r':
+			if !space {
+				b = append(b, ' ')
+			}
+
+			space = true
+		default:
+			b = append(b, c)
+			space = false
+		}
+	}
+
+	return string(b)
+}
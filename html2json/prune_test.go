@@ -0,0 +1,171 @@
+package html2json
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var pruneTests = []struct {
+	prune   Pruning
+	in, out string
+}{
+	{
+		Pruning{Whitespace: true},
+		"<ul>\n  <li>a</li>\n  <li><b>b</b> <i>c</i> </li>\n</ul>",
+		`[{"type":"element","data":"ul","children":[{"type":"element","data":"li","children":["a"]},` +
+			`{"type":"element","data":"li","children":[{"type":"element","data":"b","children":["b"]}," ",{"type":"element","data":"i","children":["c"]}]}]}]`,
+	},
+	{
+		Pruning{Whitespace: true},
+		"<p><span> <b>x</b></span>\n<pre>\n\n  y\n</pre> <textarea>  </textarea>",
+		`[{"type":"element","data":"p","children":[{"type":"element","data":"span","children":[" ",{"type":"element","data":"b","children":["x"]}]}]},` +
+			`{"type":"element","data":"pre","children":["\n  y\n"]},{"type":"element","data":"textarea","children":["  "]}]`,
+	},
+	{
+		Pruning{Collapse: true},
+		"<p>a \n\t b</p><pre>c  d</pre><script>e  f</script>",
+		`[{"type":"element","data":"p","children":["a b"]},{"type":"element","data":"pre","children":["c  d"]},{"type":"element","data":"script","children":["e  f"]}]`,
+	},
+	{
+		Pruning{Comments: true, Scripts: true},
+		"<p>a<!-- b --></p><script>c()</script><style>d{}</style>",
+		`[{"type":"element","data":"p","children":["a"]},{"type":"element","data":"script"},{"type":"element","data":"style"}]`,
+	},
+	{
+		Pruning{Whitespace: true, Collapse: true, Comments: true, Doctype: true, Scripts: true},
+		"<body>\n<!--a-->\n<!--b-->\n<div>x</div>",
+		`[{"type":"element","data":"div","children":["x"]}]`,
+	},
+	{
+		Pruning{Whitespace: true, Comments: true},
+		"<p>a<!-- b --> <!-- c -->d</p>",
+		`[{"type":"element","data":"p","children":["a"," ","d"]}]`,
+	},
+}
+
+func TestPruneFragment(t *testing.T) {
+	for _, test := range pruneTests {
+		v, err := ConvertWith(strings.NewReader(test.in), &Options{Schema: CompactSchema, Fragment: true, Prune: test.prune})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(v)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != test.out {
+			t.Errorf("%+v %q:\ngot  %s\nwant %s", test.prune, test.in, b, test.out)
+		}
+	}
+}
+
+func TestPruneContext(t *testing.T) {
+	var opts = &Options{Schema: CompactSchema, Context: "PRE", Fragment: true, Prune: Pruning{Whitespace: true, Collapse: true}}
+	v, err := ConvertWith(strings.NewReader("a  b\n <b> </b>"), opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `["a  b\n ",{"type":"element","data":"b","children":[" "]}]`; string(b) != want {
+		t.Errorf("got  %s\nwant %s", b, want)
+	}
+}
+
+const prunePage = "<!DOCTYPE html>\n<html>\n<head>\n  <title>t</title>\n  <style> p {} </style>\n</head>\n" +
+	"<body>\n  <!-- nav -->\n  <div>\n    <p>one\n      <b>two</b> <i>three</i>\n    </p>\n  </div>\n" +
+	"  <pre>\n  keep  this\n</pre>\n  <script>\n    x();\n  </script>\n</body>\n</html>"
+
+func TestPruneDocument(t *testing.T) {
+	v, err := ConvertWith(strings.NewReader(prunePage), &Options{
+		Schema: CompactSchema,
+		Prune:  Pruning{Whitespace: true, Collapse: true, Comments: true, Doctype: true, Scripts: true},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `{"type":"document","children":[{"type":"element","data":"html","children":[` +
+		`{"type":"element","data":"head","children":[{"type":"element","data":"title","children":["t"]},{"type":"element","data":"style"}]},` +
+		`{"type":"element","data":"body","children":[{"type":"element","data":"div","children":[{"type":"element","data":"p","children":["one ",` +
+		`{"type":"element","data":"b","children":["two"]}," ",{"type":"element","data":"i","children":["three"]}]}]},` +
+		`{"type":"element","data":"pre","children":["  keep  this\n"]},{"type":"element","data":"script"}]}]}]}`
+
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+}
+
+// Pruning a stream gives the same output as pruning the parsed document.
+func TestPruneStream(t *testing.T) {
+	const page = "<!DOCTYPE html><html><head><title>t</title><style> p {} </style></head>" +
+		"<body>\n  <!-- nav -->\n  <div>\n    <p>one\n      <b>two</b> <i>three</i>\n    </p>\n  </div>\n" +
+		"  <pre>  keep  this\n</pre>\n  <script>\n    x();\n  </script>\n<span> <!-- c --> </span>" +
+		"<p>a<!-- b --> <!-- c -->d</p>\n<!--a-->\n<!--b-->\n<div>x</div></body></html>"
+
+	for _, prune := range []Pruning{
+		{Whitespace: true},
+		{Collapse: true},
+		{Whitespace: true, Collapse: true},
+		{Comments: true, Doctype: true, Scripts: true},
+		{Whitespace: true, Collapse: true, Comments: true, Doctype: true, Scripts: true},
+	} {
+		for _, schema := range []Schema{TagSchema, CompactSchema} {
+			var opts = &Options{Schema: schema, Prune: prune, Positions: true}
+			var want, got bytes.Buffer
+
+			v, err := ConvertWith(strings.NewReader(page), opts)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := json.NewEncoder(&want).Encode(v); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Stream(&got, strings.NewReader(page), opts); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.String() != want.String() {
+				t.Errorf("%+v: got\n%s\nwant\n%s", prune, got.String(), want.String())
+			}
+		}
+	}
+}
+
+func TestParsePruning(t *testing.T) {
+	p, err := ParsePruning("whitespace, comments", "scripts")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (Pruning{Whitespace: true, Comments: true, Scripts: true}); p != want {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+
+	if _, err := ParsePruning("spaces"); err == nil {
+		t.Error("unknown pruning accepted")
+	}
+}
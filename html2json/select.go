@@ -0,0 +1,30 @@
+package html2json
+
+import (
+	"exp/html"
+	"selector"
+)
+
+// Select returns, keyed by selector, the json values of the subtrees of n
+// that each of the CSS selectors matches, in document order.
+func Select(n *html.Node, selectors []string, opts *Options) (map[string][]interface{}, error) {
+	var result = make(map[string][]interface{}, len(selectors))
+
+	for _, s := range selectors {
+		sel, err := selector.Compile(s)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var values = []interface{}{}
+
+		for _, m := range sel.MatchAll(n) {
+			values = append(values, NewValue(m, opts))
+		}
+
+		result[s] = values
+	}
+
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package html2json
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	var opts = &Options{
+		Schema: CompactSchema,
+		Select: []string{"a[href]", "div.article > p", "table"},
+	}
+
+	v, err := ConvertWith(strings.NewReader(`<div class="article"><p>x <a href="/y">y</a></p><a>z</a></div>`), opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `{"a[href]":[{"type":"element","data":"a","attributes":{"href":"/y"},"children":["y"]}],` +
+		`"div.article \u003e p":[{"type":"element","data":"p","children":["x ",{"type":"element","data":"a","attributes":{"href":"/y"},"children":["y"]}]}],` +
+		`"table":[]}`
+
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+
+	opts.Select = []string{"a["}
+
+	if _, err := ConvertWith(strings.NewReader(""), opts); err == nil {
+		t.Errorf("got no error for an invalid selector")
+	}
+}
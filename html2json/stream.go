@@ -0,0 +1,683 @@
+package html2json
+
+import (
+	"bufio"
+	"errors"
+	"exp/html"
+	"io"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ErrStreamQuery is returned by Stream for options that need the parser or
+// the whole document tree: queries, templates, parse error reports,
+// fragments, sanitizing, articles, metadata, resources, absolute URLs,
+// tables and the text formats.
+var ErrStreamQuery = errors.New("html2json: options that need the parsed document cannot be streamed")
+
+// voidElements never have children, so their start tag is all there is.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "command": true,
+	"embed": true, "hr": true, "img": true, "input": true, "keygen": true,
+	"link": true, "meta": true, "param": true, "source": true, "track": true,
+	"wbr": true,
+}
+
+// impliedEnd lists, for the start tags that imply end tags, the open
+// elements they close. Without it a page of unclosed <p>, <li> or <td>
+// tags would nest ever deeper.
+var impliedEnd = map[string][]string{
+	"p":      {"p"},
+	"li":     {"li"},
+	"dt":     {"dt", "dd"},
+	"dd":     {"dt", "dd"},
+	"option": {"option"},
+	"tr":     {"tr", "td", "th"},
+	"td":     {"td", "th"},
+	"th":     {"td", "th"},
+	"thead":  {"thead", "tbody", "tfoot", "tr", "td", "th"},
+	"tbody":  {"thead", "tbody", "tfoot", "tr", "td", "th"},
+	"tfoot":  {"thead", "tbody", "tfoot", "tr", "td", "th"},
+}
+
+// scopeElements stop the search for elements closed by implied end tags,
+// so that a list item does not close the item of an outer list.
+var scopeElements = map[string]bool{
+	"table": true, "ul": true, "ol": true, "dl": true, "select": true,
+}
+
+// Stream converts the html read from r and writes its json representation
+// to w as it goes, laid out as selected by opts. Unlike ConvertWith it
+// drives the tokenizer instead of building the document tree, so memory
+// use depends on the nesting of the document and the size of its largest
+// token, not on its length.
+//
+// Without the tree construction of the parser, elements nest as their tags
+// say: html, head and body are only present if the document has them, end
+// tags without an open element are dropped, and only the end tags implied
+// by p, li, dt, dd, option and the table parts are inferred. For documents
+// that spell out their structure the output is the same as ConvertWith's.
+//
+// With Options.Positions, the positions of elements closed by implied end
+// tags are taken from their last descendant, as the parser does.
+//
+// Options.Limits bound the document as they do for Parse, except that
+// elements nested past Limits.Depth end the document instead of being laid
+// out next to their parent. Since the output has started by then, Stream
+// ends it at the first limit reached, closing the nodes still open, and
+// returns a *LimitError whether or not Limits.Truncate is set.
+//
+// Options.Prune applies as it does to ConvertWith. Queries, templates,
+// Options.Errors, Options.Fragment, Options.Sanitize, Options.Article and
+// the other options that replace the document need the parser and make
+// Stream return ErrStreamQuery. A nil opts selects the defaults.
+func Stream(w io.Writer, r io.Reader, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Template != nil || len(opts.Select) > 0 || len(opts.XPath) > 0 || opts.Errors || opts.Fragment || opts.Sanitize != nil || opts.Article || opts.Metadata || opts.Resources || opts.AbsoluteURLs || opts.Tables || opts.Format != JSONFormat {
+		return ErrStreamQuery
+	}
+
+	var s = &streamer{
+		w:         bufio.NewWriter(w),
+		compact:   opts.Schema == CompactSchema,
+		positions: opts.Positions && opts.Schema != CompactSchema,
+		prune:     opts.Prune,
+		limits:    opts.Limits,
+	}
+
+	var lr = &limitReader{r: r, max: opts.Limits.Bytes, truncate: true}
+	var z = html.NewTokenizer(lr)
+
+	s.open(html.DocumentNode, "", nil)
+	s.stack[0].start = html.Position{Line: 1, Column: 1}
+
+	for {
+		if max := s.limits.Nodes; max > 0 && s.nodes >= max {
+			if z.Next() != html.ErrorToken {
+				s.truncate("nodes")
+			}
+
+			return s.done()
+		}
+
+		var tt = z.Next()
+
+		s.pos, s.endPos = z.Pos()
+
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return err
+			}
+
+			if lr.exceeded {
+				s.truncate("bytes")
+			}
+
+			return s.done()
+		case html.TextToken:
+			s.text(string(z.Text()))
+		case html.CommentToken:
+			if opts.Prune.Comments {
+				// The white space around a dropped comment is held back
+				// as if it was not there.
+				break
+			}
+
+			s.release(true)
+			s.leaf(html.CommentNode, string(z.Text()), nil)
+		case html.DoctypeToken:
+			s.release(false)
+
+			if opts.Prune.Doctype {
+				s.follow(false)
+				break
+			}
+
+			s.leaf(html.DoctypeNode, string(z.Text()), nil)
+		case html.SelfClosingTagToken:
+			var t = s.token(z)
+
+			s.release(inlineElements[t.Data])
+
+			if s.tooDeep() {
+				return s.done()
+			}
+
+			s.leaf(html.ElementNode, t.Data, t.Attr)
+		case html.StartTagToken:
+			var t = s.token(z)
+
+			s.release(inlineElements[t.Data])
+			s.implyEnd(t.Data)
+
+			if s.tooDeep() {
+				return s.done()
+			}
+
+			if t.Data == "noscript" && opts.DisableScripting {
+				z.NextIsNotRawText()
+			}
+
+			if voidElements[t.Data] {
+				s.leaf(html.ElementNode, t.Data, t.Attr)
+				break
+			}
+
+			s.open(html.ElementNode, t.Data, t.Attr)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+
+			s.release(s.inlineEnd())
+			s.end(string(name))
+		}
+	}
+}
+
+// A streamer writes the json of a document one node at a time. stack holds
+// the elements whose children are still being written; the document node
+// is at its bottom.
+type streamer struct {
+	w         *bufio.Writer
+	compact   bool
+	positions bool
+	stack     []openNode
+	// pos and endPos span the current token.
+	pos, endPos html.Position
+	prune       Pruning
+	// pre counts the open elements whose white space is shown as it is.
+	pre int
+	// space is the white space that Pruning.Whitespace holds back until
+	// the next token tells whether it separates inline content.
+	space *heldSpace
+	// nodes counts the nodes written, and truncated names the first of
+	// limits that the document exceeded.
+	limits    Limits
+	nodes     int
+	truncated string
+}
+
+type heldSpace struct {
+	data       string
+	start, end html.Position
+	// keep is set if the space follows inline content.
+	keep bool
+}
+
+type openNode struct {
+	typ html.NodeType
+	// data is the tag name of elements.
+	data string
+	// hasChildren is set once the first child has been written.
+	hasChildren bool
+	// inline is set if the last child, or the start of the node if it has
+	// none yet, is inline content, as for Pruning.Whitespace.
+	inline bool
+	// start and end locate the node once it is closed.
+	start, end html.Position
+}
+
+// token returns the current tag token of z, with the attributes past
+// Limits.Attributes dropped.
+func (s *streamer) token(z *html.Tokenizer) html.Token {
+	var t = z.Token()
+
+	if max := s.limits.Attributes; max > 0 && len(t.Attr) > max {
+		s.truncate("attributes")
+		t.Attr = t.Attr[:max]
+	}
+
+	return t
+}
+
+// tooDeep reports whether an element added to the innermost open node
+// would be nested in more than Limits.Depth elements.
+func (s *streamer) tooDeep() bool {
+	if max := s.limits.Depth; max > 0 && len(s.stack)-1 >= max {
+		s.truncate("depth")
+		return true
+	}
+
+	return false
+}
+
+// truncate records that the document exceeded the limit called name.
+func (s *streamer) truncate(name string) {
+	if s.truncated == "" {
+		s.truncated = name
+	}
+}
+
+// done closes the nodes still open and ends the output. It returns the
+// LimitError of the first limit the document exceeded, if any.
+func (s *streamer) done() error {
+	s.release(s.inlineEnd())
+	s.stack[0].end = s.endPos
+
+	for len(s.stack) > 0 {
+		s.close()
+	}
+
+	s.w.WriteByte('\n')
+
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+
+	if s.truncated != "" {
+		return s.limits.error(s.truncated)
+	}
+
+	return nil
+}
+
+// open writes the start of a node that may have children and pushes it.
+func (s *streamer) open(typ html.NodeType, data string, attr []html.Attribute) {
+	s.child()
+	s.start(typ, data, attr)
+
+	var inline = typ == html.ElementNode && inlineElements[data]
+
+	if typ == html.ElementNode && preformatted[data] {
+		s.pre++
+	}
+
+	s.stack = append(s.stack, openNode{typ: typ, data: data, inline: inline, start: s.pos, end: s.endPos})
+}
+
+// leaf writes a node without children.
+func (s *streamer) leaf(typ html.NodeType, data string, attr []html.Attribute) {
+	s.child()
+	s.follow(typ == html.TextNode || typ == html.CommentNode || typ == html.ElementNode && inlineElements[data])
+
+	if s.compact && typ == html.TextNode {
+		s.string(clean(data))
+		return
+	}
+
+	s.start(typ, data, attr)
+
+	if !s.compact {
+		s.w.WriteString("null")
+	}
+
+	var n = openNode{typ: typ, start: s.pos, end: s.endPos}
+
+	s.extend(n.end)
+	s.finish(n)
+}
+
+// close pops the innermost open node and writes its end.
+func (s *streamer) close() {
+	var n = s.stack[len(s.stack)-1]
+
+	s.stack = s.stack[:len(s.stack)-1]
+
+	if n.typ == html.ElementNode && preformatted[n.data] {
+		s.pre--
+	}
+
+	if n.hasChildren {
+		s.w.WriteByte(']')
+	} else if !s.compact {
+		s.w.WriteString("null")
+	}
+
+	s.extend(n.end)
+	s.finish(n)
+	s.follow(n.typ == html.ElementNode && inlineElements[n.data])
+}
+
+// follow records whether the child just written to the innermost open node
+// is inline content.
+func (s *streamer) follow(inline bool) {
+	if len(s.stack) > 0 {
+		s.stack[len(s.stack)-1].inline = inline
+	}
+}
+
+// inlineEnd reports whether the end of the innermost open node is inline,
+// as the end of an inline element is.
+func (s *streamer) inlineEnd() bool {
+	var n = s.stack[len(s.stack)-1]
+
+	return n.typ == html.ElementNode && inlineElements[n.data]
+}
+
+// text writes a text token, pruned as s.prune asks.
+func (s *streamer) text(data string) {
+	var parent = s.stack[len(s.stack)-1]
+
+	if parent.typ == html.ElementNode && rawTextElements[parent.data] {
+		if !s.prune.Scripts || parent.data != "script" && parent.data != "style" {
+			s.leaf(html.TextNode, data, nil)
+		}
+
+		return
+	}
+
+	if s.pre == 0 && s.prune.Whitespace && isWhitespace(data) {
+		if s.space == nil {
+			s.space = &heldSpace{start: s.pos, keep: parent.inline}
+		}
+
+		s.space.data += data
+		s.space.end = s.endPos
+
+		return
+	}
+
+	s.release(true)
+
+	if s.pre == 0 && s.prune.Collapse {
+		data = collapse(data)
+	}
+
+	s.leaf(html.TextNode, data, nil)
+}
+
+// release writes the white space held back before the current token if it
+// separates inline content: if it follows inline content and, as next
+// reports, the token is inline content too.
+func (s *streamer) release(next bool) {
+	var held = s.space
+
+	if held == nil {
+		return
+	}
+
+	s.space = nil
+
+	if !held.keep || !next {
+		return
+	}
+
+	var data = held.data
+
+	if s.prune.Collapse {
+		data = collapse(data)
+	}
+
+	var pos, endPos = s.pos, s.endPos
+
+	s.pos, s.endPos = held.start, held.end
+	s.leaf(html.TextNode, data, nil)
+	s.pos, s.endPos = pos, endPos
+}
+
+// extend moves the end of the innermost open node to end if it is later.
+func (s *streamer) extend(end html.Position) {
+	if len(s.stack) == 0 {
+		return
+	}
+
+	if parent := &s.stack[len(s.stack)-1]; end.Offset > parent.end.Offset {
+		parent.end = end
+	}
+}
+
+// end closes the innermost open element called name and all the elements
+// opened after it. End tags without such an element are dropped.
+func (s *streamer) end(name string) {
+	for i := len(s.stack) - 1; i > 0; i-- {
+		if s.stack[i].data == name {
+			for len(s.stack) > i+1 {
+				s.close()
+			}
+
+			s.stack[i].end = s.endPos
+			s.close()
+
+			return
+		}
+	}
+}
+
+// implyEnd closes the open elements that a start tag called name ends
+// implicitly, up to the nearest scope element.
+func (s *streamer) implyEnd(name string) {
+	var closes = impliedEnd[name]
+
+	if closes == nil {
+		return
+	}
+
+	var outermost = -1
+
+	for i := len(s.stack) - 1; i > 0; i-- {
+		var data = s.stack[i].data
+
+		if contains(closes, data) {
+			outermost = i
+		} else if scopeElements[data] {
+			break
+		}
+	}
+
+	for outermost > 0 && len(s.stack) > outermost {
+		s.close()
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// child writes what separates a node from its preceding sibling, or opens
+// the list of children of its parent.
+func (s *streamer) child() {
+	if len(s.stack) == 0 {
+		return
+	}
+
+	var parent = &s.stack[len(s.stack)-1]
+
+	s.nodes++
+
+	if parent.hasChildren {
+		s.w.WriteByte(',')
+		return
+	}
+
+	parent.hasChildren = true
+
+	if s.compact {
+		s.w.WriteString(`,"children":`)
+	}
+
+	s.w.WriteByte('[')
+}
+
+// start writes a node up to its children: in the tag schema, up to the
+// Children key; in the compact schema, everything but the children.
+func (s *streamer) start(typ html.NodeType, data string, attr []html.Attribute) {
+	data = clean(data)
+
+	if !s.compact {
+		s.w.WriteString(`{"Data":`)
+		s.string(data)
+		s.w.WriteString(`,"Attributes":`)
+		s.tagAttributes(attr)
+		s.w.WriteString(`,"Children":`)
+		return
+	}
+
+	s.w.WriteString(`{"type":`)
+	s.string(TypeName(typ))
+
+	if data != "" {
+		s.w.WriteString(`,"data":`)
+		s.string(data)
+	}
+
+	if len(attr) > 0 {
+		s.w.WriteString(`,"attributes":`)
+		s.compactAttributes(attr)
+	}
+}
+
+// finish writes the end of a node after its children.
+func (s *streamer) finish(n openNode) {
+	if !s.compact {
+		s.w.WriteString(`,"Type":`)
+		s.w.WriteString(strconv.Itoa(int(n.typ)))
+	}
+
+	if s.positions {
+		s.w.WriteString(`,"Start":`)
+		s.position(n.start)
+		s.w.WriteString(`,"End":`)
+		s.position(n.end)
+	}
+
+	s.w.WriteByte('}')
+}
+
+func (s *streamer) position(p html.Position) {
+	s.w.WriteString(`{"Offset":`)
+	s.w.WriteString(strconv.Itoa(p.Offset))
+	s.w.WriteString(`,"Line":`)
+	s.w.WriteString(strconv.Itoa(p.Line))
+	s.w.WriteString(`,"Column":`)
+	s.w.WriteString(strconv.Itoa(p.Column))
+	s.w.WriteByte('}')
+}
+
+func (s *streamer) tagAttributes(attr []html.Attribute) {
+	if attr == nil {
+		s.w.WriteString("null")
+		return
+	}
+
+	s.w.WriteByte('[')
+
+	for i, a := range attr {
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+
+		s.w.WriteString(`{"Namespace":`)
+		s.string(a.Namespace)
+		s.w.WriteString(`,"Key":`)
+		s.string(a.Key)
+		s.w.WriteString(`,"Val":`)
+		s.string(a.Val)
+		s.w.WriteByte('}')
+	}
+
+	s.w.WriteByte(']')
+}
+
+// compactAttributes writes attr as an object with sorted keys, where later
+// duplicates win, as encoding the map of a Compact does.
+func (s *streamer) compactAttributes(attr []html.Attribute) {
+	var m = make(map[string]string, len(attr))
+	var keys []string
+
+	for _, a := range attr {
+		var key = a.Key
+
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + key
+		}
+
+		if _, ok := m[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		m[key] = a.Val
+	}
+
+	sort.Strings(keys)
+	s.w.WriteByte('{')
+
+	for i, key := range keys {
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+
+		s.string(key)
+		s.w.WriteByte(':')
+		s.string(m[key])
+	}
+
+	s.w.WriteByte('}')
+}
+
+// string writes v as a json string, escaped as encoding/json does.
+func (s *streamer) string(v string) {
+	const hex = "0123456789abcdef"
+
+	s.w.WriteByte('"')
+
+	var start = 0
+
+	for i := 0; i < len(v); {
+		if c := v[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+
+			s.w.WriteString(v[start:i])
+
+			switch c {
+			case '"', '\\':
+				s.w.WriteByte('\\')
+				s.w.WriteByte(c)
+			case '\n':
+				s.w.WriteString(`\n`)
+			case '\r':
+				s.w.WriteString(`\r`)
+			case '\t':
+				s.w.WriteString(`\t`)
+			case '\b':
+				s.w.WriteString(`\b`)
+			case '\f':
+				s.w.WriteString(`\f`)
+			default:
+				s.w.WriteString(`\u00`)
+				s.w.WriteByte(hex[c>>4])
+				s.w.WriteByte(hex[c&0xf])
+			}
+
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(v[i:])
+
+		if r == utf8.RuneError && size == 1 {
+			s.w.WriteString(v[start:i])
+			s.w.WriteRune(utf8.RuneError)
+			i += size
+			start = i
+			continue
+		}
+
+		if r == '\u2028' || r == '\u2029' {
+			s.w.WriteString(v[start:i])
+			s.w.WriteString(`\u202`)
+			s.w.WriteByte(hex[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+
+		i += size
+	}
+
+	s.w.WriteString(v[start:])
+	s.w.WriteByte('"')
+}
@@ -0,0 +1,154 @@
+package html2json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const streamPage = `<!DOCTYPE html><html><head><title>a &amp; b</title></head>` +
+	`<body class="x" id=y><p>one<br>two</p><!-- c --><img src="i.png" alt=""/>` +
+	`<noscript><p>no js</p></noscript><script>if (a < b) {}</script></body></html>`
+
+func TestStream(t *testing.T) {
+	for _, opts := range []*Options{{Schema: TagSchema}, {Schema: CompactSchema}, {Positions: true}, {DisableScripting: true}} {
+		var want, got bytes.Buffer
+
+		v, err := ConvertWith(strings.NewReader(streamPage), opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := json.NewEncoder(&want).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Stream(&got, strings.NewReader(streamPage), opts); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.String() != want.String() {
+			t.Errorf("%+v: got\n%s\nwant\n%s", *opts, got.String(), want.String())
+		}
+	}
+}
+
+func TestStreamNesting(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`<p>a<p>b`, `{"type":"document","children":[` +
+			`{"type":"element","data":"p","children":["a"]},` +
+			`{"type":"element","data":"p","children":["b"]}]}`},
+		{`<ul><li>a<ul><li>b<li>c</ul><li>d</ul>`, `{"type":"document","children":[` +
+			`{"type":"element","data":"ul","children":[` +
+			`{"type":"element","data":"li","children":["a",` +
+			`{"type":"element","data":"ul","children":[` +
+			`{"type":"element","data":"li","children":["b"]},` +
+			`{"type":"element","data":"li","children":["c"]}]}]},` +
+			`{"type":"element","data":"li","children":["d"]}]}]}`},
+		{`<table><tr><td>1<td>2<tr><td>3</table>`, `{"type":"document","children":[` +
+			`{"type":"element","data":"table","children":[` +
+			`{"type":"element","data":"tr","children":[` +
+			`{"type":"element","data":"td","children":["1"]},` +
+			`{"type":"element","data":"td","children":["2"]}]},` +
+			`{"type":"element","data":"tr","children":[` +
+			`{"type":"element","data":"td","children":["3"]}]}]}]}`},
+		{`<div>a</span>b</div>c`, `{"type":"document","children":[` +
+			`{"type":"element","data":"div","children":["a","b"]},"c"]}`},
+		{`<div><b>unclosed`, `{"type":"document","children":[` +
+			`{"type":"element","data":"div","children":[` +
+			`{"type":"element","data":"b","children":["unclosed"]}]}]}`},
+		{`<a href=1 b=2 href=3></a>`, `{"type":"document","children":[` +
+			`{"type":"element","data":"a","attributes":{"b":"2","href":"3"}}]}`},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+
+		if err := Stream(&b, strings.NewReader(test.in), &Options{Schema: CompactSchema}); err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+
+		if got := strings.TrimSpace(b.String()); got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.in, got, test.want)
+		}
+	}
+}
+
+func TestStreamQuery(t *testing.T) {
+	var b bytes.Buffer
+
+	err := Stream(&b, strings.NewReader("<p>"), &Options{Select: []string{"p"}})
+
+	if err != ErrStreamQuery {
+		t.Errorf("got %v, want ErrStreamQuery", err)
+	}
+}
+
+// benchmarkTable returns a document with a table of the given number of
+// rows.
+func benchmarkTable(rows int) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("<!DOCTYPE html><html><head><title>log</title></head><body><table>")
+
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&b, `<tr class="row"><td>%d</td><td>GET /index.html</td><td><a href="/r/%d">detail</a></td></tr>`, i, i)
+	}
+
+	b.WriteString("</table></body></html>")
+	return b.Bytes()
+}
+
+func BenchmarkConvertTable(b *testing.B) {
+	var page = benchmarkTable(10000)
+
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v, err := ConvertWith(bytes.NewReader(page), nil)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := json.NewEncoder(ioutil.Discard).Encode(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStreamTable(b *testing.B) {
+	var page = benchmarkTable(10000)
+
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := Stream(ioutil.Discard, bytes.NewReader(page), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStreamEscape(t *testing.T) {
+	var s = "q\" b\\ <>& \n\r\t\x00\x1f\b\f    \xff é \U0001F600"
+	var b bytes.Buffer
+
+	if err := Stream(&b, strings.NewReader(s), &Options{Schema: CompactSchema}); err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := json.Marshal(s)
+
+	if got := b.String(); !strings.Contains(got, string(want)) {
+		t.Errorf("got %s, want it to contain %s", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+// Package html2json converts html documents into a tree of Tags that
+// encodes naturally as json.
+package html2json
+
+import (
+	"exp/html"
+	"io"
+	"strings"
+)
+
+// A Tag is the json representation of an html.Node.
+type Tag struct {
+	Data       string
+	Attributes []html.Attribute
+	Children   []*Tag
+	Type       html.NodeType
+	// Start and End locate the node in the source document. They are only
+	// set if Options.Positions asks for them.
+	Start *html.Position `json:",omitempty"`
+	End   *html.Position `json:",omitempty"`
+}
+
+// NewTag returns the Tag tree rooted at n.
+func NewTag(n *html.Node) *Tag {
+	return newTag(n, false)
+}
+
+// newTag returns the Tag tree rooted at n, with the positions of the nodes
+// if positions is set and the parser recorded them.
+func newTag(n *html.Node, positions bool) *Tag {
+	var t = &Tag{
+		Data:       clean(n.Data),
+		Attributes: n.Attr,
+		Children:   nil,
+		Type:       n.Type,
+	}
+
+	if positions && n.Start.Line > 0 {
+		var start, end = n.Start, n.End
+
+		t.Start, t.End = &start, &end
+	}
+
+	for _, child := range n.Child {
+		t.Children = append(t.Children, newTag(child, positions))
+	}
+
+	return t
+}
+
+// Convert parses the html read from r and returns its Tag tree.
+func Convert(r io.Reader) (*Tag, error) {
+	node, err := html.Parse(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTag(node), nil
+}
+
+// clean removes the stray "\\xa6" sequences some pages carry from node
+// data.
+func clean(data string) string {
+	return strings.Replace(data, "\\xa6", "", -1)
+}
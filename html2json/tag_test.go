@@ -0,0 +1,127 @@
+package html2json
+
+import (
+	"exp/html"
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tag, err := Convert(strings.NewReader(`<p id="a">x</p>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag.Type != html.DocumentNode || len(tag.Children) != 1 {
+		t.Fatalf("got %+v, want a document with one child", tag)
+	}
+
+	body := tag.Children[0].Children[1]
+	p := body.Children[0]
+
+	if body.Data != "body" || p.Data != "p" || p.Type != html.ElementNode {
+		t.Fatalf("got %+v, want body > p", body)
+	}
+
+	if len(p.Attributes) != 1 || p.Attributes[0].Key != "id" || p.Attributes[0].Val != "a" {
+		t.Errorf("got attributes %v, want id=a", p.Attributes)
+	}
+
+	if len(p.Children) != 1 || p.Children[0].Type != html.TextNode || p.Children[0].Data != "x" {
+		t.Errorf("got children %v, want the text x", p.Children)
+	}
+}
+
+func TestConvertPositions(t *testing.T) {
+	v, err := ConvertWith(strings.NewReader("<p>a</p>\n<p>é</p>"), &Options{Positions: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body = v.(*Tag).Children[0].Children[1]
+
+	if len(body.Children) != 3 {
+		t.Fatalf("got %+v, want two paragraphs and a newline", body.Children)
+	}
+
+	for i, want := range []string{"1:1-1:9", "1:9-2:1", "2:1-2:9"} {
+		var c = body.Children[i]
+
+		if c.Start == nil || c.End == nil {
+			t.Errorf("child %d has no position", i)
+			continue
+		}
+
+		if got := c.Start.String() + "-" + c.End.String(); got != want {
+			t.Errorf("child %d: got %s, want %s", i, got, want)
+		}
+	}
+
+	if end := body.Children[2].End.Offset; end != 18 {
+		t.Errorf("got end offset %d, want 18", end)
+	}
+
+	tag, err := Convert(strings.NewReader("<p>a</p>"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag.Start != nil {
+		t.Errorf("got position %v without asking for it", tag.Start)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	v, err := ConvertWith(strings.NewReader("<!DOCTYPE html><p>a</b>"), &Options{Errors: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, ok := v.(*Report)
+
+	if !ok {
+		t.Fatalf("got %T, want a *Report", v)
+	}
+
+	if _, ok := report.Document.(*Tag); !ok {
+		t.Errorf("got document %T, want a *Tag", report.Document)
+	}
+
+	if len(report.Errors) != 1 || report.Errors[0].Code != "unexpected-end-tag" || report.Errors[0].Pos.Column != 20 {
+		t.Errorf("got %v, want an unexpected-end-tag at 1:20", report.Errors)
+	}
+}
+
+func TestConvertFragment(t *testing.T) {
+	v, err := ConvertWith(strings.NewReader("<tr><td>a</td></tr><tr><td>b</td></tr>"), &Options{Fragment: true, Context: "TBODY"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, ok := v.([]interface{})
+
+	if !ok || len(tags) != 2 {
+		t.Fatalf("got %#v, want two rows", v)
+	}
+
+	for _, tag := range tags {
+		if tag := tag.(*Tag); tag.Data != "tr" {
+			t.Errorf("got <%s>, want <tr>", tag.Data)
+		}
+	}
+
+	v, err = ConvertWith(strings.NewReader("<li>a<li>b"), &Options{Fragment: true, XPath: []string{"count(/li)"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := v.(map[string]interface{})["count(/li)"]; got != 2.0 {
+		t.Errorf("got %v items, want 2", got)
+	}
+}
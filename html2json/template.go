@@ -0,0 +1,314 @@
+package html2json
+
+import (
+	"bytes"
+	"encoding/json"
+	"exp/html"
+	"fmt"
+	"selector"
+	"strings"
+	"xpath"
+)
+
+// A Template maps a document to a json object of the caller's design. It
+// is written as a json object whose keys are the output fields and whose
+// values describe how each field is extracted:
+//
+//	{
+//		"title":  "h1",
+//		"price":  {"selector": ".price", "extract": "text"},
+//		"images": [{"selector": "img", "extract": "attr", "attr": "src"}],
+//		"body":   {"xpath": "//div[@id='content']", "extract": "html"},
+//		"items":  [{"selector": "li.item", "fields": {
+//			"name": "a",
+//			"url":  {"selector": "a", "extract": "attr", "attr": "href"}
+//		}}]
+//	}
+//
+// A field is either a CSS selector, whose first match yields the field's
+// text, or an object with these keys:
+//
+//	selector  a CSS selector matched against the descendants of the node
+//	xpath     an XPath expression evaluated with the node as context,
+//	          instead of a selector
+//	extract   what to output for a match: "text" (the default), "html",
+//	          "inner-html", "attr" or "tree", the json tree of the match
+//	attr      the attribute to output for "attr"
+//	fields    a nested template applied to each match, instead of extract
+//
+// Without selector and xpath, a field refers to the node itself. Wrapping a
+// field in a one element list outputs all matches instead of the first.
+// Fields without a match are null, or an empty list. XPath expressions that
+// compute a string, number or boolean output it directly.
+type Template struct {
+	fields map[string]*templateField
+}
+
+type templateField struct {
+	sel     selector.Selector
+	xpath   *xpath.Expr
+	extract string
+	attr    string
+	fields  *Template
+	list    bool
+}
+
+// ParseTemplate parses a template from its json representation.
+func ParseTemplate(data []byte) (*Template, error) {
+	var v interface{}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	return newTemplate(v, "")
+}
+
+// newTemplate returns the template described by the decoded json value v.
+// path names v in error messages.
+func newTemplate(v interface{}, path string) (*Template, error) {
+	m, ok := v.(map[string]interface{})
+
+	if !ok {
+		return nil, templateErrorf(path, "a template must be an object")
+	}
+
+	var t = &Template{fields: make(map[string]*templateField, len(m))}
+
+	for name, spec := range m {
+		f, err := newTemplateField(spec, path+"."+name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.fields[name] = f
+	}
+
+	return t, nil
+}
+
+func newTemplateField(v interface{}, path string) (*templateField, error) {
+	switch v := v.(type) {
+	case string:
+		sel, err := selector.Compile(v)
+
+		if err != nil {
+			return nil, templateErrorf(path, "%v", err)
+		}
+
+		return &templateField{sel: sel, extract: "text"}, nil
+	case []interface{}:
+		if len(v) != 1 {
+			return nil, templateErrorf(path, "a list field must have exactly one element")
+		}
+
+		f, err := newTemplateField(v[0], path+"[0]")
+
+		if err != nil {
+			return nil, err
+		}
+
+		if f.list {
+			return nil, templateErrorf(path, "lists cannot be nested directly")
+		}
+
+		f.list = true
+		return f, nil
+	case map[string]interface{}:
+		return newTemplateObject(v, path)
+	}
+
+	return nil, templateErrorf(path, "a field must be a selector, an object or a list")
+}
+
+func newTemplateObject(m map[string]interface{}, path string) (*templateField, error) {
+	var f = &templateField{extract: "text"}
+
+	for key, v := range m {
+		if key == "fields" {
+			continue
+		}
+
+		s, ok := v.(string)
+
+		if !ok {
+			return nil, templateErrorf(path, "%s must be a string", key)
+		}
+
+		var err error
+
+		switch key {
+		case "selector":
+			f.sel, err = selector.Compile(s)
+		case "xpath":
+			f.xpath, err = xpath.Compile(s)
+		case "extract":
+			f.extract = s
+		case "attr":
+			f.attr = s
+		default:
+			return nil, templateErrorf(path, "unknown key %q", key)
+		}
+
+		if err != nil {
+			return nil, templateErrorf(path, "%v", err)
+		}
+	}
+
+	if f.sel != nil && f.xpath != nil {
+		return nil, templateErrorf(path, "selector and xpath are mutually exclusive")
+	}
+
+	if fields, ok := m["fields"]; ok {
+		var err error
+
+		if f.fields, err = newTemplate(fields, path); err != nil {
+			return nil, err
+		}
+
+		return f, nil
+	}
+
+	switch f.extract {
+	case "text", "html", "inner-html", "tree":
+	case "attr":
+		if f.attr == "" {
+			return nil, templateErrorf(path, `extract "attr" needs an attr`)
+		}
+	default:
+		return nil, templateErrorf(path, "unknown extract %q", f.extract)
+	}
+
+	return f, nil
+}
+
+func templateErrorf(path, format string, args ...interface{}) error {
+	if path == "" {
+		path = "."
+	}
+
+	return fmt.Errorf("html2json: template %s: %s", path, fmt.Sprintf(format, args...))
+}
+
+// Apply extracts the template's fields from n. Matches extracted as "tree"
+// are laid out as selected by opts.
+func (t *Template) Apply(n *html.Node, opts *Options) (map[string]interface{}, error) {
+	var result = make(map[string]interface{}, len(t.fields))
+
+	for name, f := range t.fields {
+		v, err := f.apply(n, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result[name] = v
+	}
+
+	return result, nil
+}
+
+func (f *templateField) apply(n *html.Node, opts *Options) (interface{}, error) {
+	matches, scalar, err := f.match(n)
+
+	if err != nil || scalar != nil {
+		return scalar, err
+	}
+
+	if !f.list {
+		if len(matches) == 0 {
+			return nil, nil
+		}
+
+		return f.value(matches[0], opts)
+	}
+
+	var values = []interface{}{}
+
+	for _, m := range matches {
+		v, err := f.value(m, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// match returns the nodes the field refers to, or the json value of an
+// XPath expression that does not select nodes.
+func (f *templateField) match(n *html.Node) ([]xpath.Node, interface{}, error) {
+	var matches []xpath.Node
+
+	switch {
+	case f.sel != nil:
+		for _, c := range n.Child {
+			for _, m := range f.sel.MatchAll(c) {
+				matches = append(matches, xpath.Node{Node: m})
+			}
+		}
+	case f.xpath != nil:
+		v, err := f.xpath.Evaluate(n)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ns, ok := v.([]xpath.Node)
+
+		if !ok {
+			return nil, scalarValue(v), nil
+		}
+
+		matches = ns
+	default:
+		matches = []xpath.Node{{Node: n}}
+	}
+
+	return matches, nil, nil
+}
+
+// value extracts the field from one of its matches.
+func (f *templateField) value(m xpath.Node, opts *Options) (interface{}, error) {
+	if m.IsAttr() {
+		// Attributes have nothing but their value to offer.
+		return m.Attr.Val, nil
+	}
+
+	if f.fields != nil {
+		return f.fields.Apply(m.Node, opts)
+	}
+
+	switch f.extract {
+	case "html":
+		var b bytes.Buffer
+		err := html.Render(&b, m.Node)
+		return b.String(), err
+	case "inner-html":
+		var b bytes.Buffer
+
+		for _, c := range m.Child {
+			if err := html.Render(&b, c); err != nil {
+				return nil, err
+			}
+		}
+
+		return b.String(), nil
+	case "attr":
+		for _, a := range m.Node.Attr {
+			if a.Key == f.attr {
+				return a.Val, nil
+			}
+		}
+
+		return nil, nil
+	case "tree":
+		return NewValue(m.Node, opts), nil
+	}
+
+	return strings.Join(strings.Fields(xpath.Node{Node: m.Node}.String()), " "), nil
+}
@@ -0,0 +1,112 @@
+package html2json
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const productPage = `<html><body>
+<h1> Blue   widget </h1>
+<span class="price" data-currency="EUR">9.99</span>
+<div id="gallery"><img src="/1.png"><img src="/2.png"></div>
+<ul><li class="review"><b>Ann</b> <i>Great</i></li><li class="review"><b>Bob</b></li></ul>
+<div class="desc"><p>A <em>fine</em> widget.</p></div>
+</body></html>`
+
+const productTemplate = `{
+	"title": "h1",
+	"price": {"selector": ".price"},
+	"currency": {"selector": ".price", "extract": "attr", "attr": "data-currency"},
+	"images": [{"selector": "#gallery img", "extract": "attr", "attr": "src"}],
+	"srcs": {"xpath": "//img/@src"},
+	"count": {"xpath": "count(//img)"},
+	"description": {"selector": ".desc", "extract": "inner-html"},
+	"first": {"selector": "em", "extract": "html"},
+	"reviews": [{"selector": "li.review", "fields": {
+		"author": "b",
+		"text": {"selector": "i"},
+		"all": {}
+	}}],
+	"missing": "table",
+	"none": ["table"]
+}`
+
+func TestTemplate(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(productTemplate))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := ConvertWith(strings.NewReader(productPage), &Options{Template: tmpl})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	var enc = json.NewEncoder(&b)
+
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `{"count":2,"currency":"EUR",` +
+		`"description":"<p>A <em>fine</em> widget.</p>",` +
+		`"first":"<em>fine</em>",` +
+		`"images":["/1.png","/2.png"],"missing":null,"none":[],"price":"9.99",` +
+		`"reviews":[{"all":"Ann Great","author":"Ann","text":"Great"},{"all":"Bob","author":"Bob","text":null}],` +
+		`"srcs":"/1.png","title":"Blue widget"}` + "\n"
+
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestTemplateNumbers(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"n": {"xpath": "number(//b)"}, "inf": {"xpath": "1 div 0"}, "one": {"xpath": "number(//i)"}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := ConvertWith(strings.NewReader("<b>x</b><i>1</i>"), &Options{Template: tmpl})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"inf":null,"n":null,"one":1}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
+
+func TestTemplateError(t *testing.T) {
+	for _, src := range []string{
+		`[]`,
+		`{"a": 1}`,
+		`{"a": "p["}`,
+		`{"a": {"xpath": "//["}}`,
+		`{"a": {"selector": "p", "xpath": "//p"}}`,
+		`{"a": {"extract": "attr"}}`,
+		`{"a": {"extract": "bogus"}}`,
+		`{"a": {"bogus": "x"}}`,
+		`{"a": ["p", "q"]}`,
+		`{"a": [["p"]]}`,
+		`{"a": {"fields": "p"}}`,
+	} {
+		if _, err := ParseTemplate([]byte(src)); err == nil {
+			t.Errorf("ParseTemplate(%s) succeeded, want an error", src)
+		}
+	}
+}
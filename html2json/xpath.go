@@ -0,0 +1,54 @@
+package html2json
+
+import (
+	"exp/html"
+	"math"
+	"xpath"
+)
+
+// XPath evaluates the XPath expression with n as the context node and
+// returns its json value. Node-sets become a list of the selected subtrees,
+// with attributes represented by their value. Strings, numbers and booleans
+// are returned as is, except for NaN and infinities, which json cannot
+// represent and become nil.
+func XPath(n *html.Node, expr string, opts *Options) (interface{}, error) {
+	e, err := xpath.Compile(expr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := e.Evaluate(n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case []xpath.Node:
+		var values = []interface{}{}
+
+		for _, m := range v {
+			if m.IsAttr() {
+				values = append(values, m.Attr.Val)
+			} else {
+				values = append(values, NewValue(m.Node, opts))
+			}
+		}
+
+		return values, nil
+	}
+
+	return scalarValue(v), nil
+}
+
+// scalarValue returns the json value of the string, number or boolean
+// result of an XPath expression: v itself, or nil for NaN and infinities,
+// which json cannot represent.
+func scalarValue(v interface{}) interface{} {
+	if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return nil
+	}
+
+	return v
+}
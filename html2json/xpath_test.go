@@ -0,0 +1,44 @@
+package html2json
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestXPath(t *testing.T) {
+	var opts = &Options{
+		Schema: CompactSchema,
+		Select: []string{"b"},
+		XPath:  []string{"//a/@href", "count(//a)", "//a[1]", "string(//b)", "0 div 0"},
+	}
+
+	v, err := ConvertWith(strings.NewReader(`<a href="/x">x</a><a href="/y">y</a><b>z</b>`), opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `{"//a/@href":["/x","/y"],` +
+		`"//a[1]":[{"type":"element","data":"a","attributes":{"href":"/x"},"children":["x"]}],` +
+		`"0 div 0":null,` +
+		`"b":[{"type":"element","data":"b","children":["z"]}],` +
+		`"count(//a)":2,` +
+		`"string(//b)":"z"}`
+
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+
+	opts.XPath = []string{"//a["}
+
+	if _, err := ConvertWith(strings.NewReader(""), opts); err == nil {
+		t.Errorf("got no error for an invalid expression")
+	}
+}
@@ -0,0 +1,236 @@
+package metadata
+
+import (
+	"exp/html"
+	"strings"
+)
+
+// An Item is a schema.org or other vocabulary item: a microdata item,
+// described by an element with an itemscope attribute, or an RDFa Lite
+// resource, described by an element with a typeof attribute.
+type Item struct {
+	// Type lists the itemtype URLs of a microdata item, or the typeof
+	// types of an RDFa resource, prefixed with its vocab.
+	Type []string `json:",omitempty"`
+	// ID is the itemid of a microdata item or the resource of an RDFa one.
+	ID string `json:",omitempty"`
+	// Properties maps property names to their values, strings or nested
+	// *Items, in document order.
+	Properties map[string][]interface{}
+}
+
+// urlProperties maps the elements whose property value is a URL to the
+// attribute holding it.
+var urlProperties = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"audio":  "src",
+	"embed":  "src",
+	"iframe": "src",
+	"img":    "src",
+	"link":   "href",
+	"object": "data",
+	"source": "src",
+	"track":  "src",
+	"video":  "src",
+}
+
+// items returns the top-level items of doc: the elements with itemscope
+// but no itemprop, and those with typeof but no property.
+func items(doc *html.Node) []*Item {
+	ids := make(map[string]*html.Node)
+	walk(doc, func(n *html.Node) bool {
+		if id := attr(n, "id"); n.Type == html.ElementNode && id != "" && ids[id] == nil {
+			ids[id] = n
+		}
+		return true
+	})
+	c := &crawler{ids: ids, visiting: make(map[*html.Node]bool)}
+	var items []*Item
+	walk(doc, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		if isScope(n) && !isProperty(n) {
+			items = append(items, c.microdata(n))
+		}
+		if isResource(n) && !isRDFaProperty(n) {
+			items = append(items, rdfa(n))
+		}
+		return true
+	})
+	return items
+}
+
+// A crawler collects the properties of microdata items.
+type crawler struct {
+	// ids maps ids to the elements that itemref attributes refer to.
+	ids map[string]*html.Node
+	// visiting holds the items being crawled, which itemref attributes
+	// must not make properties of themselves.
+	visiting map[*html.Node]bool
+}
+
+func isScope(n *html.Node) bool {
+	_, ok := attrOK(n, "itemscope")
+	return ok
+}
+
+func isProperty(n *html.Node) bool {
+	return strings.TrimSpace(attr(n, "itemprop")) != ""
+}
+
+// microdata returns the item of the itemscope element n.
+func (c *crawler) microdata(n *html.Node) *Item {
+	item := &Item{
+		Type:       strings.Fields(attr(n, "itemtype")),
+		ID:         strings.TrimSpace(attr(n, "itemid")),
+		Properties: make(map[string][]interface{}),
+	}
+	c.visiting[n] = true
+	defer delete(c.visiting, n)
+	for _, child := range n.Child {
+		c.properties(child, item)
+	}
+	for _, id := range strings.Fields(attr(n, "itemref")) {
+		if ref := c.ids[id]; ref != nil && !inside(n, ref) {
+			c.properties(ref, item)
+		}
+	}
+	return item
+}
+
+// properties adds the properties in the tree rooted at n to item, without
+// going into nested items.
+func (c *crawler) properties(n *html.Node, item *Item) {
+	if n.Type != html.ElementNode {
+		return
+	}
+	if names := strings.Fields(attr(n, "itemprop")); len(names) > 0 {
+		var v interface{}
+		switch {
+		case !isScope(n):
+			v = microdataValue(n)
+		case !c.visiting[n]:
+			v = c.microdata(n)
+		}
+		if v != nil {
+			for _, name := range names {
+				item.Properties[name] = append(item.Properties[name], v)
+			}
+		}
+	}
+	if isScope(n) {
+		return
+	}
+	for _, child := range n.Child {
+		c.properties(child, item)
+	}
+}
+
+// microdataValue returns the value of the itemprop element n.
+func microdataValue(n *html.Node) string {
+	if a, ok := urlProperties[n.Data]; ok {
+		return strings.TrimSpace(attr(n, a))
+	}
+	switch n.Data {
+	case "meta":
+		return attr(n, "content")
+	case "data", "meter":
+		return attr(n, "value")
+	case "time":
+		if v, ok := attrOK(n, "datetime"); ok {
+			return v
+		}
+	}
+	return strings.Join(strings.Fields(textOf(n)), " ")
+}
+
+func isResource(n *html.Node) bool {
+	_, ok := attrOK(n, "typeof")
+	return ok
+}
+
+func isRDFaProperty(n *html.Node) bool {
+	return strings.TrimSpace(attr(n, "property")) != ""
+}
+
+// rdfa returns the item of the typeof element n.
+func rdfa(n *html.Node) *Item {
+	item := &Item{
+		ID:         strings.TrimSpace(attr(n, "resource")),
+		Properties: make(map[string][]interface{}),
+	}
+	vocab := vocabulary(n)
+	for _, t := range strings.Fields(attr(n, "typeof")) {
+		if !strings.Contains(t, ":") {
+			t = vocab + t
+		}
+		item.Type = append(item.Type, t)
+	}
+	for _, child := range n.Child {
+		rdfaProperties(child, item)
+	}
+	return item
+}
+
+// rdfaProperties adds the RDFa properties in the tree rooted at n to item,
+// without going into nested resources.
+func rdfaProperties(n *html.Node, item *Item) {
+	if n.Type != html.ElementNode {
+		return
+	}
+	if names := strings.Fields(attr(n, "property")); len(names) > 0 {
+		var v interface{}
+		if isResource(n) {
+			v = rdfa(n)
+		} else {
+			v = rdfaValue(n)
+		}
+		for _, name := range names {
+			item.Properties[name] = append(item.Properties[name], v)
+		}
+	}
+	if isResource(n) {
+		return
+	}
+	for _, child := range n.Child {
+		rdfaProperties(child, item)
+	}
+}
+
+// rdfaValue returns the value of the property element n.
+func rdfaValue(n *html.Node) string {
+	if v, ok := attrOK(n, "content"); ok {
+		return v
+	}
+	for _, a := range []string{"resource", "href", "src"} {
+		if v, ok := attrOK(n, a); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	if v, ok := attrOK(n, "datetime"); ok && n.Data == "time" {
+		return v
+	}
+	return strings.Join(strings.Fields(textOf(n)), " ")
+}
+
+// vocabulary returns the vocab in scope at n.
+func vocabulary(n *html.Node) string {
+	for ; n != nil; n = n.Parent {
+		if v, ok := attrOK(n, "vocab"); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// inside reports whether n is ancestor or one of its descendants.
+func inside(ancestor, n *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+// Package metadata reads the structured metadata of pages from exp/html
+// parse trees: the title, the meta elements with Open Graph and Twitter
+// card properties, canonical, alternate and icon links, embedded JSON-LD
+// and the items described with schema.org microdata or RDFa Lite.
+//
+//	doc, err := html.Parse(r)
+//	if err != nil {
+//		// ...
+//	}
+//	m := metadata.Extract(doc)
+//	fmt.Println(m.OpenGraph["og:title"])
+//
+// URLs are returned as they are written on the page.
+package metadata
+
+import (
+	"encoding/json"
+	"exp/html"
+	"strings"
+)
+
+// Metadata is the metadata of a page. Meta elements are keyed by their
+// name or property in lower case, with a value for each of the elements
+// that set it, in document order.
+type Metadata struct {
+	Title string `json:",omitempty"`
+	// Meta holds the named meta elements other than those of OpenGraph
+	// and Twitter, such as "description", "keywords" and "robots".
+	Meta map[string][]string `json:",omitempty"`
+	// OpenGraph holds the Open Graph properties, such as "og:title",
+	// "og:image" and "article:published_time".
+	OpenGraph map[string][]string `json:",omitempty"`
+	// Twitter holds the Twitter card properties, such as "twitter:card".
+	Twitter    map[string][]string `json:",omitempty"`
+	Canonical  string              `json:",omitempty"`
+	Alternates []*Link             `json:",omitempty"`
+	Icons      []*Link             `json:",omitempty"`
+	// JSONLD holds the value of each script element of type
+	// application/ld+json. Scripts that are not valid json are skipped.
+	JSONLD []interface{} `json:",omitempty"`
+	// Items holds the top-level microdata and RDFa items.
+	Items []*Item `json:",omitempty"`
+}
+
+// A Link is a link element.
+type Link struct {
+	Href     string
+	Rel      string `json:",omitempty"`
+	Hreflang string `json:",omitempty"`
+	Type     string `json:",omitempty"`
+	Media    string `json:",omitempty"`
+	Sizes    string `json:",omitempty"`
+	Title    string `json:",omitempty"`
+}
+
+// openGraphPrefixes are the prefixes of Open Graph properties.
+var openGraphPrefixes = []string{"og:", "fb:", "article:", "book:", "books:", "business:", "music:", "place:", "product:", "profile:", "restaurant:", "video:"}
+
+// iconRels are the link relations of icons.
+var iconRels = map[string]bool{
+	"apple-touch-icon":             true,
+	"apple-touch-icon-precomposed": true,
+	"icon":                         true,
+	"mask-icon":                    true,
+}
+
+// Extract returns the metadata of the document doc. It does not change doc.
+func Extract(doc *html.Node) *Metadata {
+	m := &Metadata{
+		Meta:      make(map[string][]string),
+		OpenGraph: make(map[string][]string),
+		Twitter:   make(map[string][]string),
+	}
+	walk(doc, func(n *html.Node) bool {
+		if n.Type != html.ElementNode || n.Namespace != "" {
+			return true
+		}
+		switch n.Data {
+		case "title":
+			if m.Title == "" {
+				m.Title = strings.Join(strings.Fields(textOf(n)), " ")
+			}
+		case "meta":
+			m.readMeta(n)
+		case "link":
+			m.readLink(n)
+		case "script":
+			if isJSONLD(attr(n, "type")) {
+				var v interface{}
+				if err := json.Unmarshal([]byte(textOf(n)), &v); err == nil {
+					m.JSONLD = append(m.JSONLD, v)
+				}
+			}
+		case "svg", "math", "template":
+			return false
+		}
+		return true
+	})
+	m.Items = items(doc)
+	if len(m.Meta) == 0 {
+		m.Meta = nil
+	}
+	if len(m.OpenGraph) == 0 {
+		m.OpenGraph = nil
+	}
+	if len(m.Twitter) == 0 {
+		m.Twitter = nil
+	}
+	return m
+}
+
+// readMeta adds the meta element n to m.
+func (m *Metadata) readMeta(n *html.Node) {
+	content, ok := attrOK(n, "content")
+	if !ok {
+		return
+	}
+	content = strings.TrimSpace(content)
+	// A property may list several, as in "og:title twitter:title". Those
+	// without a prefix are the properties of RDFa items.
+	var keys []string
+	for _, k := range strings.Fields(strings.ToLower(attr(n, "property"))) {
+		if strings.Contains(k, ":") {
+			keys = append(keys, k)
+		}
+	}
+	if name := strings.TrimSpace(strings.ToLower(attr(n, "name"))); name != "" {
+		keys = append(keys, name)
+	}
+	for _, k := range keys {
+		switch {
+		case strings.HasPrefix(k, "twitter:"):
+			m.Twitter[k] = append(m.Twitter[k], content)
+		case hasPrefix(k, openGraphPrefixes):
+			m.OpenGraph[k] = append(m.OpenGraph[k], content)
+		default:
+			m.Meta[k] = append(m.Meta[k], content)
+		}
+	}
+}
+
+// readLink adds the link element n to m if it is canonical, an alternate
+// or an icon.
+func (m *Metadata) readLink(n *html.Node) {
+	href, ok := attrOK(n, "href")
+	if !ok {
+		return
+	}
+	href = strings.TrimSpace(href)
+	rels := strings.Fields(strings.ToLower(attr(n, "rel")))
+	link := &Link{
+		Href:     href,
+		Rel:      strings.Join(rels, " "),
+		Hreflang: attr(n, "hreflang"),
+		Type:     attr(n, "type"),
+		Media:    attr(n, "media"),
+		Sizes:    attr(n, "sizes"),
+		Title:    attr(n, "title"),
+	}
+	has := make(map[string]bool)
+	for _, rel := range rels {
+		if iconRels[rel] {
+			// "alternate icon" is an icon, not an alternate version.
+			m.Icons = append(m.Icons, link)
+			return
+		}
+		has[rel] = true
+	}
+	if has["canonical"] && m.Canonical == "" {
+		m.Canonical = href
+	}
+	if has["alternate"] {
+		m.Alternates = append(m.Alternates, link)
+	}
+}
+
+// isJSONLD reports whether the script type t is JSON-LD.
+func isJSONLD(t string) bool {
+	if i := strings.Index(t, ";"); i != -1 {
+		t = t[:i]
+	}
+	return strings.EqualFold(strings.TrimSpace(t), "application/ld+json")
+}
+
+func hasPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls f for the nodes of the tree rooted at n in document order,
+// skipping the children of those for which it returns false.
+func walk(n *html.Node, f func(*html.Node) bool) {
+	if !f(n) {
+		return
+	}
+	for _, c := range n.Child {
+		walk(c, f)
+	}
+}
+
+// textOf returns the text of the tree rooted at n as it is.
+func textOf(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b []byte
+	for _, c := range n.Child {
+		b = append(b, textOf(c)...)
+	}
+	return string(b)
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := attrOK(n, key)
+	return v
+}
+
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key && a.Namespace == "" {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,108 @@
+package metadata
+
+import (
+	"encoding/json"
+	"exp/html"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html><html><head>
+<title>  A  Page </title>
+<meta name=Description content="About a page">
+<meta property="og:title twitter:title" content="The Page">
+<meta property="og:image" content="/a.png"><meta property="og:image" content="/b.png">
+<meta name="twitter:card" content="summary">
+<meta property="article:published_time" content="2012-06-01">
+<link rel=canonical href=" http://example.com/page ">
+<link rel=alternate hreflang=fr href="/fr/page">
+<link rel="alternate icon" type="image/png" href="/favicon.png">
+<link rel=apple-touch-icon sizes=180x180 href="/touch.png">
+<link rel=stylesheet href="/s.css">
+<script type="application/ld+json">{"@context": "https://schema.org", "@type": "Article", "headline": "The Page"}</script>
+<script type="application/ld+json">{not json</script>
+</head><body>
+<div itemscope itemtype="https://schema.org/Person" itemref="a">
+  <span itemprop="name">Ann  Lee</span>
+  <a itemprop="url" href="/ann">home</a>
+  <div itemprop="address" itemscope itemtype="https://schema.org/PostalAddress">
+    <span itemprop="addressLocality">Paris</span>
+  </div>
+</div>
+<p id=a><time itemprop="birthDate" datetime="1980-01-02">2 Jan</time></p>
+<div vocab="https://schema.org/" typeof="Event" resource="#e">
+  <span property="name">Launch</span>
+  <meta property="startDate" content="2012-07-01">
+  <div property="location" typeof="Place"><span property="name">Hall</span></div>
+</div>
+</body></html>`
+
+func TestExtract(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Extract(doc)
+
+	want := &Metadata{
+		Title:     "A Page",
+		Meta:      map[string][]string{"description": {"About a page"}},
+		OpenGraph: map[string][]string{"og:title": {"The Page"}, "og:image": {"/a.png", "/b.png"}, "article:published_time": {"2012-06-01"}},
+		Twitter:   map[string][]string{"twitter:title": {"The Page"}, "twitter:card": {"summary"}},
+		Canonical: "http://example.com/page",
+		Alternates: []*Link{
+			{Href: "/fr/page", Rel: "alternate", Hreflang: "fr"},
+		},
+		Icons: []*Link{
+			{Href: "/favicon.png", Rel: "alternate icon", Type: "image/png"},
+			{Href: "/touch.png", Rel: "apple-touch-icon", Sizes: "180x180"},
+		},
+		JSONLD: []interface{}{
+			map[string]interface{}{"@context": "https://schema.org", "@type": "Article", "headline": "The Page"},
+		},
+		Items: []*Item{
+			{
+				Type: []string{"https://schema.org/Person"},
+				Properties: map[string][]interface{}{
+					"name": {"Ann Lee"},
+					"url":  {"/ann"},
+					"address": {&Item{
+						Type:       []string{"https://schema.org/PostalAddress"},
+						Properties: map[string][]interface{}{"addressLocality": {"Paris"}},
+					}},
+					"birthDate": {"1980-01-02"},
+				},
+			},
+			{
+				Type: []string{"https://schema.org/Event"},
+				ID:   "#e",
+				Properties: map[string][]interface{}{
+					"name":      {"Launch"},
+					"startDate": {"2012-07-01"},
+					"location": {&Item{
+						Type:       []string{"https://schema.org/Place"},
+						Properties: map[string][]interface{}{"name": {"Hall"}},
+					}},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		got, _ := json.MarshalIndent(m, "", "  ")
+		w, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("got\n%s\nwant\n%s", got, w)
+	}
+}
+
+// An item that refers to an element holding itself must not recurse.
+func TestItemRefCycle(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id=a><div itemscope itemref=a><span itemprop=p>x</span><div itemprop=q itemscope itemref=a></div></div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := Extract(doc).Items
+	if len(items) != 1 || !reflect.DeepEqual(items[0].Properties["p"], []interface{}{"x"}) {
+		t.Fatalf("got %+v", items)
+	}
+}
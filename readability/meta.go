@@ -0,0 +1,118 @@
+package readability
+
+import (
+	"exp/html"
+	"strings"
+)
+
+// Metadata is looked up under these keys, best first. Keys are the name,
+// property or itemprop of meta elements, in lower case.
+var (
+	titleKeys     = []string{"og:title", "twitter:title", "dc.title", "headline"}
+	bylineKeys    = []string{"author", "article:author", "dc.creator", "byl", "parsely-author"}
+	publishedKeys = []string{"article:published_time", "datepublished", "og:published_time", "dc.date.issued", "dc.date", "date", "pubdate", "publish-date", "sailthru.date", "parsely-pub-date"}
+	imageKeys     = []string{"og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src", "image_src", "image"}
+)
+
+// titleSeparators split the name of the site from the title of the page.
+var titleSeparators = []string{" | ", " - ", " – ", " — ", " :: ", " / ", " » "}
+
+// readMeta sets the metadata of a from the meta elements of doc and from
+// its title, time and link elements.
+func (a *Article) readMeta(doc *html.Node) {
+	meta := make(map[string]string)
+	var title string
+	var h1s, times []*html.Node
+	walk(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		switch n.Data {
+		case "meta":
+			content := strings.TrimSpace(attr(n, "content"))
+			for _, key := range []string{"name", "property", "itemprop"} {
+				// A property may list several, as in "og:title twitter:title".
+				for _, k := range strings.Fields(strings.ToLower(attr(n, key))) {
+					if _, ok := meta[k]; !ok && content != "" {
+						meta[k] = content
+					}
+				}
+			}
+		case "link":
+			if strings.ToLower(attr(n, "rel")) == "image_src" {
+				if _, ok := meta["image_src"]; !ok {
+					meta["image_src"] = attr(n, "href")
+				}
+			}
+		case "title":
+			if title == "" {
+				title = textOf(n)
+			}
+		case "h1":
+			h1s = append(h1s, n)
+		case "time":
+			if attr(n, "datetime") != "" {
+				times = append(times, n)
+			}
+		default:
+			// Microdata may hold the date published in any element.
+			if strings.ToLower(attr(n, "itemprop")) == "datepublished" {
+				if v := attr(n, "datetime"); v != "" {
+					meta["datepublished"] = v
+				}
+			}
+		}
+	})
+
+	a.Title = lookup(meta, titleKeys)
+	if a.Title == "" {
+		a.Title = cleanTitle(title)
+	}
+	if a.Title == "" && len(h1s) == 1 {
+		a.Title = textOf(h1s[0])
+	}
+	if byline := lookup(meta, bylineKeys); !strings.Contains(byline, "://") {
+		// article:author is often the url of the author's page.
+		a.Byline = byline
+	}
+	a.Published = lookup(meta, publishedKeys)
+	for _, t := range times {
+		if _, ok := attrOK(t, "pubdate"); ok && a.Published == "" {
+			a.Published = attr(t, "datetime")
+		}
+	}
+	if a.Published == "" && len(times) > 0 {
+		a.Published = attr(times[0], "datetime")
+	}
+	a.Image = lookup(meta, imageKeys)
+}
+
+// lookup returns the first value in meta under one of keys.
+func lookup(meta map[string]string, keys []string) string {
+	for _, k := range keys {
+		if v := meta[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// cleanTitle removes the name of the site from the title of a page, such
+// as "The Article | Example News". It keeps the title as it is if what
+// would remain is too short to be the title of the article.
+func cleanTitle(title string) string {
+	for _, sep := range titleSeparators {
+		i := strings.LastIndex(title, sep)
+		if i == -1 {
+			continue
+		}
+		if before := title[:i]; len(strings.Fields(before)) >= 3 {
+			return before
+		}
+		if after := title[strings.Index(title, sep)+len(sep):]; len(strings.Fields(after)) >= 3 {
+			return after
+		}
+		break
+	}
+	return title
+}
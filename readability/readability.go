@@ -0,0 +1,493 @@
+// Package readability finds the main content of article pages in exp/html
+// parse trees, leaving out navigation, advertisements, comments and
+// footers, and reads the title, byline, publication date and lead image of
+// the article.
+//
+// The content is found by scoring the elements that hold paragraphs of
+// text: long paragraphs with commas raise the score of their parent and
+// grandparent, class and id names such as "article" or "sidebar" raise or
+// lower it, and links lower it by the share of the text they hold. The
+// best scoring element, along with those of its siblings that look like
+// part of the article, is returned as the content, cleaned of what is left
+// of forms, link lists and styling.
+//
+//	doc, err := html.Parse(r)
+//	if err != nil {
+//		// ...
+//	}
+//	a, err := readability.Extract(doc)
+//	if err != nil {
+//		// ...
+//	}
+//	err = html.Render(w, a.Content)
+package readability
+
+import (
+	"errors"
+	"exp/html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrNoContent is returned by Extract for documents without any text.
+var ErrNoContent = errors.New("readability: no content found")
+
+// An Article is the main content of a page.
+type Article struct {
+	Title string
+	// Byline names the authors, as written on the page.
+	Byline string
+	// Published is the publication date, usually in the ISO 8601 format
+	// of the page's metadata.
+	Published string
+	// Image is the URL of the lead image, as written on the page.
+	Image string
+	// Content is a div element holding the content. It is a copy: the
+	// document that it was extracted from is left unchanged.
+	Content *html.Node
+}
+
+var (
+	unlikelyRegexp = regexp.MustCompile(`(?i)ad-break|agegate|banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|pager|pagination|popup|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|supplemental`)
+	maybeRegexp    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveRegexp = regexp.MustCompile(`(?i)article|blog|body|content|entry|hentry|main|page|post|story|text`)
+	negativeRegexp = regexp.MustCompile(`(?i)-ad-|banner|combx|comment|com-|contact|foot|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	bylineRegexp   = regexp.MustCompile(`(?i)byline|author|dateline|writtenby`)
+)
+
+// removed are the elements that are never part of the content.
+var removed = map[string]bool{
+	"aside":    true,
+	"button":   true,
+	"embed":    true,
+	"footer":   true,
+	"iframe":   true,
+	"input":    true,
+	"link":     true,
+	"math":     true,
+	"meta":     true,
+	"nav":      true,
+	"noscript": true,
+	"object":   true,
+	"script":   true,
+	"select":   true,
+	"style":    true,
+	"svg":      true,
+	"template": true,
+	"textarea": true,
+}
+
+// blocks are the elements that keep a div from being scored as a
+// paragraph.
+var blocks = map[string]bool{
+	"blockquote": true,
+	"div":        true,
+	"dl":         true,
+	"figure":     true,
+	"ol":         true,
+	"p":          true,
+	"pre":        true,
+	"section":    true,
+	"table":      true,
+	"ul":         true,
+}
+
+// Extract returns the main content of the document doc and its metadata.
+func Extract(doc *html.Node) (*Article, error) {
+	a := &Article{}
+	a.readMeta(doc)
+	root := deepCopy(doc)
+	a.prepare(root)
+	e := &extractor{scores: make(map[*html.Node]float64)}
+	top := e.topCandidate(root)
+	if top == nil {
+		return nil, ErrNoContent
+	}
+	a.Content = e.gather(top)
+	a.clean(a.Content)
+	if a.Image == "" {
+		if img := find(a.Content, "img"); img != nil {
+			a.Image = attr(img, "src")
+		}
+	}
+	return a, nil
+}
+
+// prepare removes the elements that cannot be part of the content from the
+// tree rooted at n, taking the byline from the first one that holds it.
+func (a *Article) prepare(n *html.Node) {
+	for _, c := range append([]*html.Node(nil), n.Child...) {
+		switch c.Type {
+		case html.ElementNode:
+		case html.TextNode:
+			continue
+		default:
+			n.Remove(c)
+			continue
+		}
+		if removed[c.Data] || c.Namespace != "" || hidden(c) {
+			n.Remove(c)
+			continue
+		}
+		names := attr(c, "class") + " " + attr(c, "id")
+		if isByline(c, names) {
+			if a.Byline == "" {
+				a.Byline = textOf(c)
+			}
+			n.Remove(c)
+			continue
+		}
+		if unlikelyRegexp.MatchString(names) && !maybeRegexp.MatchString(names) &&
+			c.Data != "body" && c.Data != "a" && !inside(c, "table", "code") {
+			n.Remove(c)
+			continue
+		}
+		a.prepare(c)
+	}
+}
+
+// isByline reports whether the element n, whose class and id are names,
+// holds the byline of the article.
+func isByline(n *html.Node, names string) bool {
+	if attr(n, "rel") != "author" && attr(n, "itemprop") != "author" && !bylineRegexp.MatchString(names) {
+		return false
+	}
+	length := textLength(n)
+	return length > 0 && length < 100
+}
+
+// hidden reports whether the element n is not displayed.
+func hidden(n *html.Node) bool {
+	if _, ok := attrOK(n, "hidden"); ok {
+		return true
+	}
+	style := strings.Replace(strings.ToLower(attr(n, "style")), " ", "", -1)
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// inside reports whether n has an ancestor called one of names.
+func inside(n *html.Node, names ...string) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		for _, name := range names {
+			if p.Type == html.ElementNode && p.Data == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// An extractor holds the scores of the candidates for the content.
+type extractor struct {
+	scores     map[*html.Node]float64
+	candidates []*html.Node
+}
+
+// topCandidate scores the ancestors of the paragraphs in the tree rooted at
+// root and returns the best of them, or the body if there are none.
+func (e *extractor) topCandidate(root *html.Node) *html.Node {
+	walk(root, func(n *html.Node) {
+		if !isParagraph(n) {
+			return
+		}
+		text := textOf(n)
+		length := utf8.RuneCountInString(text)
+		if length < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(length)/100, 3)
+		level := 0
+		for p := n.Parent; p != nil && p.Type == html.ElementNode && level < 3; p, level = p.Parent, level+1 {
+			if _, ok := e.scores[p]; !ok {
+				e.scores[p] = initialScore(p)
+				e.candidates = append(e.candidates, p)
+			}
+			switch level {
+			case 0:
+				e.scores[p] += score
+			case 1:
+				e.scores[p] += score / 2
+			default:
+				e.scores[p] += score / float64(level*3)
+			}
+		}
+	})
+	var top *html.Node
+	for _, c := range e.candidates {
+		e.scores[c] *= 1 - linkDensity(c)
+		if top == nil || e.scores[c] > e.scores[top] {
+			top = c
+		}
+	}
+	if top == nil {
+		top = find(root, "body")
+		if top == nil || textLength(top) == 0 {
+			return nil
+		}
+	}
+	return top
+}
+
+// isParagraph reports whether n is an element that is scored for the
+// text it holds: a p, pre or td, or a div with no block children.
+func isParagraph(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch n.Data {
+	case "p", "pre", "td":
+		return true
+	case "div":
+		for _, c := range n.Child {
+			if c.Type == html.ElementNode && blocks[c.Data] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// initialScore returns the score of the element n before the paragraphs it
+// holds are counted.
+func initialScore(n *html.Node) float64 {
+	score := classWeight(n)
+	switch n.Data {
+	case "div", "article":
+		score += 5
+	case "blockquote", "pre", "td":
+		score += 3
+	case "address", "dd", "dl", "dt", "form", "li", "ol", "ul":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	return score
+}
+
+// classWeight returns how much the class and id of n suggest that it is
+// or is not part of the content.
+func classWeight(n *html.Node) float64 {
+	var weight float64
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if negativeRegexp.MatchString(name) {
+			weight -= 25
+		}
+		if positiveRegexp.MatchString(name) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// gather returns a div holding the top candidate and those of its siblings
+// that belong with it: candidates that score close to it, and paragraphs
+// that have long text or end a sentence but have few links.
+func (e *extractor) gather(top *html.Node) *html.Node {
+	content := &html.Node{Type: html.ElementNode, Data: "div"}
+	parent := top.Parent
+	if parent == nil {
+		content.Add(top)
+		return content
+	}
+	threshold := max(10, e.scores[top]*0.2)
+	bonus := 0.0
+	if names := attr(top, "class"); names != "" {
+		bonus = e.scores[top] * 0.2
+	}
+	for _, s := range append([]*html.Node(nil), parent.Child...) {
+		keep := s == top
+		if !keep && s.Type == html.ElementNode {
+			if score, ok := e.scores[s]; ok {
+				if attr(s, "class") != "" && attr(s, "class") == attr(top, "class") {
+					score += bonus
+				}
+				keep = score >= threshold
+			}
+			if !keep && s.Data == "p" {
+				density := linkDensity(s)
+				text := textOf(s)
+				length := utf8.RuneCountInString(text)
+				keep = length > 80 && density < 0.25 ||
+					length > 0 && density == 0 && strings.HasSuffix(text, ".")
+			}
+		}
+		if keep {
+			parent.Remove(s)
+			content.Add(s)
+		}
+	}
+	return content
+}
+
+// clean removes from the content what is left of forms, link lists and
+// other clutter, the headings that repeat the title, and the styling.
+func (a *Article) clean(n *html.Node) {
+	for _, c := range append([]*html.Node(nil), n.Child...) {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		a.clean(c)
+		if a.unwanted(c) {
+			n.Remove(c)
+			continue
+		}
+		attrs := c.Attr[:0]
+		for _, at := range c.Attr {
+			if at.Key != "style" && at.Key != "class" && !strings.HasPrefix(at.Key, "on") {
+				attrs = append(attrs, at)
+			}
+		}
+		c.Attr = attrs
+	}
+}
+
+// unwanted reports whether the cleaned element n should be removed from the
+// content.
+func (a *Article) unwanted(n *html.Node) bool {
+	switch n.Data {
+	case "form", "fieldset":
+		return true
+	case "h1", "h2":
+		return a.Title != "" && textOf(n) == a.Title
+	case "p":
+		return textLength(n) == 0 && find(n, "img") == nil
+	case "div", "section", "table", "ul", "ol":
+	default:
+		return false
+	}
+	text := textOf(n)
+	if strings.Count(text, ",") >= 10 {
+		return false
+	}
+	weight := classWeight(n)
+	if weight < 0 {
+		return true
+	}
+	var p, img, li, input int
+	walk(n, func(d *html.Node) {
+		switch d.Data {
+		case "p":
+			p++
+		case "img":
+			img++
+		case "li":
+			li++
+		case "input":
+			input++
+		}
+	})
+	length := utf8.RuneCountInString(text)
+	density := linkDensity(n)
+	switch {
+	case img > 1 && float64(p)/float64(img) < 0.5 && !inside(n, "figure"):
+	case li > p && n.Data != "ul" && n.Data != "ol":
+	case input > p/3:
+	case length < 25 && (img == 0 || img > 2) && find(n, "pre") == nil:
+	case weight < 25 && density > 0.2:
+	case weight >= 25 && density > 0.5:
+	default:
+		return false
+	}
+	return true
+}
+
+// linkDensity returns the share of the text of n that is inside links.
+func linkDensity(n *html.Node) float64 {
+	length := textLength(n)
+	if length == 0 {
+		return 0
+	}
+	links := 0
+	walk(n, func(d *html.Node) {
+		if d.Type == html.ElementNode && d.Data == "a" {
+			links += textLength(d)
+		}
+	})
+	return float64(links) / float64(length)
+}
+
+// walk calls f for every node of the tree rooted at n, parents first.
+func walk(n *html.Node, f func(*html.Node)) {
+	f(n)
+	for _, c := range n.Child {
+		walk(c, f)
+	}
+}
+
+// find returns the first element called name in the tree rooted at n.
+func find(n *html.Node, name string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == name {
+		return n
+	}
+	for _, c := range n.Child {
+		if f := find(c, name); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// textOf returns the text of the tree rooted at n with its runs of white
+// space collapsed.
+func textOf(n *html.Node) string {
+	var b []string
+	walk(n, func(d *html.Node) {
+		if d.Type == html.TextNode {
+			b = append(b, d.Data)
+		}
+	})
+	return strings.Join(strings.Fields(strings.Join(b, "")), " ")
+}
+
+func textLength(n *html.Node) int {
+	return utf8.RuneCountInString(textOf(n))
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := attrOK(n, key)
+	return v
+}
+
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key && a.Namespace == "" {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// deepCopy returns a copy of the tree rooted at n.
+func deepCopy(n *html.Node) *html.Node {
+	m := &html.Node{
+		Type:      n.Type,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+		Start:     n.Start,
+		End:       n.End,
+	}
+	for _, c := range n.Child {
+		m.Add(deepCopy(c))
+	}
+	return m
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,103 @@
+package readability
+
+import (
+	"bytes"
+	"exp/html"
+	"strings"
+	"testing"
+)
+
+const testArticle = `<!DOCTYPE html>
+<html><head>
+<title>Rivers of the North, Explained | Example News</title>
+<meta property="article:published_time" content="2012-06-01T08:00:00Z">
+<meta property="og:image" content="http://example.com/lead.jpg">
+</head><body>
+<div id="header"><a href="/">Example News</a></div>
+<ul class="nav"><li><a href="/world">World</a></li><li><a href="/sport">Sport</a></li></ul>
+<div class="main">
+	<div class="article-body">
+		<h1>Rivers of the North, Explained</h1>
+		<p class="byline">By Jane Doe</p>
+		<p>The rivers of the north run cold and fast, fed by glaciers, snow and rain, and they shape the land they cross.</p>
+		<p>Salmon return to them every year, against the current, to spawn in the gravel beds where they hatched.</p>
+		<p style="color: red" onclick="track()">Fishing is allowed in some of them, but only with a permit, and only for a few weeks.</p>
+		<form><input name="q"><p>Search the site</p></form>
+		<div class="share-widget"><a href="/share">Share</a> <a href="/tweet">Tweet</a></div>
+	</div>
+	<div class="sidebar"><h3>Most read</h3><p><a href="/a">One story</a>, <a href="/b">another story</a>, <a href="/c">and a third one</a></p></div>
+</div>
+<div id="comments"><p>First, I think this article is great, and long enough to be scored, too.</p></div>
+<div class="footer">Copyright Example News</div>
+<script>track()</script>
+</body></html>`
+
+func TestExtract(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(testArticle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := Extract(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Rivers of the North, Explained"; a.Title != want {
+		t.Errorf("title: got %q, want %q", a.Title, want)
+	}
+	if want := "By Jane Doe"; a.Byline != want {
+		t.Errorf("byline: got %q, want %q", a.Byline, want)
+	}
+	if want := "2012-06-01T08:00:00Z"; a.Published != want {
+		t.Errorf("published: got %q, want %q", a.Published, want)
+	}
+	if want := "http://example.com/lead.jpg"; a.Image != want {
+		t.Errorf("image: got %q, want %q", a.Image, want)
+	}
+
+	var b bytes.Buffer
+	if err := html.Render(&b, a.Content); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	for _, want := range []string{"rivers of the north run cold", "Salmon return", "<p>Fishing is allowed"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("content has no %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"World", "Search the site", "Tweet", "Most read", "First, I think", "Copyright", "track()", "<h1>"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("content has %q:\n%s", unwanted, got)
+		}
+	}
+
+	// The document is left as it was.
+	if !strings.Contains(textOf(doc), "Copyright Example News") {
+		t.Error("Extract changed the document")
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Rivers of the North | Example News", "Rivers of the North"},
+		{"Example News - Rivers of the North", "Rivers of the North"},
+		{"News - Sport", "News - Sport"},
+		{"A Plain Title", "A Plain Title"},
+	}
+	for _, test := range tests {
+		if got := cleanTitle(test.title); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.title, got, test.want)
+		}
+	}
+}
+
+func TestExtractEmpty(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader("<title>t</title>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Extract(doc); err != ErrNoContent {
+		t.Errorf("got %v, want ErrNoContent", err)
+	}
+}
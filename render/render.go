@@ -0,0 +1,735 @@
+// Package render writes exp/html parse trees as plain text or Markdown,
+// for uses that want the text of a page rather than its markup, such as
+// search indexing.
+//
+// Both follow the layout a browser would give the text: block elements
+// start new lines, paragraphs, headings and the like are separated by
+// blank lines, runs of white space collapse to a single space except in
+// pre elements, and scripts, styles, forms controls and the head of the
+// document are left out.
+//
+//	doc, err := html.Parse(r)
+//	if err != nil {
+//		// ...
+//	}
+//	err = render.Markdown(w, doc)
+package render
+
+import (
+	"bytes"
+	"exp/html"
+	"io"
+	"strings"
+)
+
+// Text writes the text of the tree rooted at n to w. List items are
+// marked with "* " or their number, the lines of block quotes are indented
+// and the cells of table rows are separated by tabs.
+func Text(w io.Writer, n *html.Node) error {
+	return write(w, n, false)
+}
+
+// Markdown writes the tree rooted at n to w as CommonMark, using the pipe
+// tables and ~~strikethrough~~ of GitHub Flavored Markdown. Links, images,
+// emphasis, inline code, code blocks, headings, lists, block quotes,
+// thematic breaks and tables are kept; other markup is reduced to its text.
+func Markdown(w io.Writer, n *html.Node) error {
+	return write(w, n, true)
+}
+
+func write(w io.Writer, n *html.Node, markdown bool) error {
+	r := &renderer{markdown: markdown, lineStart: true}
+	r.node(n)
+	if r.written {
+		r.buf.WriteByte('\n')
+	}
+	_, err := w.Write(r.buf.Bytes())
+	return err
+}
+
+// skipped are the elements whose content is not text to show.
+var skipped = map[string]bool{
+	"applet":   true,
+	"audio":    true,
+	"base":     true,
+	"canvas":   true,
+	"embed":    true,
+	"head":     true,
+	"iframe":   true,
+	"input":    true,
+	"link":     true,
+	"math":     true,
+	"meta":     true,
+	"noscript": true,
+	"object":   true,
+	"script":   true,
+	"select":   true,
+	"style":    true,
+	"svg":      true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+	"video":    true,
+}
+
+// paragraphs are separated from what surrounds them by blank lines.
+var paragraphs = map[string]bool{
+	"address":    true,
+	"blockquote": true,
+	"details":    true,
+	"dl":         true,
+	"fieldset":   true,
+	"figure":     true,
+	"form":       true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"hr":         true,
+	"p":          true,
+	"pre":        true,
+	"table":      true,
+}
+
+// blocks start and end lines. In Markdown, where a single line break does
+// not end a paragraph, they are separated by blank lines too.
+var blocks = map[string]bool{
+	"article":    true,
+	"aside":      true,
+	"body":       true,
+	"caption":    true,
+	"center":     true,
+	"dd":         true,
+	"dir":        true,
+	"div":        true,
+	"dt":         true,
+	"figcaption": true,
+	"footer":     true,
+	"header":     true,
+	"hgroup":     true,
+	"html":       true,
+	"legend":     true,
+	"main":       true,
+	"menu":       true,
+	"nav":        true,
+	"section":    true,
+	"summary":    true,
+}
+
+// emphasis maps inline elements to the Markdown delimiters around their
+// content.
+var emphasis = map[string]string{
+	"b":      "**",
+	"cite":   "*",
+	"del":    "~~",
+	"dfn":    "*",
+	"em":     "*",
+	"i":      "*",
+	"s":      "~~",
+	"strike": "~~",
+	"strong": "**",
+	"var":    "*",
+}
+
+// A renderer lays out text in lines. Output is written lazily: line
+// breaks and collapsed white space are only written once the text that
+// follows them is, so that blocks without text leave no blank lines.
+type renderer struct {
+	markdown bool
+	// table escapes the pipes that would end a Markdown table cell.
+	table bool
+	buf   bytes.Buffer
+	// prefixes are written at the start of each line: the markers of
+	// block quotes and list items.
+	prefixes []*prefix
+	lists    []*list
+	// breaks is the number of line breaks owed, at most 2 for a blank line.
+	breaks int
+	// space is whether collapsed white space is owed.
+	space     bool
+	lineStart bool
+	written   bool
+}
+
+// A prefix is written at the start of the lines of a block quote or a list
+// item: first on its first line, rest on the others.
+type prefix struct {
+	first, rest string
+	used        bool
+}
+
+type list struct {
+	ordered bool
+	next    int
+}
+
+// breakLine makes the next output start on a new line, after a blank line
+// if blank is set.
+func (r *renderer) breakLine(blank bool) {
+	n := 1
+	if blank {
+		n = 2
+	}
+	if r.breaks < n {
+		r.breaks = n
+	}
+	r.space = false
+}
+
+// emit writes s, which holds no line break, after the line breaks, line
+// prefixes or white space that are owed. An empty s is only written if
+// force is set, which starts its line.
+func (r *renderer) emit(s string, force bool) {
+	if s == "" && !force {
+		return
+	}
+	if r.written && r.breaks > 0 {
+		for i := 0; i < r.breaks; i++ {
+			if i > 0 {
+				r.writePrefixes(true)
+			}
+			r.buf.WriteByte('\n')
+		}
+		r.lineStart = true
+	}
+	r.breaks = 0
+	if r.lineStart {
+		r.writePrefixes(false)
+		r.lineStart = false
+	} else if r.space {
+		r.buf.WriteByte(' ')
+	}
+	r.space = false
+	r.buf.WriteString(s)
+	r.written = true
+}
+
+// writePrefixes writes the prefixes of a new line. A blank line only
+// continues the block quotes and list items that have already started,
+// without trailing spaces.
+func (r *renderer) writePrefixes(blank bool) {
+	var b bytes.Buffer
+	for _, p := range r.prefixes {
+		switch {
+		case blank && p.used:
+			b.WriteString(p.rest)
+		case blank:
+		case p.used:
+			b.WriteString(p.rest)
+		default:
+			b.WriteString(p.first)
+			p.used = true
+		}
+	}
+	s := b.String()
+	if blank {
+		s = strings.TrimRight(s, " ")
+	}
+	r.buf.WriteString(s)
+}
+
+// atLineStart reports whether the next output starts a line.
+func (r *renderer) atLineStart() bool {
+	return r.lineStart || r.breaks > 0 || !r.written
+}
+
+// text writes the text s with its white space collapsed.
+func (r *renderer) text(s string) {
+	words := strings.FieldsFunc(s, isSpace)
+	if len(words) == 0 {
+		if s != "" {
+			r.space = true
+		}
+		return
+	}
+	if isSpace(rune(s[0])) {
+		r.space = true
+	}
+	for i, w := range words {
+		if i > 0 {
+			r.space = true
+		}
+		if r.markdown {
+			w = r.escape(w, r.atLineStart())
+		}
+		r.emit(w, false)
+	}
+	if isSpace(rune(s[len(s)-1])) {
+		r.space = true
+	}
+}
+
+func isSpace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// lines writes s as it is, line by line, as the content of pre elements.
+func (r *renderer) lines(s string) {
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			r.breakLine(false)
+		}
+		r.emit(line, true)
+	}
+}
+
+// node writes the tree rooted at n.
+func (r *renderer) node(n *html.Node) {
+	switch n.Type {
+	case html.DocumentNode:
+		r.children(n)
+		return
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if skipped[n.Data] || n.Namespace != "" {
+		return
+	}
+	blank := paragraphs[n.Data] || r.markdown && blocks[n.Data]
+	if blank || blocks[n.Data] {
+		r.breakLine(blank)
+		defer r.breakLine(blank)
+	}
+	switch n.Data {
+	case "br":
+		r.lineBreak()
+	case "img":
+		r.image(n)
+	case "pre":
+		r.pre(n)
+	case "ul", "ol":
+		r.list(n)
+	case "li":
+		r.listItem(n)
+	case "blockquote":
+		p := &prefix{"  ", "  ", false}
+		if r.markdown {
+			p = &prefix{"> ", "> ", false}
+		}
+		r.prefixes = append(r.prefixes, p)
+		r.children(n)
+		r.prefixes = r.prefixes[:len(r.prefixes)-1]
+	case "table":
+		r.tableNode(n)
+	case "tr":
+		// Rows outside of tables.
+		r.breakLine(false)
+		r.row(cells(n))
+		r.breakLine(false)
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		if r.markdown {
+			if s := r.inline(n); s != "" {
+				r.emit(strings.Repeat("#", int(n.Data[1]-'0'))+" "+s, false)
+			}
+			return
+		}
+		r.children(n)
+	case "hr":
+		if r.markdown {
+			r.emit("---", false)
+		}
+	default:
+		if r.markdown {
+			r.inlineMarkdown(n)
+			return
+		}
+		r.children(n)
+	}
+}
+
+func (r *renderer) children(n *html.Node) {
+	for _, c := range n.Child {
+		r.node(c)
+	}
+}
+
+// lineBreak writes a <br>.
+func (r *renderer) lineBreak() {
+	if !r.written {
+		return
+	}
+	if r.markdown && r.table {
+		// Table cells hold a single line, in which a break is written as
+		// HTML.
+		r.emit("<br>", false)
+		return
+	}
+	if r.markdown && r.breaks == 0 && !r.lineStart {
+		// A hard line break.
+		r.emit("\\", false)
+		r.breakLine(false)
+		return
+	}
+	if r.breaks < 2 {
+		r.breaks++
+	}
+	r.space = false
+}
+
+// image writes the alternative text of an image, or a Markdown image.
+func (r *renderer) image(n *html.Node) {
+	alt := attr(n, "alt")
+	if !r.markdown {
+		r.text(alt)
+		return
+	}
+	src := attr(n, "src")
+	if src == "" {
+		r.text(alt)
+		return
+	}
+	r.emit("!["+r.escape(strings.Join(strings.FieldsFunc(alt, isSpace), " "), false)+"]("+destination(src)+title(n)+")", false)
+}
+
+// pre writes the text of a pre element as it is, in a fenced code block
+// for Markdown.
+func (r *renderer) pre(n *html.Node) {
+	code := strings.TrimSuffix(textContent(n), "\n")
+	if !r.markdown {
+		r.lines(code)
+		return
+	}
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	r.emit(fence+language(n), true)
+	r.breakLine(false)
+	if code != "" {
+		r.lines(code)
+		r.breakLine(false)
+	}
+	r.emit(fence, true)
+}
+
+// language returns the language of a code block from a class such as
+// "language-go" on the pre element or its code child.
+func language(n *html.Node) string {
+	for _, m := range append([]*html.Node{n}, n.Child...) {
+		if m.Type != html.ElementNode {
+			continue
+		}
+		for _, class := range strings.Fields(attr(m, "class")) {
+			for _, p := range []string{"language-", "lang-"} {
+				if strings.HasPrefix(class, p) && !strings.ContainsAny(class, "`~") {
+					return class[len(p):]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// list writes a ul or ol element.
+func (r *renderer) list(n *html.Node) {
+	l := &list{ordered: n.Data == "ol", next: 1}
+	if start, ok := number(attr(n, "start")); ok {
+		l.next = start
+	}
+	r.lists = append(r.lists, l)
+	r.children(n)
+	r.lists = r.lists[:len(r.lists)-1]
+}
+
+// listItem writes an li element after its bullet or number.
+func (r *renderer) listItem(n *html.Node) {
+	marker := "* "
+	if r.markdown {
+		marker = "- "
+	}
+	if k := len(r.lists); k > 0 && r.lists[k-1].ordered {
+		l := r.lists[k-1]
+		if v, ok := number(attr(n, "value")); ok {
+			l.next = v
+		}
+		marker = itoa(l.next) + ". "
+		l.next++
+	}
+	r.breakLine(false)
+	p := &prefix{marker, strings.Repeat(" ", len(marker)), false}
+	r.prefixes = append(r.prefixes, p)
+	r.children(n)
+	if !p.used {
+		// Write the marker of an empty item.
+		r.emit("", true)
+	}
+	r.prefixes = r.prefixes[:len(r.prefixes)-1]
+	r.breakLine(false)
+}
+
+// inlineMarkdown writes the inline element n with the Markdown syntax for
+// links, emphasis and code.
+func (r *renderer) inlineMarkdown(n *html.Node) {
+	var open, close string
+	switch n.Data {
+	case "a":
+		href := attr(n, "href")
+		if href == "" {
+			r.children(n)
+			return
+		}
+		open, close = "[", "]("+destination(href)+title(n)+")"
+	case "code", "kbd", "samp", "tt":
+		r.code(n)
+		return
+	default:
+		d, ok := emphasis[n.Data]
+		if !ok {
+			r.children(n)
+			return
+		}
+		open, close = d, d
+	}
+	content := textContent(n)
+	s := r.inline(n)
+	if s == "" && n.Data == "a" {
+		s = r.escape(attr(n, "href"), false)
+	}
+	if s == "" {
+		return
+	}
+	if content != "" && isSpace(rune(content[0])) {
+		r.space = true
+	}
+	r.emit(open+s+close, false)
+	if content != "" && isSpace(rune(content[len(content)-1])) {
+		r.space = true
+	}
+}
+
+// code writes inline code between enough backticks.
+func (r *renderer) code(n *html.Node) {
+	content := strings.Join(strings.FieldsFunc(textContent(n), isSpace), " ")
+	if content == "" {
+		return
+	}
+	fence := "`"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	if content[0] == '`' || content[len(content)-1] == '`' {
+		content = " " + content + " "
+	}
+	if r.table {
+		content = strings.Replace(content, "|", "\\|", -1)
+	}
+	r.emit(fence+content+fence, false)
+}
+
+// inline returns the content of n laid out on one line.
+func (r *renderer) inline(n *html.Node) string {
+	sub := &renderer{markdown: r.markdown, table: r.table, lineStart: true}
+	sub.children(n)
+	return strings.Join(strings.FieldsFunc(sub.buf.String(), isSpace), " ")
+}
+
+// escape escapes the Markdown syntax in the word w, which starts a line if
+// lineStart is set.
+func (r *renderer) escape(w string, lineStart bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(w); i++ {
+		switch c := w[i]; c {
+		case '\\', '`', '*', '_', '[', ']', '<', '~':
+			b.WriteByte('\\')
+		case '|':
+			if r.table {
+				b.WriteByte('\\')
+			}
+		case '&':
+			if isEntity(w[i:]) {
+				b.WriteByte('\\')
+			}
+		case '#', '>', '+', '-', '=':
+			if lineStart && i == 0 {
+				b.WriteByte('\\')
+			}
+		case '.', ')':
+			// An ordered list marker.
+			if lineStart && i > 0 && isDigits(w[:i]) {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteByte(w[i])
+	}
+	return b.String()
+}
+
+// isEntity reports whether s starts with a character reference.
+func isEntity(s string) bool {
+	i := strings.IndexByte(s, ';')
+	if i < 2 {
+		return false
+	}
+	name := s[1:i]
+	if name[0] == '#' {
+		name = name[1:]
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// destination returns the link destination for the URL u, between angle
+// brackets if it has characters that would end it.
+func destination(u string) string {
+	if !strings.ContainsAny(u, " ()<>\n\t") {
+		return u
+	}
+	u = strings.Replace(u, "<", "%3C", -1)
+	u = strings.Replace(u, ">", "%3E", -1)
+	u = strings.Replace(u, "\n", "", -1)
+	return "<" + u + ">"
+}
+
+// title returns the link title of n, with the space that precedes it.
+func title(n *html.Node) string {
+	t := attr(n, "title")
+	if t == "" {
+		return ""
+	}
+	return ` "` + strings.Replace(strings.Replace(t, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+// tableNode writes a table, as a pipe table in Markdown.
+func (r *renderer) tableNode(n *html.Node) {
+	var rows [][]*html.Node
+	var walk func(*html.Node)
+	walk = func(m *html.Node) {
+		for _, c := range m.Child {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "caption":
+				r.node(c)
+			case "thead", "tbody", "tfoot":
+				walk(c)
+			case "tr":
+				rows = append(rows, cells(c))
+			}
+		}
+	}
+	walk(n)
+	if !r.markdown {
+		for _, row := range rows {
+			r.breakLine(false)
+			r.row(row)
+		}
+		return
+	}
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	if columns == 0 {
+		return
+	}
+	for i, row := range rows {
+		r.breakLine(false)
+		r.row(row, columns)
+		if i == 0 {
+			r.breakLine(false)
+			r.emit("|"+strings.Repeat(" --- |", columns), false)
+		}
+	}
+}
+
+// cells returns the td and th children of the tr element n.
+func cells(n *html.Node) []*html.Node {
+	var cells []*html.Node
+	for _, c := range n.Child {
+		if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+			cells = append(cells, c)
+		}
+	}
+	return cells
+}
+
+// row writes a row of cells on one line, separated by tabs, or in Markdown
+// padded to the given number of columns.
+func (r *renderer) row(cells []*html.Node, columns ...int) {
+	var texts []string
+	for _, c := range cells {
+		sub := &renderer{markdown: r.markdown, table: true}
+		texts = append(texts, sub.inline(c))
+	}
+	if !r.markdown {
+		r.emit(strings.Join(texts, "\t"), false)
+		return
+	}
+	for len(columns) > 0 && len(texts) < columns[0] {
+		texts = append(texts, "")
+	}
+	r.emit("| "+strings.Join(texts, " | ")+" |", false)
+}
+
+// textContent returns the text of the tree rooted at n as it is.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b bytes.Buffer
+	for _, c := range n.Child {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key && a.Namespace == "" {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// number parses a decimal integer attribute value.
+func number(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	if !isDigits(s) || len(s) > 9 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range s {
+		n = n*10 + int(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+func itoa(n int) string {
+	if n < 0 {
+		return "-" + itoa(-n)
+	}
+	if n < 10 {
+		return string(rune('0' + n))
+	}
+	return itoa(n/10) + string(rune('0'+n%10))
+}
@@ -0,0 +1,71 @@
+package render
+
+import (
+	"bytes"
+	"exp/html"
+	"io"
+	"strings"
+	"testing"
+)
+
+var textTests = []struct {
+	in, want string
+}{
+	{`<p>a  b
+	c</p><p>d</p>`, "a b c\n\nd\n"},
+	{`<div>a</div><div> b <span>c</span></div>`, "a\nb c\n"},
+	{`a<br>b<br><br>c`, "a\nb\n\nc\n"},
+	{"<pre>  a\n\n    b\n</pre>", "  a\n\n    b\n"},
+	{`<ul><li>a<li>b<ul><li>c</ul></ul>`, "* a\n* b\n  * c\n"},
+	{`<ol start=9><li>a<li>b</ol>`, "9. a\n10. b\n"},
+	{`<table><tr><th>a<th>b<tr><td>1<td>2 <b>3</b></table>`, "a\tb\n1\t2 3\n"},
+	{`<h1>t</h1><blockquote><p>a</p><p>b</p></blockquote>`, "t\n\n  a\n\n  b\n"},
+	{`<head><title>t</title><style>p{}</style></head><p>a<script>x</script> <img alt="i"></p>`, "a i\n"},
+	{``, ""},
+}
+
+func TestText(t *testing.T) {
+	for _, test := range textTests {
+		if got := render(t, Text, test.in); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+var markdownTests = []struct {
+	in, want string
+}{
+	{`<h2>a <i>b</i></h2><p>c<em> d </em>e <strong>f</strong> <del>g</del></p>`, "## a *b*\n\nc *d* e **f** ~~g~~\n"},
+	{`<div>a</div><div>b</div>`, "a\n\nb\n"},
+	{`<p>a<br>b</p>`, "a\\\nb\n"},
+	{`<p><a href="/x" title='t "q"'>a <b>b</b></a> <a href="/a b">c</a> <a>d</a></p>`, "[a **b**](/x \"t \\\"q\\\"\") [c](</a b>) d\n"},
+	{`<p><img src=a.png alt="a [b]"></p>`, "![a \\[b\\]](a.png)\n"},
+	{`<p>1. * _a_ [b] &amp;lt;</p><p># c</p>`, "1\\. \\* \\_a\\_ \\[b\\] \\&lt;\n\n\\# c\n"},
+	{`<p>use <code>a` + "`" + `b</code></p>`, "use ``a`b``\n"},
+	{"<pre><code class=language-go>a\n\n```\n</code></pre>", "````go\na\n\n```\n````\n"},
+	{`<ul><li>a<li><p>b<p>c</ul><ol><li>d<ol><li>e</ol></ol>`, "- a\n\n- b\n\n  c\n\n1. d\n   1. e\n"},
+	{`<blockquote><p>a<blockquote>b</blockquote></blockquote>`, "> a\n>\n> > b\n"},
+	{`<table><thead><tr><th>a<th>b|c</thead><tr><td>1<td>2<tr><td>3</table>`, "| a | b\\|c |\n| --- | --- |\n| 1 | 2 |\n| 3 |  |\n"},
+	{`<table><thead><tr><th>a<th>b|c</thead><tr><td>1<br>2<td>3</table>`, "| a | b\\|c |\n| --- | --- |\n| 1<br>2 | 3 |\n"},
+	{`<p>a</p><hr><p>b</p>`, "a\n\n---\n\nb\n"},
+}
+
+func TestMarkdown(t *testing.T) {
+	for _, test := range markdownTests {
+		if got := render(t, Markdown, test.in); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func render(t *testing.T, f func(w io.Writer, n *html.Node) error, in string) string {
+	doc, err := html.Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := f(&b, doc); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
@@ -0,0 +1,305 @@
+// Package resources lists the links, images, scripts, stylesheets, frames
+// and other resources that exp/html parse trees refer to, with absolute
+// URLs, and rewrites the URL attributes of trees to absolute form.
+//
+// Relative URLs are resolved as a browser would, against the href of the
+// first base element of the document, itself resolved against the URL the
+// document was fetched from:
+//
+//	doc, err := html.Parse(resp.Body)
+//	if err != nil {
+//		// ...
+//	}
+//	for _, r := range resources.Extract(doc, resources.Base(doc, resp.Request.URL)) {
+//		fmt.Println(r.Kind, r.URL)
+//	}
+package resources
+
+import (
+	"exp/html"
+	"net/url"
+	"strings"
+)
+
+// A Kind classifies resources.
+type Kind string
+
+const (
+	Link       Kind = "link"       // a and area elements, and link elements other than stylesheets and icons
+	Image      Kind = "image"      // img elements, image inputs, picture sources and video posters
+	Script     Kind = "script"     // script elements
+	Stylesheet Kind = "stylesheet" // link elements with rel="stylesheet"
+	Icon       Kind = "icon"       // link elements for favicons and touch icons
+	Frame      Kind = "frame"      // iframe and frame elements
+	Media      Kind = "media"      // audio and video elements, their sources and tracks
+	Object     Kind = "object"     // embed and object elements
+	Form       Kind = "form"       // form actions and the formaction of buttons
+)
+
+// A Resource is a URL that a document refers to. Element and Attr locate
+// its first reference, as in "img" and "src".
+type Resource struct {
+	URL     string
+	Kind    Kind
+	Element string
+	Attr    string
+}
+
+// references maps elements to their attributes that hold URLs.
+var references = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"audio":  {"src"},
+	"button": {"formaction"},
+	"embed":  {"src"},
+	"form":   {"action"},
+	"frame":  {"src"},
+	"iframe": {"src"},
+	"img":    {"src", "srcset"},
+	"input":  {"src", "formaction"},
+	"link":   {"href"},
+	"object": {"data"},
+	"script": {"src"},
+	"source": {"src", "srcset"},
+	"track":  {"src"},
+	"video":  {"src", "poster"},
+}
+
+// iconRels are the link relations of icons.
+var iconRels = map[string]bool{
+	"apple-touch-icon":             true,
+	"apple-touch-icon-precomposed": true,
+	"icon":                         true,
+	"mask-icon":                    true,
+}
+
+// Base returns the URL that relative URLs in doc are resolved against: the
+// href of its first base element, resolved against page, the URL of the
+// document, or page itself without one. It returns nil if neither is known
+// or the base is not absolute.
+func Base(doc *html.Node, page *url.URL) *url.URL {
+	var href string
+	var found bool
+	walk(doc, func(n *html.Node) bool {
+		if !found && n.Type == html.ElementNode && n.Data == "base" && n.Namespace == "" {
+			href, found = attrOK(n, "href")
+		}
+		return !found
+	})
+	if !found {
+		return page
+	}
+	u, err := url.Parse(clean(href))
+	if err != nil {
+		return page
+	}
+	if page != nil {
+		u = page.ResolveReference(u)
+	}
+	if !u.IsAbs() {
+		return nil
+	}
+	return u
+}
+
+// Extract returns the resources that the tree rooted at n refers to, in
+// document order, each URL and Kind once. URLs are resolved against base,
+// and left as written if base is nil. Empty, javascript: and data: URLs
+// are left out.
+func Extract(n *html.Node, base *url.URL) []*Resource {
+	var list []*Resource
+	seen := make(map[Resource]bool)
+	walk(n, func(n *html.Node) bool {
+		if n.Type != html.ElementNode || n.Namespace != "" {
+			return true
+		}
+		for _, key := range references[n.Data] {
+			v, ok := attrOK(n, key)
+			if !ok {
+				continue
+			}
+			kind := kindOf(n, key)
+			if kind == "" {
+				continue
+			}
+			for _, ref := range refs(key, v) {
+				u, ok := resolve(base, ref)
+				if !ok {
+					continue
+				}
+				k := Resource{URL: u, Kind: kind}
+				if seen[k] {
+					continue
+				}
+				seen[k] = true
+				list = append(list, &Resource{URL: u, Kind: kind, Element: n.Data, Attr: key})
+			}
+		}
+		return true
+	})
+	return list
+}
+
+// Resolve rewrites the URL attributes in the tree rooted at n to absolute
+// URLs, resolved against base. URLs that cannot be resolved, and the
+// javascript: and data: URLs that Extract leaves out, are kept as they
+// are.
+func Resolve(n *html.Node, base *url.URL) {
+	if base == nil {
+		return
+	}
+	walk(n, func(n *html.Node) bool {
+		if n.Type != html.ElementNode || n.Namespace != "" {
+			return true
+		}
+		for _, key := range references[n.Data] {
+			for i, a := range n.Attr {
+				if a.Key != key || a.Namespace != "" {
+					continue
+				}
+				if key == "srcset" {
+					n.Attr[i].Val = resolveSrcset(base, a.Val)
+				} else if u, ok := resolve(base, a.Val); ok {
+					n.Attr[i].Val = u
+				}
+			}
+		}
+		return true
+	})
+}
+
+// kindOf returns the kind of the resource in the attribute key of n.
+func kindOf(n *html.Node, key string) Kind {
+	switch n.Data {
+	case "a", "area":
+		return Link
+	case "img":
+		return Image
+	case "input":
+		if key == "formaction" {
+			return Form
+		}
+		if strings.EqualFold(strings.TrimSpace(attr(n, "type")), "image") {
+			return Image
+		}
+		return ""
+	case "button", "form":
+		return Form
+	case "script":
+		return Script
+	case "iframe", "frame":
+		return Frame
+	case "embed", "object":
+		return Object
+	case "audio", "track":
+		return Media
+	case "video":
+		if key == "poster" {
+			return Image
+		}
+		return Media
+	case "source":
+		if n.Parent != nil && n.Parent.Data == "picture" {
+			return Image
+		}
+		return Media
+	case "link":
+		kind := Link
+		for _, rel := range strings.Fields(strings.ToLower(attr(n, "rel"))) {
+			switch {
+			case rel == "stylesheet":
+				return Stylesheet
+			case iconRels[rel]:
+				kind = Icon
+			}
+		}
+		return kind
+	}
+	return ""
+}
+
+// refs returns the URLs in the value v of the attribute key: the image
+// candidates of a srcset, or v itself.
+func refs(key, v string) []string {
+	if key != "srcset" {
+		return []string{v}
+	}
+	var urls []string
+	for _, candidate := range strings.Split(v, ",") {
+		if f := strings.Fields(candidate); len(f) > 0 {
+			urls = append(urls, f[0])
+		}
+	}
+	return urls
+}
+
+// resolveSrcset returns the srcset value v with the URLs of its image
+// candidates resolved against base.
+func resolveSrcset(base *url.URL, v string) string {
+	candidates := strings.Split(v, ",")
+	for i, candidate := range candidates {
+		f := strings.Fields(candidate)
+		if len(f) == 0 {
+			continue
+		}
+		if u, ok := resolve(base, f[0]); ok {
+			f[0] = u
+		}
+		candidates[i] = strings.Join(f, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// resolve returns the URL reference ref resolved against base, or ref as
+// it is if base is nil. It returns false for references that are not to
+// resources: empty, unparsable, javascript: and data: ones.
+func resolve(base *url.URL, ref string) (string, bool) {
+	ref = clean(ref)
+	if ref == "" {
+		return "", false
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "javascript", "data", "vbscript":
+		return "", false
+	}
+	if base == nil {
+		return ref, true
+	}
+	return base.ResolveReference(u).String(), true
+}
+
+// clean strips the leading and trailing white space of a URL and removes
+// the tabs and newlines in it, as browsers do.
+func clean(ref string) string {
+	ref = strings.Trim(ref, " \t\n\f\r")
+	return strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(ref)
+}
+
+// walk calls f for the nodes of the tree rooted at n in document order,
+// skipping the children of those for which it returns false.
+func walk(n *html.Node, f func(*html.Node) bool) {
+	if !f(n) {
+		return
+	}
+	for _, c := range n.Child {
+		walk(c, f)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := attrOK(n, key)
+	return v
+}
+
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key && a.Namespace == "" {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,111 @@
+package resources
+
+import (
+	"bytes"
+	"exp/html"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html><html><head>
+<base href="/docs/">
+<link rel=stylesheet href="style.css"><link rel="shortcut icon" href="/favicon.ico">
+<link rel=alternate hreflang=fr href="fr/">
+<script src="//cdn.example.com/app.js"></script>
+</head><body>
+<a href="page.html#top">a</a> <a href=" page.html#top ">again</a> <a href="javascript:void(0)">js</a> <a href="">empty</a>
+<img src="a.png" srcset="a.png 1x, b.png 2x"><img src="data:image/gif;base64,R0lGODlh">
+<picture><source srcset="c.webp"></picture><video src="v.mp4" poster="p.jpg"><track src="t.vtt"></video>
+<iframe src="https://other.example/"></iframe><object data="o.swf"></object>
+<form action="/search"><input type=image src="go.png"><button formaction="?x=1">b</button><input type=text src=ignored.png></form>
+<svg><a href="svg.html"></a></svg>
+</body></html>`
+
+func TestExtract(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := url.Parse("http://example.com/index.html")
+	base := Base(doc, page)
+	if base.String() != "http://example.com/docs/" {
+		t.Fatalf("got base %v", base)
+	}
+	want := []*Resource{
+		{"http://example.com/docs/style.css", Stylesheet, "link", "href"},
+		{"http://example.com/favicon.ico", Icon, "link", "href"},
+		{"http://example.com/docs/fr/", Link, "link", "href"},
+		{"http://cdn.example.com/app.js", Script, "script", "src"},
+		{"http://example.com/docs/page.html#top", Link, "a", "href"},
+		{"http://example.com/docs/a.png", Image, "img", "src"},
+		{"http://example.com/docs/b.png", Image, "img", "srcset"},
+		{"http://example.com/docs/c.webp", Image, "source", "srcset"},
+		{"http://example.com/docs/v.mp4", Media, "video", "src"},
+		{"http://example.com/docs/p.jpg", Image, "video", "poster"},
+		{"http://example.com/docs/t.vtt", Media, "track", "src"},
+		{"https://other.example/", Frame, "iframe", "src"},
+		{"http://example.com/docs/o.swf", Object, "object", "data"},
+		{"http://example.com/search", Form, "form", "action"},
+		{"http://example.com/docs/go.png", Image, "input", "src"},
+		{"http://example.com/docs/?x=1", Form, "button", "formaction"},
+	}
+	got := Extract(doc, base)
+	if !reflect.DeepEqual(got, want) {
+		for _, r := range got {
+			t.Logf("%+v", *r)
+		}
+		t.Errorf("got %d resources, want %d", len(got), len(want))
+	}
+}
+
+var baseTests = []struct {
+	page, doc, want string
+}{
+	{"http://example.com/a/b", `<p>x`, "http://example.com/a/b"},
+	{"http://example.com/a/b", `<base href="https://cdn.example.com/">`, "https://cdn.example.com/"},
+	{"http://example.com/a/b", `<base target=_top><base href="../c/">`, "http://example.com/c/"},
+	{"", `<base href="../c/">`, "<nil>"},
+	{"", `<base href="http://example.com/">`, "http://example.com/"},
+	{"", `<p>x`, "<nil>"},
+}
+
+func TestBase(t *testing.T) {
+	for _, test := range baseTests {
+		doc, err := html.Parse(strings.NewReader(test.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page *url.URL
+		if test.page != "" {
+			page, _ = url.Parse(test.page)
+		}
+		got := "<nil>"
+		if base := Base(doc, page); base != nil {
+			got = base.String()
+		}
+		if got != test.want {
+			t.Errorf("%s %s: got %s, want %s", test.page, test.doc, got, test.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	nodes, err := html.ParseFragment(strings.NewReader(`<a href="b?c#d" title="x.html">a</a><img src="/i.png" srcset="j.png 2x,k.png   3x"><a href="javascript:x()">j</a>`), &html.Node{Type: html.ElementNode, Data: "body"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("http://example.com/a/")
+	var b bytes.Buffer
+	for _, n := range nodes {
+		Resolve(n, base)
+		if err := html.Render(&b, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `<a href="http://example.com/a/b?c#d" title="x.html">a</a><img src="http://example.com/i.png" srcset="http://example.com/a/j.png 2x, http://example.com/a/k.png 3x"/><a href="javascript:x()">j</a>`
+	if got := b.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package sanitize
+
+// DefaultPolicy returns a new Policy for user-generated content: text
+// formatting, headings, lists, tables, quotes, links and images, with
+// http, https and mailto URLs, a few presentational CSS properties, and
+// nofollow links. Ids are not allowed, so that the content cannot clobber
+// the elements of the page it is shown in.
+func DefaultPolicy() *Policy {
+	p := &Policy{
+		Elements: map[string][]string{
+			"a":          {"href", "hreflang", "name", "rel"},
+			"blockquote": {"cite"},
+			"col":        {"span", "width"},
+			"colgroup":   {"span", "width"},
+			"del":        {"cite", "datetime"},
+			"details":    {"open"},
+			"img":        {"alt", "height", "src", "srcset", "width"},
+			"ins":        {"cite", "datetime"},
+			"li":         {"value"},
+			"ol":         {"reversed", "start", "type"},
+			"q":          {"cite"},
+			"table":      {"summary"},
+			"td":         {"colspan", "headers", "rowspan"},
+			"th":         {"abbr", "colspan", "headers", "rowspan", "scope"},
+			"time":       {"datetime"},
+		},
+		Attrs:      []string{"class", "dir", "lang", "style", "title"},
+		URLSchemes: []string{"http", "https", "mailto"},
+		CSSProperties: []string{
+			"background-color", "border", "border-bottom", "border-collapse",
+			"border-color", "border-left", "border-right", "border-style",
+			"border-top", "border-width", "color", "float", "font",
+			"font-family", "font-size", "font-style", "font-weight", "height",
+			"letter-spacing", "line-height", "list-style-type", "margin",
+			"margin-bottom", "margin-left", "margin-right", "margin-top",
+			"padding", "padding-bottom", "padding-left", "padding-right",
+			"padding-top", "text-align", "text-decoration", "text-indent",
+			"text-transform", "vertical-align", "white-space", "width",
+			"word-spacing",
+		},
+		NoFollow: true,
+	}
+	for _, name := range []string{
+		"abbr", "acronym", "address", "article", "aside", "b", "bdi", "bdo",
+		"big", "br", "caption", "center", "cite", "code", "dd", "dfn", "div",
+		"dl", "dt", "em", "figcaption", "figure", "footer", "h1", "h2", "h3",
+		"h4", "h5", "h6", "header", "hgroup", "hr", "i", "kbd", "mark", "p",
+		"pre", "rp", "rt", "ruby", "s", "samp", "section", "small", "span",
+		"strike", "strong", "sub", "summary", "sup", "tbody", "tfoot",
+		"thead", "title", "tr", "tt", "u", "ul", "var", "wbr",
+	} {
+		p.Elements[name] = nil
+	}
+	return p
+}
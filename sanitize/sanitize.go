@@ -0,0 +1,323 @@
+// Package sanitize removes the content of exp/html parse trees that is not
+// safe to show on a web page, such as scripts, event handlers and
+// javascript: URLs, according to an allow-list Policy.
+//
+// Elements the policy does not allow are removed but their content is kept
+// in their place. Elements whose content is raw text or markup of its own,
+// such as script, style, iframe, object and svg, are always removed with
+// their content, as are comments. Attributes are kept only if the policy
+// allows them on their element, event handler attributes never are, and
+// URLs and style declarations are checked against the allowed schemes and
+// CSS properties.
+//
+//	doc, err := html.Parse(r)
+//	if err != nil {
+//		// ...
+//	}
+//	sanitize.DefaultPolicy().Sanitize(doc)
+//	err = html.Render(w, doc)
+package sanitize
+
+import (
+	"exp/html"
+	"strings"
+)
+
+// A Policy lists what is allowed in a sanitized tree. The zero Policy only
+// keeps text.
+type Policy struct {
+	// Elements maps the names of the allowed elements to the attributes
+	// allowed on them in addition to Attrs. Names are in lower case.
+	Elements map[string][]string
+	// Attrs are allowed on every allowed element.
+	Attrs []string
+	// URLSchemes are the schemes, such as "https" or "mailto", allowed in
+	// attributes holding URLs. Relative URLs are always allowed, and
+	// javascript: and vbscript: URLs never are.
+	URLSchemes []string
+	// CSSProperties are the properties kept in style attributes, if those
+	// are allowed.
+	CSSProperties []string
+	// NoFollow adds rel="nofollow" to links, so that search engines do not
+	// credit their targets.
+	NoFollow bool
+}
+
+// dropped are the elements that are always removed with their content:
+// Render writes the text of some of them unescaped, and the others embed
+// active content or markup of another language.
+var dropped = map[string]bool{
+	"applet":    true,
+	"embed":     true,
+	"frame":     true,
+	"frameset":  true,
+	"iframe":    true,
+	"math":      true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"object":    true,
+	"plaintext": true,
+	"script":    true,
+	"style":     true,
+	"svg":       true,
+	"template":  true,
+	"xmp":       true,
+}
+
+// structural are the elements of a document that are kept whatever the
+// policy, so that a sanitized document is still one.
+var structural = map[string]bool{
+	"html": true,
+	"head": true,
+	"body": true,
+}
+
+// urlAttrs are the attributes whose value is a URL.
+var urlAttrs = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"formaction": true,
+	"href":       true,
+	"longdesc":   true,
+	"poster":     true,
+	"src":        true,
+	"usemap":     true,
+}
+
+// A sanitizer applies a Policy, with its lists turned into sets.
+type sanitizer struct {
+	p          *Policy
+	attrs      map[string]bool
+	schemes    map[string]bool
+	properties map[string]bool
+}
+
+func (p *Policy) sanitizer() *sanitizer {
+	s := &sanitizer{
+		p:          p,
+		attrs:      set(p.Attrs),
+		schemes:    set(p.URLSchemes),
+		properties: set(p.CSSProperties),
+	}
+	delete(s.schemes, "javascript")
+	delete(s.schemes, "vbscript")
+	return s
+}
+
+func set(list []string) map[string]bool {
+	m := make(map[string]bool, len(list))
+	for _, s := range list {
+		m[strings.ToLower(s)] = true
+	}
+	return m
+}
+
+// Sanitize removes from the tree rooted at n what p does not allow. n itself
+// is kept; it is typically a document node.
+func (p *Policy) Sanitize(n *html.Node) {
+	p.sanitizer().children(n)
+}
+
+// SanitizeNodes sanitizes a list of sibling nodes, such as the result of
+// html.ParseFragment, and returns the nodes that take their place.
+func (p *Policy) SanitizeNodes(nodes []*html.Node) []*html.Node {
+	parent := &html.Node{Type: html.DocumentNode}
+	for _, n := range nodes {
+		parent.Add(n)
+	}
+	p.Sanitize(parent)
+	result := parent.Child
+	for _, n := range result {
+		n.Parent = nil
+	}
+	return result
+}
+
+// children sanitizes the children of n, replacing the elements that are not
+// allowed by their own sanitized children.
+func (s *sanitizer) children(n *html.Node) {
+	old := n.Child
+	n.Child = nil
+	for _, c := range old {
+		c.Parent = nil
+		switch c.Type {
+		case html.TextNode:
+			s.addText(n, c)
+		case html.DoctypeNode:
+			// Render writes the name and identifiers of doctypes as they
+			// are, so only the plain one is kept.
+			c.Data, c.Attr = "html", nil
+			n.Add(c)
+		case html.ElementNode:
+			// Trees that were not parsed, such as those decoded from json,
+			// may have names in upper case.
+			c.Data = strings.ToLower(c.Data)
+			if c.Namespace != "" || dropped[c.Data] {
+				continue
+			}
+			s.children(c)
+			allowed, ok := s.p.Elements[c.Data]
+			if !ok && !structural[c.Data] {
+				// Keep the content in place of the element.
+				grandchildren := c.Child
+				c.Child = nil
+				for _, g := range grandchildren {
+					g.Parent = nil
+					if g.Type == html.TextNode {
+						s.addText(n, g)
+					} else {
+						n.Add(g)
+					}
+				}
+				continue
+			}
+			c.Attr = s.attributes(c, allowed)
+			n.Add(c)
+		}
+	}
+}
+
+// addText adds the text node t to n, merging it with the last child of n if
+// that is text as well.
+func (s *sanitizer) addText(n, t *html.Node) {
+	if k := len(n.Child); k > 0 && n.Child[k-1].Type == html.TextNode {
+		last := n.Child[k-1]
+		last.Data += t.Data
+		if t.End.Offset > last.End.Offset {
+			last.End = t.End
+		}
+		return
+	}
+	n.Add(t)
+}
+
+// attributes returns the attributes of the element n that are allowed,
+// those in allowed and the global ones, with their values made safe.
+func (s *sanitizer) attributes(n *html.Node, allowed []string) []html.Attribute {
+	var attr []html.Attribute
+	for _, a := range n.Attr {
+		a.Key = strings.ToLower(a.Key)
+		if a.Namespace != "" || strings.HasPrefix(a.Key, "on") {
+			continue
+		}
+		if !s.attrs[a.Key] && !contains(allowed, a.Key) {
+			continue
+		}
+		switch {
+		case urlAttrs[a.Key]:
+			if !s.allowURL(a.Val) {
+				continue
+			}
+		case a.Key == "srcset":
+			if !s.allowSrcset(a.Val) {
+				continue
+			}
+		case a.Key == "style":
+			if a.Val = s.style(a.Val); a.Val == "" {
+				continue
+			}
+		}
+		attr = append(attr, a)
+	}
+	if s.p.NoFollow && (n.Data == "a" || n.Data == "area") {
+		attr = noFollow(attr)
+	}
+	return attr
+}
+
+// noFollow adds "nofollow" to the rel attribute of a link with an href.
+func noFollow(attr []html.Attribute) []html.Attribute {
+	href, rel := false, -1
+	for i, a := range attr {
+		switch a.Key {
+		case "href":
+			href = true
+		case "rel":
+			rel = i
+		}
+	}
+	switch {
+	case !href:
+	case rel == -1:
+		attr = append(attr, html.Attribute{Key: "rel", Val: "nofollow"})
+	case !contains(strings.Fields(strings.ToLower(attr[rel].Val)), "nofollow"):
+		attr[rel].Val = strings.TrimSpace(attr[rel].Val + " nofollow")
+	}
+	return attr
+}
+
+func contains(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// allowURL reports whether the URL u is relative or has an allowed scheme.
+// Like browsers, it ignores tabs and newlines in u and leading spaces and
+// control characters.
+func (s *sanitizer) allowURL(u string) bool {
+	u = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, u)
+	u = strings.TrimLeft(u, "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x0b\x0c\x0e\x0f"+
+		"\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f ")
+	i := strings.IndexAny(u, ":/?#")
+	if i == -1 || u[i] != ':' {
+		return true
+	}
+	return s.schemes[strings.ToLower(u[:i])]
+}
+
+// allowSrcset reports whether all the image candidates of the srcset value
+// v have allowed URLs.
+func (s *sanitizer) allowSrcset(v string) bool {
+	for _, candidate := range strings.Split(v, ",") {
+		if f := strings.Fields(candidate); len(f) > 0 && !s.allowURL(f[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// style returns the declarations of the style attribute value v whose
+// properties are allowed and whose values cannot load anything or run
+// script.
+func (s *sanitizer) style(v string) string {
+	var kept []string
+	for _, decl := range strings.Split(v, ";") {
+		i := strings.Index(decl, ":")
+		if i == -1 {
+			continue
+		}
+		property := strings.ToLower(strings.TrimSpace(decl[:i]))
+		value := strings.TrimSpace(decl[i+1:])
+		if s.properties[property] && safeCSSValue(value) {
+			kept = append(kept, property+": "+value)
+		}
+	}
+	return strings.Join(kept, "; ")
+}
+
+// safeCSSValue reports whether the value of a CSS declaration has no URL,
+// expression or other function that could load a resource or run script,
+// and no escape or comment that could hide one.
+func safeCSSValue(v string) bool {
+	if v == "" || strings.ContainsAny(v, "\\<>{}@") || strings.Contains(v, "/*") {
+		return false
+	}
+	v = strings.ToLower(v)
+	for _, f := range []string{"url(", "image(", "image-set(", "element(", "expression(", "javascript:"} {
+		if strings.Contains(v, f) {
+			return false
+		}
+	}
+	return true
+}
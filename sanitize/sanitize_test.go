@@ -0,0 +1,81 @@
+package sanitize
+
+import (
+	"bytes"
+	"exp/html"
+	"strings"
+	"testing"
+)
+
+var sanitizeTests = []struct {
+	in, want string
+}{
+	{`<p>a <b>b</b></p>`, `<p>a <b>b</b></p>`},
+	{`<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`},
+	{`<div><blink>a<i>b</i></blink>c</div>`, `<div>a<i>b</i>c</div>`},
+	{`<!-- c --><p>a</p>`, `<p>a</p>`},
+	{`<p onclick="x()" ONMOUSEOVER=y class=c id=d>a</p>`, `<p class="c">a</p>`},
+	{`<a href="javascript:alert(1)">a</a>`, `<a>a</a>`},
+	{`<a href=" JaVa&#x09;Script:alert(1)">a</a>`, `<a>a</a>`},
+	{`<a href="data:text/html,x">a</a>`, `<a>a</a>`},
+	{`<a href="/b?c:d">a</a>`, `<a href="/b?c:d" rel="nofollow">a</a>`},
+	{`<a href="https://example.com/" rel=author>a</a>`, `<a href="https://example.com/" rel="author nofollow">a</a>`},
+	{`<a name=x>a</a>`, `<a name="x">a</a>`},
+	{`<img src="a.png" srcset="b.png 2x, javascript:x 3x">`, `<img src="a.png"/>`},
+	{`<p style="color: red; position: fixed; background-color:url(x); font-weight:bold">a</p>`,
+		`<p style="color: red; font-weight: bold">a</p>`},
+	{`<p style="color: expression(alert(1))">a</p>`, `<p>a</p>`},
+	{`<p style="color: r\65 d">a</p>`, `<p>a</p>`},
+	{`<iframe src=x></iframe><svg><a href=x>a</a></svg><style>p {}</style>b`, `b`},
+	{`<table><tr><td colspan=2 onclick=x>a</td></tr></table>`, `<table><tbody><tr><td colspan="2">a</td></tr></tbody></table>`},
+}
+
+func TestSanitize(t *testing.T) {
+	for _, test := range sanitizeTests {
+		nodes, err := html.ParseFragment(strings.NewReader(test.in), &html.Node{Type: html.ElementNode, Data: "body"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes = DefaultPolicy().SanitizeNodes(nodes)
+		var b bytes.Buffer
+		for _, n := range nodes {
+			if err := html.Render(&b, n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeDocument(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<!DOCTYPE html SYSTEM "x"><html onload=x><head><title>t</title><script>x</script></head><body><p>a</p></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	DefaultPolicy().Sanitize(doc)
+	var b bytes.Buffer
+	if err := html.Render(&b, doc); err != nil {
+		t.Fatal(err)
+	}
+	want := `<!DOCTYPE html><html><head><title>t</title></head><body><p>a</p></body></html>`
+	if got := b.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// Trees that do not come from the parser may use any case.
+func TestSanitizeCase(t *testing.T) {
+	n := &html.Node{Type: html.DocumentNode}
+	n.Add(&html.Node{Type: html.ElementNode, Data: "SCRIPT"})
+	n.Add(&html.Node{Type: html.ElementNode, Data: "P", Attr: []html.Attribute{{Key: "OnClick", Val: "x"}, {Key: "Class", Val: "c"}}})
+	(&Policy{Elements: map[string][]string{"p": nil}, Attrs: []string{"class"}}).Sanitize(n)
+	var b bytes.Buffer
+	if err := html.Render(&b, n); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), `<p class="c"></p>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
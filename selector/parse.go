@@ -0,0 +1,442 @@
+package selector
+
+import (
+	"exp/html"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A SyntaxError describes a selector that could not be parsed.
+type SyntaxError struct {
+	Selector string
+	Offset   int
+	Msg      string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("selector: %s at offset %d in %q", e.Msg, e.Offset, e.Selector)
+}
+
+// parser is a recursive descent parser for selector lists. It reads s from
+// position i onwards.
+type parser struct {
+	s string
+	i int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Selector: p.s, Offset: p.i, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parse() (Selector, error) {
+	sel, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.i])
+	}
+	return sel, nil
+}
+
+// parseList parses a comma separated list of complex selectors.
+func (p *parser) parseList() (Selector, error) {
+	var list []Selector
+	for {
+		p.skipWhiteSpace()
+		sel, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, sel)
+		p.skipWhiteSpace()
+		if p.i >= len(p.s) || p.s[p.i] != ',' {
+			return or(list), nil
+		}
+		p.i++
+	}
+}
+
+// parseComplex parses compound selectors joined by combinators.
+func (p *parser) parseComplex() (Selector, error) {
+	sel, err := p.parseCompound()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		space := p.skipWhiteSpace()
+		if p.i >= len(p.s) {
+			return sel, nil
+		}
+		var combine func(left, right Selector) Selector
+		switch c := p.s[p.i]; c {
+		case '>':
+			combine = child
+			p.i++
+		case '+':
+			combine = adjacent
+			p.i++
+		case '~':
+			combine = general
+			p.i++
+		case ',', ')':
+			return sel, nil
+		default:
+			if !space {
+				return nil, p.errorf("unexpected %q", c)
+			}
+			combine = descendant
+		}
+		p.skipWhiteSpace()
+		right, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		sel = combine(sel, right)
+	}
+}
+
+// parseCompound parses a sequence of simple selectors without white space,
+// like "div.a#b[c]:first-child".
+func (p *parser) parseCompound() (Selector, error) {
+	// Every compound selector starts with a type selector, which is
+	// implicitly the universal one.
+	list := []Selector{isElement}
+	start := p.i
+	if p.i < len(p.s) && p.s[p.i] == '*' {
+		p.i++
+	} else if p.startsIdent() {
+		name, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		list[0] = typeSelector(strings.ToLower(name))
+	}
+loop:
+	for p.i < len(p.s) {
+		var sel Selector
+		var err error
+		switch p.s[p.i] {
+		case '#':
+			p.i++
+			var id string
+			if id, err = p.parseName(); err == nil {
+				sel = attrSelector("id", "=", id, false)
+			}
+		case '.':
+			p.i++
+			var class string
+			if class, err = p.parseIdent(); err == nil {
+				sel = attrSelector("class", "~=", class, false)
+			}
+		case '[':
+			p.i++
+			sel, err = p.parseAttr()
+		case ':':
+			p.i++
+			sel, err = p.parsePseudo()
+		default:
+			break loop
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, sel)
+	}
+	if p.i == start {
+		if p.i >= len(p.s) {
+			return nil, p.errorf("expected selector")
+		}
+		return nil, p.errorf("unexpected %q", p.s[p.i])
+	}
+	return and(list), nil
+}
+
+// parseAttr parses an attribute selector. The opening '[' has already been
+// consumed.
+func (p *parser) parseAttr() (Selector, error) {
+	p.skipWhiteSpace()
+	key, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	key = strings.ToLower(key)
+	p.skipWhiteSpace()
+	if p.i >= len(p.s) {
+		return nil, p.errorf("unterminated attribute selector")
+	}
+	if p.s[p.i] == ']' {
+		p.i++
+		return func(n *html.Node) bool {
+			_, ok := attr(n, key)
+			return ok
+		}, nil
+	}
+	var op string
+	for _, o := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.s[p.i:], o) {
+			op = o
+		}
+	}
+	if op == "" {
+		return nil, p.errorf("unknown attribute operator %q", p.s[p.i])
+	}
+	p.i += len(op)
+	p.skipWhiteSpace()
+	var val string
+	if p.i < len(p.s) && (p.s[p.i] == '"' || p.s[p.i] == '\'') {
+		val, err = p.parseString()
+	} else {
+		val, err = p.parseIdent()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.skipWhiteSpace()
+	fold := false
+	if p.i < len(p.s) && (p.s[p.i] == 'i' || p.s[p.i] == 'I') {
+		fold = true
+		p.i++
+		p.skipWhiteSpace()
+	}
+	if p.i >= len(p.s) || p.s[p.i] != ']' {
+		return nil, p.errorf("expected ']'")
+	}
+	p.i++
+	return attrSelector(key, op, val, fold), nil
+}
+
+// attrSelector returns the Selector for "[key op val]".
+func attrSelector(key, op, val string, fold bool) Selector {
+	if fold {
+		val = strings.ToLower(val)
+	}
+	return func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return false
+		}
+		s, ok := attr(n, key)
+		if !ok {
+			return false
+		}
+		if fold {
+			s = strings.ToLower(s)
+		}
+		switch op {
+		case "=":
+			return s == val
+		case "~=":
+			for _, f := range strings.Fields(s) {
+				if f == val {
+					return true
+				}
+			}
+			return false
+		case "|=":
+			return s == val || strings.HasPrefix(s, val+"-")
+		case "^=":
+			return val != "" && strings.HasPrefix(s, val)
+		case "$=":
+			return val != "" && strings.HasSuffix(s, val)
+		case "*=":
+			return val != "" && strings.Contains(s, val)
+		}
+		panic("selector: bad attribute operator " + op)
+	}
+}
+
+// parsePseudo parses a pseudo-class. The opening ':' has already been
+// consumed.
+func (p *parser) parsePseudo() (Selector, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(name)
+	switch name {
+	case "root":
+		return root, nil
+	case "empty":
+		return empty, nil
+	case "first-child":
+		return nth(0, 1, false, false), nil
+	case "last-child":
+		return nth(0, 1, true, false), nil
+	case "only-child":
+		return and([]Selector{nth(0, 1, false, false), nth(0, 1, true, false)}), nil
+	case "first-of-type":
+		return nth(0, 1, false, true), nil
+	case "last-of-type":
+		return nth(0, 1, true, true), nil
+	case "only-of-type":
+		return and([]Selector{nth(0, 1, false, true), nth(0, 1, true, true)}), nil
+	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+		arg, err := p.parseArgument()
+		if err != nil {
+			return nil, err
+		}
+		a, b, err := parseNth(arg)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return nth(a, b, strings.HasPrefix(name, "nth-last"), strings.HasSuffix(name, "of-type")), nil
+	case "not":
+		if p.i >= len(p.s) || p.s[p.i] != '(' {
+			return nil, p.errorf("expected '(' after :not")
+		}
+		p.i++
+		sel, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		if p.i >= len(p.s) || p.s[p.i] != ')' {
+			return nil, p.errorf("expected ')'")
+		}
+		p.i++
+		return func(n *html.Node) bool {
+			return n.Type == html.ElementNode && !sel(n)
+		}, nil
+	}
+	return nil, p.errorf("unsupported pseudo-class :%s", name)
+}
+
+// parseArgument returns the raw text between parentheses.
+func (p *parser) parseArgument() (string, error) {
+	if p.i >= len(p.s) || p.s[p.i] != '(' {
+		return "", p.errorf("expected '('")
+	}
+	end := strings.IndexByte(p.s[p.i:], ')')
+	if end == -1 {
+		return "", p.errorf("expected ')'")
+	}
+	arg := p.s[p.i+1 : p.i+end]
+	p.i += end + 1
+	return arg, nil
+}
+
+// parseNth parses the an+b notation of the :nth-* pseudo-classes.
+func parseNth(s string) (a, b int, err error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+	i := strings.IndexByte(s, 'n')
+	if i == -1 {
+		b, err = strconv.Atoi(strings.TrimPrefix(s, "+"))
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad nth expression %q", s)
+		}
+		return 0, b, nil
+	}
+	switch as := strings.TrimPrefix(s[:i], "+"); as {
+	case "":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		if a, err = strconv.Atoi(as); err != nil {
+			return 0, 0, fmt.Errorf("bad nth expression %q", s)
+		}
+	}
+	if bs := s[i+1:]; bs != "" {
+		if bs[0] != '+' && bs[0] != '-' {
+			return 0, 0, fmt.Errorf("bad nth expression %q", s)
+		}
+		if b, err = strconv.Atoi(strings.TrimPrefix(bs, "+")); err != nil {
+			return 0, 0, fmt.Errorf("bad nth expression %q", s)
+		}
+	}
+	return a, b, nil
+}
+
+// skipWhiteSpace skips past any white space and reports whether there was
+// any.
+func (p *parser) skipWhiteSpace() bool {
+	start := p.i
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t', '\n', '\r', '\f':
+			p.i++
+		default:
+			return p.i > start
+		}
+	}
+	return p.i > start
+}
+
+func isNameStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '\\' || c >= 0x80
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9' || c == '-'
+}
+
+// startsIdent reports whether an identifier starts at the current position.
+func (p *parser) startsIdent() bool {
+	if p.i >= len(p.s) {
+		return false
+	}
+	c := p.s[p.i]
+	if c == '-' && p.i+1 < len(p.s) {
+		c = p.s[p.i+1]
+	}
+	return isNameStart(c)
+}
+
+// parseIdent parses a CSS identifier.
+func (p *parser) parseIdent() (string, error) {
+	if !p.startsIdent() {
+		return "", p.errorf("expected identifier")
+	}
+	return p.parseName()
+}
+
+// parseName parses a sequence of name characters, as in an id selector. A
+// backslash escapes the character that follows it.
+func (p *parser) parseName() (string, error) {
+	var buf []byte
+	for p.i < len(p.s) && isNameChar(p.s[p.i]) {
+		c := p.s[p.i]
+		if c == '\\' {
+			p.i++
+			if p.i >= len(p.s) {
+				return "", p.errorf("unterminated escape")
+			}
+			c = p.s[p.i]
+		}
+		buf = append(buf, c)
+		p.i++
+	}
+	if len(buf) == 0 {
+		return "", p.errorf("expected name")
+	}
+	return string(buf), nil
+}
+
+// parseString parses a quoted string.
+func (p *parser) parseString() (string, error) {
+	quote := p.s[p.i]
+	p.i++
+	var buf []byte
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		p.i++
+		switch c {
+		case quote:
+			return string(buf), nil
+		case '\\':
+			if p.i >= len(p.s) {
+				return "", p.errorf("unterminated escape")
+			}
+			c = p.s[p.i]
+			p.i++
+		}
+		buf = append(buf, c)
+	}
+	return "", p.errorf("unterminated string")
+}
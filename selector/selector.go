@@ -0,0 +1,256 @@
+// Package selector implements CSS selectors over exp/html parse trees.
+//
+// The supported syntax covers type, universal, class and id selectors,
+// attribute selectors with the =, ~=, |=, ^=, $= and *= operators (and an
+// optional i flag for case-insensitive values), the descendant, child (>),
+// adjacent sibling (+) and general sibling (~) combinators, selector lists,
+// and the pseudo-classes :root, :empty, :first-child, :last-child,
+// :only-child, :first-of-type, :last-of-type, :only-of-type, :nth-child,
+// :nth-last-child, :nth-of-type, :nth-last-of-type and :not.
+//
+//	sel, err := selector.Compile("div.article > p, a[href^=http]")
+//	if err != nil {
+//		// ...
+//	}
+//	for _, n := range sel.MatchAll(doc) {
+//		// Do something with n...
+//	}
+package selector
+
+import (
+	"exp/html"
+)
+
+// A Selector reports whether an element node matches a compiled CSS
+// selector. It never matches nodes other than elements.
+type Selector func(n *html.Node) bool
+
+// Compile parses a CSS selector list and returns the Selector matching any
+// of its selectors.
+func Compile(sel string) (Selector, error) {
+	p := &parser{s: sel}
+	return p.parse()
+}
+
+// MustCompile is like Compile but panics if sel cannot be parsed.
+func MustCompile(sel string) Selector {
+	s, err := Compile(sel)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Match reports whether n matches s.
+func (s Selector) Match(n *html.Node) bool {
+	return s(n)
+}
+
+// MatchAll returns the descendants of n, and n itself, that match s in
+// document order.
+func (s Selector) MatchAll(n *html.Node) []*html.Node {
+	var result []*html.Node
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if s(n) {
+			result = append(result, n)
+		}
+		for _, c := range n.Child {
+			f(c)
+		}
+	}
+	f(n)
+	return result
+}
+
+// MatchFirst returns the first node in document order that MatchAll would
+// return, or nil if there is none.
+func (s Selector) MatchFirst(n *html.Node) *html.Node {
+	if s(n) {
+		return n
+	}
+	for _, c := range n.Child {
+		if m := s.MatchFirst(c); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// Filter returns the nodes in ns that match s.
+func (s Selector) Filter(ns []*html.Node) []*html.Node {
+	var result []*html.Node
+	for _, n := range ns {
+		if s(n) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// The combinators join the selector for an element's relatives (left) with
+// the selector for the element itself (right).
+
+func descendant(left, right Selector) Selector {
+	return func(n *html.Node) bool {
+		if !right(n) {
+			return false
+		}
+		for p := n.Parent; p != nil; p = p.Parent {
+			if left(p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func child(left, right Selector) Selector {
+	return func(n *html.Node) bool {
+		return right(n) && n.Parent != nil && left(n.Parent)
+	}
+}
+
+func adjacent(left, right Selector) Selector {
+	return func(n *html.Node) bool {
+		if !right(n) {
+			return false
+		}
+		siblings, i := elementSiblings(n)
+		return i > 0 && left(siblings[i-1])
+	}
+}
+
+func general(left, right Selector) Selector {
+	return func(n *html.Node) bool {
+		if !right(n) {
+			return false
+		}
+		siblings, i := elementSiblings(n)
+		for _, s := range siblings[:i] {
+			if left(s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// elementSiblings returns the element children of n's parent, n included,
+// and the index of n among them.
+func elementSiblings(n *html.Node) ([]*html.Node, int) {
+	if n.Parent == nil {
+		return []*html.Node{n}, 0
+	}
+	var siblings []*html.Node
+	i := -1
+	for _, c := range n.Parent.Child {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if c == n {
+			i = len(siblings)
+		}
+		siblings = append(siblings, c)
+	}
+	return siblings, i
+}
+
+// and returns the Selector matching the nodes that match all of ss.
+func and(ss []Selector) Selector {
+	if len(ss) == 1 {
+		return ss[0]
+	}
+	return func(n *html.Node) bool {
+		for _, s := range ss {
+			if !s(n) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// or returns the Selector matching the nodes that match any of ss.
+func or(ss []Selector) Selector {
+	if len(ss) == 1 {
+		return ss[0]
+	}
+	return func(n *html.Node) bool {
+		for _, s := range ss {
+			if s(n) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func isElement(n *html.Node) bool {
+	return n.Type == html.ElementNode
+}
+
+func typeSelector(name string) Selector {
+	return func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == name
+	}
+}
+
+// attr returns the value of n's attribute key, and whether it is present.
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func root(n *html.Node) bool {
+	return n.Type == html.ElementNode && (n.Parent == nil || n.Parent.Type == html.DocumentNode)
+}
+
+func empty(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, c := range n.Child {
+		if c.Type == html.ElementNode || c.Type == html.TextNode && c.Data != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// nth returns the Selector for the :nth-* pseudo-classes. The position of
+// an element counts from 1 among its element siblings, or among those with
+// the same name if ofType is set, from the end if last is set.
+func nth(a, b int, last, ofType bool) Selector {
+	return func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return false
+		}
+		siblings, i := elementSiblings(n)
+		if ofType {
+			var same []*html.Node
+			for _, s := range siblings {
+				if s.Data == n.Data && s.Namespace == n.Namespace {
+					if s == n {
+						i = len(same)
+					}
+					same = append(same, s)
+				}
+			}
+			siblings = same
+		}
+		pos := i + 1
+		if last {
+			pos = len(siblings) - i
+		}
+		if a == 0 {
+			return pos == b
+		}
+		k := pos - b
+		return k%a == 0 && k/a >= 0
+	}
+}
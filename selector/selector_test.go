@@ -0,0 +1,118 @@
+package selector
+
+import (
+	"exp/html"
+	"strings"
+	"testing"
+)
+
+const testDoc = `<!DOCTYPE html>
+<html><body>
+<div id="main" class="article wide">
+	<h1 lang="en-US">Title</h1>
+	<p class="lead">one</p>
+	<p>two <a href="http://example.com/a.pdf">a</a></p>
+	<p data-x="Foo Bar">three <a href="/b">b</a></p>
+	<ul><li>1</li><li>2</li><li>3</li><li>4</li><li>5</li></ul>
+	<span></span>
+</div>
+<div class="aside"><p>four</p></div>
+</body></html>`
+
+var selectorTests = []struct {
+	sel  string
+	want string
+}{
+	{"p", "p.lead p p p"},
+	{"*", "html head body div#main.article h1 p.lead p a p a ul li li li li li span div.aside p"},
+	{"#main", "div#main.article"},
+	{".article", "div#main.article"},
+	{"div.article.wide", "div#main.article"},
+	{"div.aside p", "p"},
+	{"div > p", "p.lead p p p"},
+	{"#main > p", "p.lead p p"},
+	{"body > p", ""},
+	{"h1 + p", "p.lead"},
+	{"h1 ~ p", "p.lead p p"},
+	{"a[href]", "a a"},
+	{`a[href="/b"]`, "a"},
+	{"a[href^=http]", "a"},
+	{"a[href$='.pdf']", "a"},
+	{"a[href*=example]", "a"},
+	{"h1[lang|=en]", "h1"},
+	{"div[class~=wide]", "div#main.article"},
+	{"p[data-x='foo bar' i]", "p"},
+	{"p[data-x='foo bar']", ""},
+	{"li:nth-child(2n+1)", "li li li"},
+	{"li:nth-child(odd)", "li li li"},
+	{"li:nth-child(even)", "li li"},
+	{"li:nth-child(-n+2)", "li li"},
+	{"li:nth-last-child(1)", "li"},
+	{"li:first-child, li:last-child", "li li"},
+	{"#main > p:nth-of-type(2)", "p"},
+	{"p:first-of-type", "p.lead p"},
+	{"p:not(.lead)", "p p p"},
+	{"#main > :not(p, ul)", "h1 span"},
+	{"span:empty", "span"},
+	{":root", "html"},
+	{"div p a", "a a"},
+	{"ul:only-of-type", "ul"},
+}
+
+// describe returns a short description of ns, like "div#main p".
+func describe(ns []*html.Node) string {
+	var s []string
+	for _, n := range ns {
+		d := n.Data
+		for _, a := range n.Attr {
+			switch a.Key {
+			case "id":
+				d += "#" + a.Val
+			case "class":
+				d += "." + strings.Fields(a.Val)[0]
+			}
+		}
+		s = append(s, d)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(testDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range selectorTests {
+		sel, err := Compile(tt.sel)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.sel, err)
+			continue
+		}
+		if got := describe(sel.MatchAll(doc)); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.sel, got, tt.want)
+		}
+	}
+}
+
+func TestMatchFirst(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(testDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := MustCompile("li").MatchFirst(doc); n == nil || n.Child[0].Data != "1" {
+		t.Errorf("got %v, want the first li", n)
+	}
+	if n := MustCompile("table").MatchFirst(doc); n != nil {
+		t.Errorf("got %v, want nil", n)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	for _, sel := range []string{"", "p,", "p >", "[a", "[a=]", "[a^b]", ":nth-child(x)", ":hover", ":not(p", "p)", "a..b", "#"} {
+		if _, err := Compile(sel); err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", sel)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("Compile(%q) returned %T, want *SyntaxError", sel, err)
+		}
+	}
+}
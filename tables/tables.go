@@ -0,0 +1,409 @@
+// Package tables extracts the tables of exp/html parse trees as headers
+// and rows of cell text.
+//
+// Cells spanning several columns or rows are repeated in each slot they
+// cover, so that every row of a table has as many cells as its widest one
+// and a column holds the same field in every row:
+//
+//	<table>
+//	<tr><th rowspan=2>Name<th colspan=2>Score
+//	<tr><th>1st<th>2nd
+//	<tr><td>Ann<td>7<td>9
+//	</table>
+//
+// has the Headers "Name", "Score 1st" and "Score 2nd" and one row, "Ann",
+// "7" and "9".
+//
+// Spans reach no further than the end of their row group, and a table is
+// laid out in at most 64 slots per cell of its source; larger tables are
+// cut and marked as Truncated.
+package tables
+
+import (
+	"encoding/csv"
+	"exp/html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Spans larger than these are clamped, as browsers do.
+const (
+	maxColspan = 1000
+	maxRowspan = 65534
+)
+
+// maxSlotsPerCell bounds the slots of a table relative to its cells, so
+// that a few spanning cells cannot make a small document take gigabytes.
+const maxSlotsPerCell = 64
+
+// A Table is the content of a table element.
+type Table struct {
+	Caption string `json:",omitempty"`
+	// Headers holds the text of the header rows, those of the thead or,
+	// without one, the leading rows made only of th cells. The text of a
+	// column in several header rows is joined with spaces.
+	Headers []string `json:",omitempty"`
+	// Rows holds the other rows, those of the tfoot last.
+	Rows [][]string
+	// Truncated reports that the table had too many slots for its cells
+	// and that its last rows, or the end of the last one, are left out.
+	Truncated bool `json:",omitempty"`
+}
+
+// WriteCSV writes t to w as CSV, with the headers as the first record.
+func (t *Table) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if t.Headers != nil {
+		if err := cw.Write(t.Headers); err != nil {
+			return err
+		}
+	}
+	for _, row := range t.Rows {
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Extract returns the tables in the tree rooted at n in document order.
+// Tables nested in the cell of another are returned after it, and their
+// text is left out of that cell.
+func Extract(n *html.Node) []*Table {
+	var tables []*Table
+	walk(n, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		if n.Namespace != "" || n.Data == "template" {
+			return false
+		}
+		if n.Data == "table" {
+			tables = append(tables, extract(n))
+		}
+		return true
+	})
+	return tables
+}
+
+// extract returns the content of the table element n.
+func extract(n *html.Node) *Table {
+	t := &Table{}
+	var head, body, foot [][]string
+	var rows []*html.Node
+	max := maxSlotsPerCell * countCells(n)
+	b := &budget{left: max}
+	// flush lays out the rows outside of row groups.
+	flush := func() {
+		if len(rows) > 0 {
+			body = append(body, grid(rows, b)...)
+			rows = nil
+		}
+	}
+	for _, c := range n.Child {
+		if b.out {
+			break
+		}
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "caption":
+			if t.Caption == "" {
+				t.Caption = text(c)
+			}
+		case "tr":
+			rows = append(rows, c)
+		case "thead":
+			flush()
+			if head == nil {
+				head = grid(children(c, "tr"), b)
+			} else {
+				body = append(body, grid(children(c, "tr"), b)...)
+			}
+		case "tbody":
+			flush()
+			body = append(body, grid(children(c, "tr"), b)...)
+		case "tfoot":
+			flush()
+			foot = append(foot, grid(children(c, "tr"), b)...)
+		}
+	}
+	flush()
+	if head == nil {
+		// Without a thead, leading rows of th cells are the headers.
+		var k int
+		for _, tr := range headerRows(n) {
+			if !allHeaders(tr) {
+				break
+			}
+			k++
+		}
+		if k > 0 && k <= len(body) {
+			head, body = body[:k], body[k:]
+		}
+	}
+	t.Rows = append(body, foot...)
+	width := 0
+	for _, row := range append(head, t.Rows...) {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if width > 0 && len(t.Rows)*width > max {
+		t.Rows = t.Rows[:max/width]
+		b.out = true
+	}
+	for i := range t.Rows {
+		t.Rows[i] = pad(t.Rows[i], width)
+	}
+	t.Truncated = b.out
+	if t.Rows == nil {
+		t.Rows = [][]string{}
+	}
+	if len(head) > 0 {
+		t.Headers = make([]string, width)
+		for j := range t.Headers {
+			var texts []string
+			for _, row := range head {
+				if j < len(row) && row[j] != "" && (len(texts) == 0 || texts[len(texts)-1] != row[j]) {
+					texts = append(texts, row[j])
+				}
+			}
+			t.Headers[j] = strings.Join(texts, " ")
+		}
+	}
+	return t
+}
+
+// headerRows returns the rows of the table n before its first tbody row
+// or loose row, in which the headers of a table without a thead are.
+func headerRows(n *html.Node) []*html.Node {
+	for _, c := range n.Child {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "tr":
+			return children(n, "tr")
+		case "tbody":
+			return children(c, "tr")
+		}
+	}
+	return nil
+}
+
+// allHeaders reports whether the row tr has cells and they are all th.
+func allHeaders(tr *html.Node) bool {
+	cells := children(tr, "td", "th")
+	for _, c := range cells {
+		if c.Data != "th" {
+			return false
+		}
+	}
+	return len(cells) > 0
+}
+
+// A span is a cell that covers more rows than the one it is in.
+type span struct {
+	text string
+	// rows is the number of rows below that it still covers.
+	rows int
+}
+
+// A budget is the number of slots left to lay out a table in.
+type budget struct {
+	left int
+	// out reports that a slot was refused.
+	out bool
+}
+
+// take reports whether a slot is left, and uses it.
+func (b *budget) take() bool {
+	if b.left == 0 {
+		b.out = true
+		return false
+	}
+	b.left--
+	return true
+}
+
+// grid lays out the rows of a row group, repeating the text of spanning
+// cells in each slot they cover, with the slots left in b. Spans do not
+// reach past the group. Once b runs out, the row being laid out is the
+// last.
+func grid(rows []*html.Node, b *budget) [][]string {
+	out := make([][]string, 0, len(rows))
+	var spans []span
+	for i, tr := range rows {
+		if b.out {
+			break
+		}
+		var row []string
+		col := 0
+		put := func(s string) bool {
+			if !b.take() {
+				return false
+			}
+			row = append(row, s)
+			return true
+		}
+		// fill takes the slots covered from the rows above up to the next
+		// free one.
+		fill := func() {
+			for col < len(spans) && spans[col].rows > 0 && put(spans[col].text) {
+				spans[col].rows--
+				col++
+			}
+		}
+		for _, cell := range children(tr, "td", "th") {
+			fill()
+			s := text(cell)
+			colspan := number(cell, "colspan", 1, maxColspan)
+			rowspan := number(cell, "rowspan", 1, maxRowspan)
+			// Zero spans the rest of the group, and no span goes further.
+			if v := strings.TrimSpace(attr(cell, "rowspan")); v == "0" || rowspan > len(rows)-i {
+				rowspan = len(rows) - i
+			}
+			for k := 0; k < colspan && put(s); k++ {
+				for len(spans) <= col {
+					spans = append(spans, span{})
+				}
+				spans[col] = span{s, rowspan - 1}
+				col++
+			}
+		}
+		// Cells spanning from above after the last cell of the row.
+		for ; col < len(spans) && !b.out; col++ {
+			if spans[col].rows > 0 {
+				put(spans[col].text)
+				spans[col].rows--
+			} else {
+				put("")
+			}
+		}
+		out = append(out, trimEnd(row))
+	}
+	return out
+}
+
+// trimEnd removes the empty slots at the end of a row that only spanning
+// cells of earlier rows may have left.
+func trimEnd(row []string) []string {
+	for len(row) > 0 && row[len(row)-1] == "" {
+		row = row[:len(row)-1]
+	}
+	return row
+}
+
+func pad(row []string, width int) []string {
+	for len(row) < width {
+		row = append(row, "")
+	}
+	return row
+}
+
+// number returns the integer value of the attribute key of n, def if it
+// is missing or invalid, and at most max.
+func number(n *html.Node, key string, def, max int) int {
+	v, err := strconv.Atoi(strings.TrimSpace(attr(n, key)))
+	if err != nil || v < 1 {
+		return def
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// blocks are the elements whose text is separated from what surrounds it
+// in a cell.
+var blocks = map[string]bool{
+	"blockquote": true, "br": true, "dd": true, "div": true, "dt": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"hr": true, "li": true, "ol": true, "p": true, "pre": true, "ul": true,
+}
+
+// text returns the text of a cell or caption on one line, without that of
+// nested tables, scripts and styles.
+func text(n *html.Node) string {
+	var b []byte
+	var add func(*html.Node)
+	add = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b = append(b, n.Data...)
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "table", "script", "style", "template":
+				return
+			}
+		}
+		if blocks[n.Data] {
+			b = append(b, ' ')
+		}
+		for _, c := range n.Child {
+			add(c)
+		}
+		if blocks[n.Data] {
+			b = append(b, ' ')
+		}
+	}
+	for _, c := range n.Child {
+		add(c)
+	}
+	return strings.Join(strings.Fields(string(b)), " ")
+}
+
+// countCells returns the number of cells in the rows of the table n.
+func countCells(n *html.Node) int {
+	rows := children(n, "tr")
+	for _, g := range children(n, "thead", "tbody", "tfoot") {
+		rows = append(rows, children(g, "tr")...)
+	}
+	k := 0
+	for _, tr := range rows {
+		k += len(children(tr, "td", "th"))
+	}
+	return k
+}
+
+// children returns the element children of n with one of the given names.
+func children(n *html.Node, names ...string) []*html.Node {
+	var list []*html.Node
+	for _, c := range n.Child {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		for _, name := range names {
+			if c.Data == name {
+				list = append(list, c)
+				break
+			}
+		}
+	}
+	return list
+}
+
+// walk calls f for the nodes of the tree rooted at n in document order,
+// skipping the children of those for which it returns false.
+func walk(n *html.Node, f func(*html.Node) bool) {
+	if !f(n) {
+		return
+	}
+	for _, c := range n.Child {
+		walk(c, f)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key && a.Namespace == "" {
+			return a.Val
+		}
+	}
+	return ""
+}
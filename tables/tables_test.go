@@ -0,0 +1,98 @@
+package tables
+
+import (
+	"bytes"
+	"exp/html"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var extractTests = []struct {
+	in   string
+	want []*Table
+}{
+	{
+		`<table><caption> Scores </caption><tr><th rowspan=2>Name<th colspan=2>Score<tr><th>1st<th>2nd<tr><td>Ann<td>7<td>9</table>`,
+		[]*Table{{Caption: "Scores", Headers: []string{"Name", "Score 1st", "Score 2nd"}, Rows: [][]string{{"Ann", "7", "9"}}}},
+	},
+	{
+		`<table><tfoot><tr><td>total<td>3</tfoot><thead><tr><td>a<td>b</thead><tbody><tr><td>x<td>1<tr><td>y<td>2</tbody></table>`,
+		[]*Table{{Headers: []string{"a", "b"}, Rows: [][]string{{"x", "1"}, {"y", "2"}, {"total", "3"}}}},
+	},
+	{
+		`<table><tr><td rowspan=3>a<td>b<tr><td>c<tr><td>d<td>e</table>`,
+		[]*Table{{Rows: [][]string{{"a", "b", ""}, {"a", "c", ""}, {"a", "d", "e"}}}},
+	},
+	{
+		// Spans stop at the end of their row group.
+		`<table><tbody><tr><td rowspan=0>a<td>b<tr><td>c</tbody><tbody><tr><td>d</tbody></table>`,
+		[]*Table{{Rows: [][]string{{"a", "b"}, {"a", "c"}, {"d", ""}}}},
+	},
+	{
+		`<table><tr><td>x<td rowspan=2>y<tr><td>z</table>`,
+		[]*Table{{Rows: [][]string{{"x", "y"}, {"z", "y"}}}},
+	},
+	{
+		`<table><tr><td colspan=3>wide<tr><td>1<td>2</table>`,
+		[]*Table{{Rows: [][]string{{"wide", "wide", "wide"}, {"1", "2", ""}}}},
+	},
+	{
+		`<table><tr><td>outer <table><tr><td>inner</table> cell<br>next<p>para</table>`,
+		[]*Table{
+			{Rows: [][]string{{"outer cell next para"}}},
+			{Rows: [][]string{{"inner"}}},
+		},
+	},
+	{
+		`<table></table>`,
+		[]*Table{{Rows: [][]string{}}},
+	},
+}
+
+func TestExtract(t *testing.T) {
+	for _, test := range extractTests {
+		doc, err := html.Parse(strings.NewReader(test.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Extract(doc)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:", test.in)
+			for _, table := range got {
+				t.Errorf("got %+v", *table)
+			}
+		}
+	}
+}
+
+func TestExtractSpans(t *testing.T) {
+	// Each cell would cover a thousand columns of every row below it.
+	in := "<table><tr>" + strings.Repeat("<td colspan=1000 rowspan=0>x", 100) + strings.Repeat("<tr>", 10000) + "</table>"
+	doc, err := html.Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := Extract(doc)
+	if len(tables) != 1 || !tables[0].Truncated {
+		t.Fatalf("got %d tables, want 1 truncated", len(tables))
+	}
+	slots := 0
+	for _, row := range tables[0].Rows {
+		slots += len(row)
+	}
+	if max := 100 * maxSlotsPerCell; slots > max {
+		t.Errorf("got %d slots, want at most %d", slots, max)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	table := &Table{Headers: []string{"a", "b,c"}, Rows: [][]string{{`say "hi"`, "1"}}}
+	var b bytes.Buffer
+	if err := table.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "a,\"b,c\"\n\"say \"\"hi\"\"\",1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+package xpath
+
+import (
+	"exp/html"
+)
+
+// An axis selects the nodes related to a context node.
+type axis int
+
+const (
+	childAxis axis = iota
+	descendantAxis
+	parentAxis
+	ancestorAxis
+	followingSiblingAxis
+	precedingSiblingAxis
+	followingAxis
+	precedingAxis
+	attributeAxis
+	namespaceAxis
+	selfAxis
+	descendantOrSelfAxis
+	ancestorOrSelfAxis
+)
+
+var axes = map[string]axis{
+	"child":              childAxis,
+	"descendant":         descendantAxis,
+	"parent":             parentAxis,
+	"ancestor":           ancestorAxis,
+	"following-sibling":  followingSiblingAxis,
+	"preceding-sibling":  precedingSiblingAxis,
+	"following":          followingAxis,
+	"preceding":          precedingAxis,
+	"attribute":          attributeAxis,
+	"namespace":          namespaceAxis,
+	"self":               selfAxis,
+	"descendant-or-self": descendantOrSelfAxis,
+	"ancestor-or-self":   ancestorOrSelfAxis,
+}
+
+// walk calls f for the nodes on the axis from n, in the order of the axis:
+// document order for forward axes and reverse document order for the
+// reverse ones. html documents have no namespace nodes.
+func (a axis) walk(n Node, f func(Node)) {
+	switch a {
+	case childAxis:
+		if n.Attr == nil {
+			for _, c := range n.Child {
+				f(Node{Node: c})
+			}
+		}
+	case descendantAxis:
+		if n.Attr == nil {
+			descendants(n.Node, f)
+		}
+	case descendantOrSelfAxis:
+		f(n)
+		if n.Attr == nil {
+			descendants(n.Node, f)
+		}
+	case parentAxis:
+		if n.Attr != nil {
+			f(Node{Node: n.Node})
+		} else if n.Parent != nil {
+			f(Node{Node: n.Parent})
+		}
+	case ancestorAxis, ancestorOrSelfAxis:
+		if a == ancestorOrSelfAxis {
+			f(n)
+		}
+		p := n.Parent
+		if n.Attr != nil {
+			p = n.Node
+		}
+		for ; p != nil; p = p.Parent {
+			f(Node{Node: p})
+		}
+	case followingSiblingAxis, precedingSiblingAxis:
+		if n.Attr != nil || n.Parent == nil {
+			return
+		}
+		siblings := n.Parent.Child
+		i := indexOf(siblings, n.Node)
+		if a == followingSiblingAxis {
+			for _, s := range siblings[i+1:] {
+				f(Node{Node: s})
+			}
+		} else {
+			for j := i - 1; j >= 0; j-- {
+				f(Node{Node: siblings[j]})
+			}
+		}
+	case followingAxis:
+		m := n.Node
+		if n.Attr != nil {
+			// The descendants of an attribute's element follow it.
+			descendants(m, f)
+		}
+		for ; m.Parent != nil; m = m.Parent {
+			siblings := m.Parent.Child
+			for _, s := range siblings[indexOf(siblings, m)+1:] {
+				f(Node{Node: s})
+				descendants(s, f)
+			}
+		}
+	case precedingAxis:
+		for m := n.Node; m.Parent != nil; m = m.Parent {
+			siblings := m.Parent.Child
+			for j := indexOf(siblings, m) - 1; j >= 0; j-- {
+				reverseDescendants(siblings[j], f)
+				f(Node{Node: siblings[j]})
+			}
+		}
+	case attributeAxis:
+		if n.Attr == nil && n.Type == html.ElementNode {
+			for i := range n.Node.Attr {
+				f(Node{n.Node, &n.Node.Attr[i]})
+			}
+		}
+	case selfAxis:
+		f(n)
+	}
+}
+
+func indexOf(ns []*html.Node, n *html.Node) int {
+	for i, m := range ns {
+		if m == n {
+			return i
+		}
+	}
+	return -1
+}
+
+func descendants(n *html.Node, f func(Node)) {
+	for _, c := range n.Child {
+		f(Node{Node: c})
+		descendants(c, f)
+	}
+}
+
+func reverseDescendants(n *html.Node, f func(Node)) {
+	for i := len(n.Child) - 1; i >= 0; i-- {
+		reverseDescendants(n.Child[i], f)
+		f(Node{Node: n.Child[i]})
+	}
+}
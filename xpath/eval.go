@@ -0,0 +1,471 @@
+package xpath
+
+import (
+	"exp/html"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Node is a member of a node-set: an html.Node, or an attribute of one.
+// For attribute nodes, Node is the element that carries the attribute and
+// Attr points into its Attr slice.
+type Node struct {
+	*html.Node
+	Attr *html.Attribute
+}
+
+// IsAttr reports whether n is an attribute node.
+func (n Node) IsAttr() bool {
+	return n.Attr != nil
+}
+
+// Name returns the expanded name of n as XPath's name() function does: the
+// tag name of elements, the key of attributes, prefixed with the namespace
+// for foreign ones, and "" for other nodes.
+func (n Node) Name() string {
+	switch {
+	case n.Attr != nil:
+		if n.Attr.Namespace != "" {
+			return n.Attr.Namespace + ":" + n.Attr.Key
+		}
+		return n.Attr.Key
+	case n.Type == html.ElementNode:
+		if n.Namespace != "" {
+			return n.Namespace + ":" + n.Data
+		}
+		return n.Data
+	}
+	return ""
+}
+
+// String returns the string-value of n.
+func (n Node) String() string {
+	if n.Attr != nil {
+		return n.Attr.Val
+	}
+	switch n.Type {
+	case html.TextNode, html.CommentNode:
+		return n.Data
+	case html.ElementNode, html.DocumentNode:
+		var b []byte
+		var f func(*html.Node)
+		f = func(n *html.Node) {
+			if n.Type == html.TextNode {
+				b = append(b, n.Data...)
+			}
+			for _, c := range n.Child {
+				f(c)
+			}
+		}
+		f(n.Node)
+		return string(b)
+	}
+	return ""
+}
+
+// A nodeSet is the value of an expression that selects nodes.
+type nodeSet []Node
+
+// context is the evaluation context of an expression.
+type context struct {
+	node      Node
+	pos, size int
+	doc       *document
+}
+
+// document records the document order of the nodes of a tree.
+type document struct {
+	root  *html.Node
+	order map[*html.Node]int
+}
+
+func newDocument(n *html.Node) *document {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	d := &document{root: n, order: make(map[*html.Node]int)}
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		d.order[n] = len(d.order)
+		for _, c := range n.Child {
+			f(c)
+		}
+	}
+	f(n)
+	return d
+}
+
+// less reports whether a precedes b in document order. Attributes follow
+// their element and precede its children.
+func (d *document) less(a, b Node) bool {
+	if a.Node != b.Node {
+		return d.order[a.Node] < d.order[b.Node]
+	}
+	return attrIndex(a) < attrIndex(b)
+}
+
+func attrIndex(n Node) int {
+	if n.Attr == nil {
+		return -1
+	}
+	for i := range n.Node.Attr {
+		if &n.Node.Attr[i] == n.Attr {
+			return i
+		}
+	}
+	return -1
+}
+
+// sort sorts ns into document order and removes duplicates.
+func (d *document) sort(ns nodeSet) nodeSet {
+	sort.Sort(byOrder{ns, d})
+	out := ns[:0]
+	for i, n := range ns {
+		if i == 0 || n != ns[i-1] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+type byOrder struct {
+	ns  nodeSet
+	doc *document
+}
+
+func (s byOrder) Len() int           { return len(s.ns) }
+func (s byOrder) Less(i, j int) bool { return s.doc.less(s.ns[i], s.ns[j]) }
+func (s byOrder) Swap(i, j int)      { s.ns[i], s.ns[j] = s.ns[j], s.ns[i] }
+
+// evalError is the panic value used to abandon evaluation.
+type evalError struct {
+	err error
+}
+
+func errorf(format string, args ...interface{}) {
+	panic(evalError{fmt.Errorf("xpath: "+format, args...)})
+}
+
+func (e literalExpr) eval(c *context) interface{} {
+	return string(e)
+}
+
+func (e numberExpr) eval(c *context) interface{} {
+	return float64(e)
+}
+
+func (e *negExpr) eval(c *context) interface{} {
+	return -toNumber(e.e.eval(c))
+}
+
+func (e rootExpr) eval(c *context) interface{} {
+	return nodeSet{{Node: c.doc.root}}
+}
+
+func (e *unionExpr) eval(c *context) interface{} {
+	left, right := e.left.eval(c), e.right.eval(c)
+	l, ok1 := left.(nodeSet)
+	r, ok2 := right.(nodeSet)
+	if !ok1 || !ok2 {
+		errorf("the operands of | must be node-sets")
+	}
+	return c.doc.sort(append(append(nodeSet{}, l...), r...))
+}
+
+func (e *filterExpr) eval(c *context) interface{} {
+	ns, ok := e.primary.eval(c).(nodeSet)
+	if !ok {
+		errorf("predicates can only filter node-sets")
+	}
+	for _, pred := range e.preds {
+		ns = filter(c, ns, pred)
+	}
+	return ns
+}
+
+func (e *pathExpr) eval(c *context) interface{} {
+	ns := nodeSet{c.node}
+	if e.start != nil {
+		var ok bool
+		if ns, ok = e.start.eval(c).(nodeSet); !ok {
+			errorf("a location step can only follow a node-set")
+		}
+	}
+	for _, s := range e.steps {
+		var next nodeSet
+		for _, n := range ns {
+			next = append(next, s.apply(c, n)...)
+		}
+		ns = c.doc.sort(next)
+	}
+	return ns
+}
+
+// apply returns the nodes selected by s from the context node n.
+func (s *step) apply(c *context, n Node) nodeSet {
+	var ns nodeSet
+	s.axis.walk(n, func(m Node) {
+		if s.test.match(m, s.axis == attributeAxis) {
+			ns = append(ns, m)
+		}
+	})
+	for _, pred := range s.preds {
+		ns = filter(c, ns, pred)
+	}
+	return ns
+}
+
+// filter returns the nodes of ns, which is in axis order, for which pred
+// holds.
+func filter(c *context, ns nodeSet, pred expr) nodeSet {
+	var out nodeSet
+	for i, n := range ns {
+		sub := &context{node: n, pos: i + 1, size: len(ns), doc: c.doc}
+		v := pred.eval(sub)
+		if f, ok := v.(float64); ok {
+			if f == float64(sub.pos) {
+				out = append(out, n)
+			}
+		} else if toBoolean(v) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// match reports whether n passes the node test. Name tests match elements,
+// or attributes on the attribute axis. Element names are compared without
+// regard to case, as html tag names are.
+func (t nodeTest) match(n Node, attrAxis bool) bool {
+	switch t.typ {
+	case "node":
+		return true
+	case "text":
+		return n.Attr == nil && n.Type == html.TextNode
+	case "comment":
+		return n.Attr == nil && n.Type == html.CommentNode
+	case "processing-instruction":
+		return false
+	}
+	var ns, local string
+	if attrAxis {
+		if n.Attr == nil {
+			return false
+		}
+		ns, local = n.Attr.Namespace, n.Attr.Key
+	} else {
+		if n.Attr != nil || n.Type != html.ElementNode {
+			return false
+		}
+		ns, local = n.Namespace, n.Data
+	}
+	if t.name == "*" {
+		return true
+	}
+	prefix, name := "", t.name
+	if i := strings.IndexByte(t.name, ':'); i >= 0 {
+		prefix, name = t.name[:i], t.name[i+1:]
+	}
+	if prefix != ns && !(prefix == "" && !attrAxis) {
+		return false
+	}
+	return name == "*" || strings.EqualFold(name, local)
+}
+
+func (e *binaryExpr) eval(c *context) interface{} {
+	switch e.op {
+	case "or":
+		return toBoolean(e.left.eval(c)) || toBoolean(e.right.eval(c))
+	case "and":
+		return toBoolean(e.left.eval(c)) && toBoolean(e.right.eval(c))
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compare(e.op, e.left.eval(c), e.right.eval(c))
+	}
+	l, r := toNumber(e.left.eval(c)), toNumber(e.right.eval(c))
+	switch e.op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "div":
+		return l / r
+	case "mod":
+		return math.Mod(l, r)
+	}
+	panic("xpath: bad operator " + e.op)
+}
+
+// compare implements the comparison operators of section 3.4.
+func compare(op string, l, r interface{}) bool {
+	lns, lok := l.(nodeSet)
+	rns, rok := r.(nodeSet)
+	switch {
+	case lok && rok:
+		for _, a := range lns {
+			for _, b := range rns {
+				if compareAtoms(op, a.String(), b.String()) {
+					return true
+				}
+			}
+		}
+		return false
+	case lok:
+		if b, ok := r.(bool); ok {
+			return compareAtoms(op, len(lns) > 0, b)
+		}
+		for _, a := range lns {
+			if compareAtoms(op, convertLike(a.String(), r), r) {
+				return true
+			}
+		}
+		return false
+	case rok:
+		if b, ok := l.(bool); ok {
+			return compareAtoms(op, b, len(rns) > 0)
+		}
+		for _, b := range rns {
+			if compareAtoms(op, l, convertLike(b.String(), l)) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareAtoms(op, l, r)
+}
+
+// convertLike converts the string-value s of a node to the type of v.
+func convertLike(s string, v interface{}) interface{} {
+	if _, ok := v.(float64); ok {
+		return toNumber(s)
+	}
+	return s
+}
+
+// compareAtoms compares two values that are not node-sets.
+func compareAtoms(op string, l, r interface{}) bool {
+	if op == "=" || op == "!=" {
+		var eq bool
+		_, lb := l.(bool)
+		_, rb := r.(bool)
+		_, lf := l.(float64)
+		_, rf := r.(float64)
+		switch {
+		case lb || rb:
+			eq = toBoolean(l) == toBoolean(r)
+		case lf || rf:
+			eq = toNumber(l) == toNumber(r)
+		default:
+			eq = toString(l) == toString(r)
+		}
+		return eq == (op == "=")
+	}
+	a, b := toNumber(l), toNumber(r)
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}
+
+// toString implements the string() conversion.
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return formatNumber(v)
+	case nodeSet:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].String()
+	}
+	panic(fmt.Sprintf("xpath: unexpected value %T", v))
+}
+
+func formatNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// toNumber implements the number() conversion.
+func toNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		s := strings.TrimSpace(v)
+		if !isNumber(s) {
+			return math.NaN()
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	case nodeSet:
+		return toNumber(toString(v))
+	}
+	panic(fmt.Sprintf("xpath: unexpected value %T", v))
+}
+
+// isNumber reports whether s matches the Number production with an
+// optional minus sign; strconv would also accept exponents and "Inf".
+func isNumber(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	digits, dot := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case isDigit(s[i]):
+			digits++
+		case s[i] == '.' && !dot:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// toBoolean implements the boolean() conversion.
+func toBoolean(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case nodeSet:
+		return len(v) > 0
+	}
+	panic(fmt.Sprintf("xpath: unexpected value %T", v))
+}
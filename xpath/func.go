@@ -0,0 +1,316 @@
+package xpath
+
+import (
+	"exp/html"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// A function is one of the functions of the XPath 1.0 core library. A
+// maxArgs of -1 means any number of arguments.
+type function struct {
+	minArgs, maxArgs int
+	call             func(c *context, args []interface{}) interface{}
+}
+
+var functions = map[string]*function{
+	// Node set functions.
+	"last":          {0, 0, fnLast},
+	"position":      {0, 0, fnPosition},
+	"count":         {1, 1, fnCount},
+	"id":            {1, 1, fnID},
+	"local-name":    {0, 1, fnLocalName},
+	"namespace-uri": {0, 1, fnNamespaceURI},
+	"name":          {0, 1, fnName},
+
+	// String functions.
+	"string":           {0, 1, fnString},
+	"concat":           {2, -1, fnConcat},
+	"starts-with":      {2, 2, fnStartsWith},
+	"contains":         {2, 2, fnContains},
+	"substring-before": {2, 2, fnSubstringBefore},
+	"substring-after":  {2, 2, fnSubstringAfter},
+	"substring":        {2, 3, fnSubstring},
+	"string-length":    {0, 1, fnStringLength},
+	"normalize-space":  {0, 1, fnNormalizeSpace},
+	"translate":        {3, 3, fnTranslate},
+
+	// Boolean functions.
+	"boolean": {1, 1, fnBoolean},
+	"not":     {1, 1, fnNot},
+	"true":    {0, 0, fnTrue},
+	"false":   {0, 0, fnFalse},
+	"lang":    {1, 1, fnLang},
+
+	// Number functions.
+	"number":  {0, 1, fnNumber},
+	"sum":     {1, 1, fnSum},
+	"floor":   {1, 1, fnFloor},
+	"ceiling": {1, 1, fnCeiling},
+	"round":   {1, 1, fnRound},
+}
+
+func (e *funcExpr) eval(c *context) interface{} {
+	args := make([]interface{}, len(e.args))
+	for i, a := range e.args {
+		args[i] = a.eval(c)
+	}
+	return e.fn.call(c, args)
+}
+
+// nodeSetArg returns args[0] as a node-set, or the context node if the
+// argument is omitted.
+func nodeSetArg(c *context, name string, args []interface{}) nodeSet {
+	if len(args) == 0 {
+		return nodeSet{c.node}
+	}
+	ns, ok := args[0].(nodeSet)
+	if !ok {
+		errorf("the argument of %s() must be a node-set", name)
+	}
+	return ns
+}
+
+// stringArg returns args[0] as a string, or the string-value of the context
+// node if the argument is omitted.
+func stringArg(c *context, args []interface{}) string {
+	if len(args) == 0 {
+		return c.node.String()
+	}
+	return toString(args[0])
+}
+
+func fnLast(c *context, args []interface{}) interface{} {
+	return float64(c.size)
+}
+
+func fnPosition(c *context, args []interface{}) interface{} {
+	return float64(c.pos)
+}
+
+func fnCount(c *context, args []interface{}) interface{} {
+	return float64(len(nodeSetArg(c, "count", args)))
+}
+
+// fnID returns the elements whose id is among the white space separated
+// ids in its argument.
+func fnID(c *context, args []interface{}) interface{} {
+	var ids []string
+	if ns, ok := args[0].(nodeSet); ok {
+		for _, n := range ns {
+			ids = append(ids, strings.Fields(n.String())...)
+		}
+	} else {
+		ids = strings.Fields(toString(args[0]))
+	}
+	var result nodeSet
+	descendants(c.doc.root, func(n Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		for _, a := range n.Node.Attr {
+			if a.Key == "id" && a.Namespace == "" && contains(ids, a.Val) {
+				result = append(result, n)
+				return
+			}
+		}
+	})
+	return result
+}
+
+func fnLocalName(c *context, args []interface{}) interface{} {
+	ns := nodeSetArg(c, "local-name", args)
+	if len(ns) == 0 {
+		return ""
+	}
+	name := ns[0].Name()
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+func fnNamespaceURI(c *context, args []interface{}) interface{} {
+	ns := nodeSetArg(c, "namespace-uri", args)
+	if len(ns) == 0 {
+		return ""
+	}
+	n := ns[0]
+	if n.Attr != nil {
+		return namespaceURIs[n.Attr.Namespace]
+	}
+	if n.Type != html.ElementNode {
+		return ""
+	}
+	return namespaceURIs[n.Namespace]
+}
+
+// namespaceURIs maps the namespace abbreviations used by the parser to
+// their URIs.
+var namespaceURIs = map[string]string{
+	"":      "http://www.w3.org/1999/xhtml",
+	"math":  "http://www.w3.org/1998/Math/MathML",
+	"svg":   "http://www.w3.org/2000/svg",
+	"xlink": "http://www.w3.org/1999/xlink",
+	"xml":   "http://www.w3.org/XML/1998/namespace",
+	"xmlns": "http://www.w3.org/2000/xmlns/",
+}
+
+func fnName(c *context, args []interface{}) interface{} {
+	ns := nodeSetArg(c, "name", args)
+	if len(ns) == 0 {
+		return ""
+	}
+	return ns[0].Name()
+}
+
+func fnString(c *context, args []interface{}) interface{} {
+	return stringArg(c, args)
+}
+
+func fnConcat(c *context, args []interface{}) interface{} {
+	var s []string
+	for _, a := range args {
+		s = append(s, toString(a))
+	}
+	return strings.Join(s, "")
+}
+
+func fnStartsWith(c *context, args []interface{}) interface{} {
+	return strings.HasPrefix(toString(args[0]), toString(args[1]))
+}
+
+func fnContains(c *context, args []interface{}) interface{} {
+	return strings.Contains(toString(args[0]), toString(args[1]))
+}
+
+func fnSubstringBefore(c *context, args []interface{}) interface{} {
+	s, sep := toString(args[0]), toString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i]
+	}
+	return ""
+}
+
+func fnSubstringAfter(c *context, args []interface{}) interface{} {
+	s, sep := toString(args[0]), toString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[i+len(sep):]
+	}
+	return ""
+}
+
+// fnSubstring returns the characters whose 1-based position p satisfies
+// round(start) <= p < round(start) + round(length).
+func fnSubstring(c *context, args []interface{}) interface{} {
+	s := []rune(toString(args[0]))
+	start := round(toNumber(args[1]))
+	end := math.Inf(1)
+	if len(args) == 3 {
+		end = start + round(toNumber(args[2]))
+	}
+	var out []rune
+	for i, r := range s {
+		if p := float64(i + 1); p >= start && p < end {
+			out = append(out, r)
+		}
+	}
+	return string(out)
+}
+
+func fnStringLength(c *context, args []interface{}) interface{} {
+	return float64(utf8.RuneCountInString(stringArg(c, args)))
+}
+
+func fnNormalizeSpace(c *context, args []interface{}) interface{} {
+	return strings.Join(strings.Fields(stringArg(c, args)), " ")
+}
+
+// fnTranslate replaces the characters of its second argument by those at
+// the same position in the third, dropping those without a counterpart.
+func fnTranslate(c *context, args []interface{}) interface{} {
+	from, to := []rune(toString(args[1])), []rune(toString(args[2]))
+	var out []rune
+	for _, r := range toString(args[0]) {
+		i := strings.IndexRune(string(from), r)
+		if i < 0 {
+			out = append(out, r)
+			continue
+		}
+		if j := utf8.RuneCountInString(string(from)[:i]); j < len(to) {
+			out = append(out, to[j])
+		}
+	}
+	return string(out)
+}
+
+func fnBoolean(c *context, args []interface{}) interface{} {
+	return toBoolean(args[0])
+}
+
+func fnNot(c *context, args []interface{}) interface{} {
+	return !toBoolean(args[0])
+}
+
+func fnTrue(c *context, args []interface{}) interface{} {
+	return true
+}
+
+func fnFalse(c *context, args []interface{}) interface{} {
+	return false
+}
+
+// fnLang reports whether the lang attribute in scope of the context node
+// is the given language or a sublanguage of it.
+func fnLang(c *context, args []interface{}) interface{} {
+	want := strings.ToLower(toString(args[0]))
+	for n := c.node.Node; n != nil; n = n.Parent {
+		for _, a := range n.Attr {
+			if a.Key == "lang" && (a.Namespace == "" || a.Namespace == "xml") {
+				lang := strings.ToLower(a.Val)
+				return lang == want || strings.HasPrefix(lang, want+"-")
+			}
+		}
+	}
+	return false
+}
+
+func fnNumber(c *context, args []interface{}) interface{} {
+	if len(args) == 0 {
+		return toNumber(c.node.String())
+	}
+	return toNumber(args[0])
+}
+
+func fnSum(c *context, args []interface{}) interface{} {
+	var sum float64
+	for _, n := range nodeSetArg(c, "sum", args) {
+		sum += toNumber(n.String())
+	}
+	return sum
+}
+
+func fnFloor(c *context, args []interface{}) interface{} {
+	return math.Floor(toNumber(args[0]))
+}
+
+func fnCeiling(c *context, args []interface{}) interface{} {
+	return math.Ceil(toNumber(args[0]))
+}
+
+func fnRound(c *context, args []interface{}) interface{} {
+	return round(toNumber(args[0]))
+}
+
+// round rounds to the closest integer, and towards positive infinity for
+// halves, as XPath's round() does.
+func round(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	if f < 0 && f >= -0.5 {
+		return math.Copysign(0, -1)
+	}
+	return math.Floor(f + 0.5)
+}
@@ -0,0 +1,184 @@
+package xpath
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A tokenType is the type of a lexical token of an XPath expression.
+type tokenType int
+
+const (
+	eofToken tokenType = iota
+	// operatorToken is a punctuation operator like "/", "=" or "|", or one of
+	// the operator names "and", "or", "mod" and "div".
+	operatorToken
+	// punctToken is one of "(", ")", "[", "]", ",", "@", "::", "." and "..".
+	punctToken
+	nameToken
+	// nameTestToken is "*" or "prefix:*".
+	nameTestToken
+	numberToken
+	literalToken
+	variableToken
+)
+
+// A token is a lexical token. For names, name tests, numbers, literals and
+// variables, val holds the text of the token without quotes or "$".
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+// lex splits an XPath expression into tokens, following the disambiguation
+// rules of section 3.7 of the XPath 1.0 specification.
+func lex(s string) ([]token, error) {
+	var toks []token
+	i := 0
+	for {
+		for i < len(s) && strings.IndexByte(" \t\r\n", s[i]) >= 0 {
+			i++
+		}
+		if i >= len(s) {
+			return append(toks, token{eofToken, "", i}), nil
+		}
+		start := i
+		// An operator is expected after anything that can end an operand.
+		wantOperator := len(toks) > 0 && !precedesOperand(toks[len(toks)-1])
+		c := s[i]
+		switch {
+		case c == '(' || c == ')' || c == '[' || c == ']' || c == ',' || c == '@':
+			i++
+			toks = append(toks, token{punctToken, s[start:i], start})
+		case c == ':' && i+1 < len(s) && s[i+1] == ':':
+			i += 2
+			toks = append(toks, token{punctToken, "::", start})
+		case c == '.' && i+1 < len(s) && s[i+1] == '.':
+			i += 2
+			toks = append(toks, token{punctToken, "..", start})
+		case c == '.' && (i+1 >= len(s) || !isDigit(s[i+1])):
+			i++
+			toks = append(toks, token{punctToken, ".", start})
+		case c == '/' || c == '|' || c == '+' || c == '-' || c == '=':
+			i++
+			if c == '/' && i < len(s) && s[i] == '/' {
+				i++
+			}
+			toks = append(toks, token{operatorToken, s[start:i], start})
+		case c == '!' || c == '<' || c == '>':
+			i++
+			if i < len(s) && s[i] == '=' {
+				i++
+			} else if c == '!' {
+				return nil, &SyntaxError{s, start, "unexpected '!'"}
+			}
+			toks = append(toks, token{operatorToken, s[start:i], start})
+		case c == '*':
+			i++
+			if wantOperator {
+				toks = append(toks, token{operatorToken, "*", start})
+			} else {
+				toks = append(toks, token{nameTestToken, "*", start})
+			}
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end == -1 {
+				return nil, &SyntaxError{s, start, "unterminated literal"}
+			}
+			i += end + 2
+			toks = append(toks, token{literalToken, s[start+1 : i-1], start})
+		case isDigit(c) || c == '.':
+			for i < len(s) && isDigit(s[i]) {
+				i++
+			}
+			if i < len(s) && s[i] == '.' {
+				i++
+				for i < len(s) && isDigit(s[i]) {
+					i++
+				}
+			}
+			toks = append(toks, token{numberToken, s[start:i], start})
+		case c == '$':
+			i++
+			name := scanName(s[i:])
+			if name == "" {
+				return nil, &SyntaxError{s, start, "expected variable name"}
+			}
+			i += len(name)
+			toks = append(toks, token{variableToken, name, start})
+		case isNameStart(c):
+			name := scanName(s[i:])
+			i += len(name)
+			if wantOperator {
+				switch name {
+				case "and", "or", "mod", "div":
+					toks = append(toks, token{operatorToken, name, start})
+					continue
+				}
+				return nil, &SyntaxError{s, start, fmt.Sprintf("expected operator, found %q", name)}
+			}
+			if strings.HasSuffix(name, ":") {
+				// A "prefix:" followed by "*".
+				if i < len(s) && s[i] == '*' {
+					i++
+					toks = append(toks, token{nameTestToken, s[start:i], start})
+					continue
+				}
+				return nil, &SyntaxError{s, start, "expected name after prefix"}
+			}
+			toks = append(toks, token{nameToken, name, start})
+		default:
+			return nil, &SyntaxError{s, start, fmt.Sprintf("unexpected %q", c)}
+		}
+	}
+}
+
+// precedesOperand reports whether an operand, rather than an operator, may
+// follow t.
+func precedesOperand(t token) bool {
+	switch t.typ {
+	case operatorToken:
+		return true
+	case punctToken:
+		switch t.val {
+		case "(", "[", ",", "@", "::":
+			return true
+		}
+	}
+	return false
+}
+
+// scanName returns the name at the start of s: an NCName, a QName like
+// "prefix:local", or a "prefix:" that is followed by "*".
+func scanName(s string) string {
+	i := 0
+	for i < len(s) && isNameChar(s[i]) {
+		i++
+	}
+	if i+1 < len(s) && s[i] == ':' {
+		if s[i+1] == '*' {
+			return s[:i+1]
+		}
+		if isNameStart(s[i+1]) {
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			return s[:j]
+		}
+	}
+	return s[:i]
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || isDigit(c) || c == '-' || c == '.'
+}
@@ -0,0 +1,413 @@
+package xpath
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A SyntaxError describes an expression that could not be parsed.
+type SyntaxError struct {
+	Expr   string
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("xpath: %s at offset %d in %q", e.Msg, e.Offset, e.Expr)
+}
+
+// An expr is a node of the abstract syntax tree of an expression. Its eval
+// method returns a nodeSet, string, float64 or bool.
+type expr interface {
+	eval(c *context) interface{}
+}
+
+type (
+	literalExpr string
+	numberExpr  float64
+
+	// binaryExpr is an arithmetic, comparison or boolean operation.
+	binaryExpr struct {
+		op          string
+		left, right expr
+	}
+	negExpr struct {
+		e expr
+	}
+	unionExpr struct {
+		left, right expr
+	}
+	// filterExpr applies predicates to the node-set returned by primary.
+	filterExpr struct {
+		primary expr
+		preds   []expr
+	}
+	// pathExpr applies steps to the node-set returned by start. A nil start
+	// means the context node.
+	pathExpr struct {
+		start expr
+		steps []*step
+	}
+	// rootExpr returns the root of the context node's tree.
+	rootExpr struct{}
+	funcExpr struct {
+		name string
+		fn   *function
+		args []expr
+	}
+	step struct {
+		axis  axis
+		test  nodeTest
+		preds []expr
+	}
+)
+
+// A nodeTest is the node test of a step. name is a QName, "*" or
+// "prefix:*" for name tests; typ is set for node type tests instead.
+type nodeTest struct {
+	name string
+	typ  string
+}
+
+type parser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func parse(src string) (expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, toks: toks}
+	var e expr
+	err = p.recover(func() {
+		e = p.parseOr()
+		if t := p.peek(); t.typ != eofToken {
+			p.errorf(t, "unexpected %q", t.val)
+		}
+	})
+	return e, err
+}
+
+// parseError is the panic value used to abandon parsing.
+type parseError struct {
+	err *SyntaxError
+}
+
+// recover runs f, turning the panics raised by errorf into an error.
+func (p *parser) recover(f func()) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			pe, ok := x.(parseError)
+			if !ok {
+				panic(x)
+			}
+			err = pe.err
+		}
+	}()
+	f()
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) {
+	panic(parseError{&SyntaxError{p.src, t.pos, fmt.Sprintf(format, args...)}})
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+// peekN returns the token n positions ahead of the current one.
+func (p *parser) peekN(n int) token {
+	if p.i+n < len(p.toks) {
+		return p.toks[p.i+n]
+	}
+	return p.toks[len(p.toks)-1]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.typ != eofToken {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the current token if it has the given type and value.
+func (p *parser) accept(typ tokenType, val string) bool {
+	if t := p.peek(); t.typ == typ && t.val == val {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(typ tokenType, val string) {
+	if !p.accept(typ, val) {
+		t := p.peek()
+		if t.typ == eofToken {
+			p.errorf(t, "expected %q at end of expression", val)
+		}
+		p.errorf(t, "expected %q, found %q", val, t.val)
+	}
+}
+
+// parseBinary parses a left-associative chain of the given operators, with
+// operands parsed by operand.
+func (p *parser) parseBinary(operand func() expr, ops ...string) expr {
+	e := operand()
+	for {
+		t := p.peek()
+		if t.typ != operatorToken || !contains(ops, t.val) {
+			return e
+		}
+		p.next()
+		e = &binaryExpr{t.val, e, operand()}
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() expr {
+	return p.parseBinary(p.parseAnd, "or")
+}
+
+func (p *parser) parseAnd() expr {
+	return p.parseBinary(p.parseEquality, "and")
+}
+
+func (p *parser) parseEquality() expr {
+	return p.parseBinary(p.parseRelational, "=", "!=")
+}
+
+func (p *parser) parseRelational() expr {
+	return p.parseBinary(p.parseAdditive, "<", "<=", ">", ">=")
+}
+
+func (p *parser) parseAdditive() expr {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *parser) parseMultiplicative() expr {
+	return p.parseBinary(p.parseUnary, "*", "div", "mod")
+}
+
+func (p *parser) parseUnary() expr {
+	if p.accept(operatorToken, "-") {
+		return &negExpr{p.parseUnary()}
+	}
+	return p.parseUnion()
+}
+
+func (p *parser) parseUnion() expr {
+	e := p.parsePath()
+	for p.accept(operatorToken, "|") {
+		e = &unionExpr{e, p.parsePath()}
+	}
+	return e
+}
+
+// parsePath parses a location path or a filter expression optionally
+// followed by a relative location path.
+func (p *parser) parsePath() expr {
+	if !p.startsPrimary() {
+		return p.parseLocationPath()
+	}
+	e := p.parsePrimary()
+	var preds []expr
+	for p.peek().typ == punctToken && p.peek().val == "[" {
+		preds = append(preds, p.parsePredicate())
+	}
+	if len(preds) > 0 {
+		e = &filterExpr{e, preds}
+	}
+	if t := p.peek(); t.typ == operatorToken && (t.val == "/" || t.val == "//") {
+		return &pathExpr{e, p.parseRelativePath()}
+	}
+	return e
+}
+
+// startsPrimary reports whether the current token starts a primary
+// expression rather than a location path.
+func (p *parser) startsPrimary() bool {
+	switch t := p.peek(); t.typ {
+	case literalToken, numberToken, variableToken:
+		return true
+	case punctToken:
+		return t.val == "("
+	case nameToken:
+		next := p.peekN(1)
+		return next.typ == punctToken && next.val == "(" && !isNodeType(t.val)
+	}
+	return false
+}
+
+func isNodeType(name string) bool {
+	switch name {
+	case "node", "text", "comment", "processing-instruction":
+		return true
+	}
+	return false
+}
+
+func (p *parser) parsePrimary() expr {
+	t := p.next()
+	switch t.typ {
+	case literalToken:
+		return literalExpr(t.val)
+	case numberToken:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			p.errorf(t, "bad number %q", t.val)
+		}
+		return numberExpr(f)
+	case variableToken:
+		p.errorf(t, "variables are not supported")
+	case punctToken:
+		e := p.parseOr()
+		p.expect(punctToken, ")")
+		return e
+	}
+	return p.parseFunctionCall(t)
+}
+
+func (p *parser) parseFunctionCall(name token) expr {
+	fn, ok := functions[name.val]
+	if !ok {
+		p.errorf(name, "unknown function %s()", name.val)
+	}
+	p.expect(punctToken, "(")
+	var args []expr
+	if !p.accept(punctToken, ")") {
+		for {
+			args = append(args, p.parseOr())
+			if p.accept(punctToken, ")") {
+				break
+			}
+			p.expect(punctToken, ",")
+		}
+	}
+	if len(args) < fn.minArgs || fn.maxArgs >= 0 && len(args) > fn.maxArgs {
+		p.errorf(name, "wrong number of arguments to %s()", name.val)
+	}
+	return &funcExpr{name.val, fn, args}
+}
+
+func (p *parser) parseLocationPath() expr {
+	t := p.peek()
+	if t.typ != operatorToken || t.val != "/" && t.val != "//" {
+		return &pathExpr{nil, p.parseSteps()}
+	}
+	if t.val == "/" {
+		// A lone "/" selects the root.
+		p.next()
+		if !p.startsStep() {
+			return &pathExpr{rootExpr{}, nil}
+		}
+		return &pathExpr{rootExpr{}, p.parseSteps()}
+	}
+	return &pathExpr{rootExpr{}, p.parseRelativePath()}
+}
+
+// parseRelativePath parses a "/" or "//" followed by relative steps.
+func (p *parser) parseRelativePath() []*step {
+	var steps []*step
+	if p.next().val == "//" {
+		steps = append(steps, descendantOrSelfStep())
+	}
+	return append(steps, p.parseSteps()...)
+}
+
+func descendantOrSelfStep() *step {
+	return &step{axis: descendantOrSelfAxis, test: nodeTest{typ: "node"}}
+}
+
+// parseSteps parses steps separated by "/" and "//".
+func (p *parser) parseSteps() []*step {
+	steps := []*step{p.parseStep()}
+	for {
+		t := p.peek()
+		if t.typ != operatorToken || t.val != "/" && t.val != "//" {
+			return steps
+		}
+		p.next()
+		if t.val == "//" {
+			steps = append(steps, descendantOrSelfStep())
+		}
+		steps = append(steps, p.parseStep())
+	}
+}
+
+func (p *parser) startsStep() bool {
+	switch t := p.peek(); t.typ {
+	case nameToken, nameTestToken:
+		return true
+	case punctToken:
+		return t.val == "@" || t.val == "." || t.val == ".."
+	}
+	return false
+}
+
+func (p *parser) parseStep() *step {
+	if p.accept(punctToken, ".") {
+		return &step{axis: selfAxis, test: nodeTest{typ: "node"}}
+	}
+	if p.accept(punctToken, "..") {
+		return &step{axis: parentAxis, test: nodeTest{typ: "node"}}
+	}
+	s := &step{axis: childAxis}
+	if p.accept(punctToken, "@") {
+		s.axis = attributeAxis
+	} else if t, next := p.peek(), p.peekN(1); t.typ == nameToken && next.typ == punctToken && next.val == "::" {
+		a, ok := axes[t.val]
+		if !ok {
+			p.errorf(t, "unknown axis %s", t.val)
+		}
+		s.axis = a
+		p.next()
+		p.next()
+	}
+	s.test = p.parseNodeTest()
+	for p.peek().typ == punctToken && p.peek().val == "[" {
+		s.preds = append(s.preds, p.parsePredicate())
+	}
+	return s
+}
+
+func (p *parser) parseNodeTest() nodeTest {
+	t := p.next()
+	switch t.typ {
+	case nameTestToken:
+		return nodeTest{name: t.val}
+	case nameToken:
+		if next := p.peek(); next.typ == punctToken && next.val == "(" && isNodeType(t.val) {
+			p.next()
+			if t.val == "processing-instruction" && p.peek().typ == literalToken {
+				p.next()
+			}
+			p.expect(punctToken, ")")
+			return nodeTest{typ: t.val}
+		}
+		return nodeTest{name: t.val}
+	case eofToken:
+		p.errorf(t, "expected node test at end of expression")
+	}
+	p.errorf(t, "expected node test, found %q", t.val)
+	panic("unreachable")
+}
+
+func (p *parser) parsePredicate() expr {
+	p.expect(punctToken, "[")
+	e := p.parseOr()
+	p.expect(punctToken, "]")
+	return e
+}
@@ -0,0 +1,87 @@
+// Package xpath implements XPath 1.0 expressions over exp/html parse trees.
+//
+// All axes, node tests, operators and functions of the XPath 1.0 core
+// library are supported, except for variable references. html documents
+// have no namespace or processing instruction nodes, so the namespace axis
+// and processing-instruction() never select anything. Element names are
+// matched without regard to case, and an unprefixed name matches elements
+// in any namespace, so that "//svg" finds inline svg. A prefix selects the
+// parser's namespace abbreviation instead, as in "//svg:rect".
+//
+//	e, err := xpath.Compile("//a[starts-with(@href, 'http')]/@href")
+//	if err != nil {
+//		// ...
+//	}
+//	nodes, err := e.Select(doc)
+package xpath
+
+import (
+	"errors"
+	"exp/html"
+)
+
+// An Expr is a compiled XPath expression.
+type Expr struct {
+	src string
+	e   expr
+}
+
+// Compile parses an XPath expression.
+func Compile(src string) (*Expr, error) {
+	e, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{src, e}, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be
+// parsed.
+func MustCompile(src string) *Expr {
+	e, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source text of e.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Evaluate evaluates e with n as the context node. The result is a []Node
+// in document order for node-sets, or a string, float64 or bool.
+func (e *Expr) Evaluate(n *html.Node) (result interface{}, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			ee, ok := x.(evalError)
+			if !ok {
+				panic(x)
+			}
+			result, err = nil, ee.err
+		}
+	}()
+	c := &context{node: Node{Node: n}, pos: 1, size: 1, doc: newDocument(n)}
+	v := e.e.eval(c)
+	if ns, ok := v.(nodeSet); ok {
+		return []Node(ns), nil
+	}
+	return v, nil
+}
+
+// Select evaluates e, which must yield a node-set, with n as the context
+// node and returns the selected nodes in document order.
+func (e *Expr) Select(n *html.Node) ([]Node, error) {
+	v, err := e.Evaluate(n)
+	if err != nil {
+		return nil, err
+	}
+	ns, ok := v.([]Node)
+	if !ok {
+		return nil, errNotNodeSet
+	}
+	return ns, nil
+}
+
+var errNotNodeSet = errors.New("xpath: expression does not select nodes")
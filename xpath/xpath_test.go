@@ -0,0 +1,181 @@
+package xpath
+
+import (
+	"exp/html"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testDoc = `<!DOCTYPE html>
+<html lang="en-GB"><head><title>Shop</title></head><body>
+<div id="main">
+<h1>Items</h1>
+<ul>
+<li class="item" data-price="3.50"><a href="/a">Apple</a></li>
+<li class="item sale" data-price="1.25"><a href="http://x.com/b">Banana</a></li>
+<li class="item" data-price="10"><a href="/c">  Cherry   pie </a></li>
+</ul>
+<!-- note -->
+<p>one</p><p>two</p>
+</div>
+<svg><rect width="1"/></svg>
+</body></html>`
+
+var evalTests = []struct {
+	expr string
+	want string
+}{
+	// Location paths.
+	{"/html/body/div/h1", "[<h1>]"},
+	{"//li", "[<li> <li> <li>]"},
+	{"//LI", "[<li> <li> <li>]"},
+	{"//li[2]/a", "[<a>]"},
+	{"//li[last()]/a/text()", `["  Cherry   pie "]`},
+	{"//a/@href", `[@href="/a" @href="http://x.com/b" @href="/c"]`},
+	{"//li[@class='item sale']//text()", `["Banana"]`},
+	{"//li[contains(@class, 'sale')]/a/@href", `[@href="http://x.com/b"]`},
+	{"//li[@data-price > 2]/a", "[<a> <a>]"},
+	{"//p[1] | //h1", "[<h1> <p>]"},
+	{"//p[. = 'two']", "[<p>]"},
+	{"//ul/..", "[<div>]"},
+	{"//ul/li[1]/following-sibling::li", "[<li> <li>]"},
+	{"//li[3]/preceding-sibling::li[1]/a/text()", `["Banana"]`},
+	{"//a[. = 'Apple']/ancestor::*", "[<html> <body> <div> <ul> <li>]"},
+	{"//a[. = 'Apple']/ancestor::*[1]", "[<li>]"},
+	{"//h1/following::p", "[<p> <p>]"},
+	{"//p[1]/preceding::h1", "[<h1>]"},
+	{"//comment()", `[<!-- note -->]`},
+	{"//div/self::div", "[<div>]"},
+	{"//li/@*[1]", `[@class="item" @class="item sale" @class="item"]`},
+	{"//svg/rect", "[<rect>]"},
+	{"//svg:rect", "[<rect>]"},
+	{"//html:rect", "[]"},
+	{"id('main')/h1", "[<h1>]"},
+	{"(//li)[2]", "[<li>]"},
+	{"//li[position() mod 2 = 1]", "[<li> <li>]"},
+	{"//p[not(preceding-sibling::p)]", "[<p>]"},
+	{"/", "[#document]"},
+
+	// Scalars.
+	{"count(//li)", "3"},
+	{"sum(//li/@data-price)", "14.75"},
+	{"//li[1]/@data-price * 2", "7"},
+	{"normalize-space(//li[3])", `"Cherry pie"`},
+	{"string(//title)", `"Shop"`},
+	{"string-length(//title)", "4"},
+	{"concat(//h1, ': ', count(//li))", `"Items: 3"`},
+	{"substring('12345', 1.5, 2.6)", `"234"`},
+	{"substring('12345', 0, 3)", `"12"`},
+	{"substring-before('a/b', '/')", `"a"`},
+	{"substring-after('a/b', '/')", `"b"`},
+	{"translate('bar', 'abc', 'AB')", `"BAr"`},
+	{"starts-with(//a/@href, '/')", "true"},
+	{"boolean(//table)", "false"},
+	{"//li = 'Banana'", "true"},
+	{"//li != 'Banana'", "true"},
+	{"//li/@data-price < 2", "true"},
+	{"1 div 0", "Infinity"},
+	{"0 div 0", "NaN"},
+	{"-3 mod 2", "-1"},
+	{"round(2.5) + round(-2.5) + floor(1.9) + ceiling(1.1)", "4"},
+	{"number('12') + number(' 3 ')", "15"},
+	{"number('1e3')", "NaN"},
+	{"name(//svg/*)", `"svg:rect"`},
+	{"local-name(//svg/*)", `"rect"`},
+	{"namespace-uri(//svg)", `"http://www.w3.org/2000/svg"`},
+	{"count(//li[lang('en')])", "3"},
+	{"true() and not(false())", "true"},
+	{"1 = 1 or 1 div 0", "true"},
+	{"2 * 3 - -1", "7"},
+}
+
+// describe formats an evaluation result for comparison.
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case []Node:
+		var s []string
+		for _, n := range v {
+			switch {
+			case n.IsAttr():
+				s = append(s, fmt.Sprintf("@%s=%q", n.Attr.Key, n.Attr.Val))
+			case n.Type == html.ElementNode:
+				s = append(s, "<"+n.Data+">")
+			case n.Type == html.TextNode:
+				s = append(s, fmt.Sprintf("%q", n.Data))
+			case n.Type == html.CommentNode:
+				s = append(s, "<!--"+n.Data+"-->")
+			case n.Type == html.DocumentNode:
+				s = append(s, "#document")
+			}
+		}
+		return "[" + strings.Join(s, " ") + "]"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case float64:
+		return formatNumber(v)
+	}
+	return fmt.Sprint(v)
+}
+
+func TestEvaluate(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(testDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range evalTests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.expr, err)
+			continue
+		}
+		v, err := e.Evaluate(doc)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := describe(v); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestRelativeContext(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(testDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ul, err := MustCompile("//ul").Select(doc)
+	if err != nil || len(ul) != 1 {
+		t.Fatalf("got %v, %v, want one ul", ul, err)
+	}
+	items, err := MustCompile("li/a").Select(ul[0].Node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := describe(items); got != "[<a> <a> <a>]" {
+		t.Errorf("got %s, want three links", got)
+	}
+	if _, err := MustCompile("count(li)").Select(ul[0].Node); err == nil {
+		t.Errorf("Select of a number succeeded, want an error")
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	for _, src := range []string{"", "//", "a[", "a]", "foo(", "unknown()", "count()", "a b", "'x", "child::", "bogus::a", "$v", "1 +", "@"} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", src)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("Compile(%q) returned %T, want *SyntaxError", src, err)
+		}
+	}
+}
+
+func TestEvalError(t *testing.T) {
+	doc := &html.Node{Type: html.DocumentNode}
+	for _, src := range []string{"'a'/b", "1 | //a", "count(1)", "(1)[1]"} {
+		if _, err := MustCompile(src).Evaluate(doc); err == nil {
+			t.Errorf("%q: evaluation succeeded, want an error", src)
+		}
+	}
+}